@@ -1,8 +1,10 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -11,15 +13,263 @@ import (
 	"gopkg.in/yaml.v2"
 )
 
+// exit codes, so scripts can tell failures apart
+const (
+	EXIT_FAILURE       = 1
+	EXIT_INVALID_INPUT = 2
+	EXIT_NO_MATCH      = 3
+	EXIT_GIT_FAILURE   = 4
+)
+
 func main() {
 	dstask.LoadConfigFromEnv()
-	context := dstask.LoadContext()
 	cmdLine := dstask.ParseCmdLine(os.Args[1:]...)
 
+	if err := run(cmdLine); err != nil {
+		fmt.Fprintf(os.Stderr, "\033[31m%s\033[0m\n", err)
+		os.Exit(exitCode(err))
+	}
+}
+
+func exitCode(err error) int {
+	var parseErr *dstask.ParseError
+	var gitErr *dstask.GitError
+
+	switch {
+	case errors.Is(err, dstask.ErrNoMatchingTasks), errors.Is(err, dstask.ErrTaskNotFound):
+		return EXIT_NO_MATCH
+	case errors.Is(err, dstask.ErrInvalidInput), errors.Is(err, dstask.ErrInvalidTransition), errors.As(err, &parseErr):
+		return EXIT_INVALID_INPUT
+	case errors.As(err, &gitErr):
+		return EXIT_GIT_FAILURE
+	default:
+		return EXIT_FAILURE
+	}
+}
+
+// the count and --force, if allowed, for undo, redo and history
+func parseHistoryArgs(args []string, n int, allowForce bool) (int, bool, error) {
+	force := false
+	counted := false
+
+	for _, arg := range args {
+		if arg == "--force" && allowForce {
+			force = true
+			continue
+		}
+
+		count, err := strconv.Atoi(arg)
+		if err != nil || count < 1 || counted {
+			return 0, false, dstask.InvalidInput("Invalid argument %s, expected a number of changes", arg)
+		}
+		n = count
+		counted = true
+	}
+
+	return n, force, nil
+}
+
+// show the history of a task, or restore it to a previous version with
+// "restore <commit>"
+func taskHistory(cmdLine dstask.CmdLine) error {
+	store := dstask.DefaultStore().(*dstask.GitStore)
+
+	if len(cmdLine.IDs) > 1 {
+		return dstask.InvalidInput("Specify a single task")
+	}
+
+	ts, err := dstask.LoadTaskSetFromDisk(dstask.NON_RESOLVED_STATUSES)
+	if err != nil {
+		return err
+	}
+
+	task, err := ts.GetByID(cmdLine.IDs[0])
+	if err != nil {
+		return err
+	}
+
+	words := strings.Fields(cmdLine.Text)
+
+	if len(words) == 0 {
+		versions, err := store.TaskHistory(task.UUID)
+		if err != nil {
+			return err
+		}
+
+		for _, version := range versions {
+			fmt.Printf("%s  %s  %s\n", version.Hash[:7], version.Time.Local().Format("2006-01-02 15:04"), version.Summary)
+
+			if version.Removed {
+				fmt.Printf("    \033[38;5;245mremoved\033[0m\n")
+			}
+
+			for _, change := range version.Changes {
+				fmt.Printf("    \033[38;5;245m%s\033[0m\n", change)
+			}
+		}
+		return nil
+	}
+
+	if len(words) != 2 || words[0] != "restore" {
+		return dstask.InvalidInput("Usage: dstask <id> history [restore <commit>]")
+	}
+
+	version, err := store.TaskVersion(task.UUID, words[1])
+	if err != nil {
+		return err
+	}
+
+	// the status is changed with commands such as start and done, which
+	// enforce valid transitions
+	version.ID = task.ID
+	version.UUID = task.UUID
+	version.Status = task.Status
+
+	if err := ts.UpdateTask(version); err != nil {
+		return err
+	}
+
+	return ts.SaveToDisk("Restored %s to %s", version, words[1])
+}
+
+// whether the command only reads tasks, see READ_ONLY_CMDS
+var readOnly bool
+
+// load tasks brought up to date, see TaskSet.Housekeep. Commands that change
+// tasks commit the housekeeping with their own change; others only show it,
+// on stderr so exported output is unaffected.
+func loadTaskSet(statuses []string) (*dstask.TaskSet, error) {
+	ts, err := dstask.LoadTaskSetFromDisk(statuses)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ts.Housekeep(time.Now()); err != nil {
+		return nil, err
+	}
+
+	if readOnly {
+		for _, line := range ts.Housekeeping() {
+			fmt.Fprintln(os.Stderr, line)
+		}
+	}
+
+	return ts, nil
+}
+
+// release the lock on the store taken by run
+var unlockStore = func() {}
+
+// edit in $EDITOR without holding the lock on the store, so other dstask
+// processes are not kept waiting for the user. The lock is taken again after.
+func editUnlocked(data []byte, ext string) ([]byte, error) {
+	unlockStore()
+	unlockStore = func() {}
+
+	data, err := dstask.EditBytes(data, ext)
+	if err != nil {
+		return nil, err
+	}
+
+	unlock, err := dstask.DefaultStore().Lock(true)
+	if err != nil {
+		return nil, err
+	}
+	unlockStore = unlock
+
+	return data, nil
+}
+
+// reload the tasks after the given task was edited, failing if it was saved
+// by another dstask process in the meantime
+func reloadEdited(task dstask.Task) (*dstask.TaskSet, dstask.Task, error) {
+	ts, err := loadTaskSet(dstask.NON_RESOLVED_STATUSES)
+	if err != nil {
+		return nil, dstask.Task{}, err
+	}
+
+	current, err := ts.GetByUUID(task.UUID)
+	if err != nil || !current.Modified.Equal(task.Modified) {
+		return nil, dstask.Task{}, fmt.Errorf("%w task %s was opened for editing", dstask.ErrConflict, task)
+	}
+
+	return ts, current, nil
+}
+
+func run(cmdLine dstask.CmdLine) error {
+	// run by git during a sync, which already holds the lock
+	if cmdLine.Cmd == dstask.CMD_MERGE_DRIVER {
+		if len(os.Args) != 5 {
+			return dstask.InvalidInput("Usage: dstask merge-driver <base> <ours> <theirs>")
+		}
+
+		return dstask.MergeTaskFiles(os.Args[2], os.Args[3], os.Args[4])
+	}
+
+	if err := cmdLine.Err(); err != nil {
+		return err
+	}
+
+	context, err := dstask.LoadContext()
+	if err != nil {
+		return err
+	}
+
 	if cmdLine.IgnoreContext {
 		context = dstask.CmdLine{}
 	}
 
+	// serialise access to the store, so a completion during a sync (for
+	// instance) cannot see or make a half finished change. Commands that only
+	// read can share it.
+	readOnly = dstask.StrSliceContains(dstask.READ_ONLY_CMDS, cmdLine.Cmd)
+
+	if cmdLine.Cmd != dstask.CMD_HELP {
+		unlock, err := dstask.DefaultStore().Lock(!readOnly)
+		if err != nil {
+			return err
+		}
+		unlockStore = unlock
+		defer func() { unlockStore() }()
+	}
+
+	if store, ok := dstask.DefaultStore().(*dstask.GitStore); ok && cmdLine.Cmd != dstask.CMD_MIGRATE && cmdLine.Cmd != dstask.CMD_COMPLETIONS {
+		if version, err := store.FormatVersion(); err == nil && version < dstask.FORMAT_VERSION {
+			fmt.Fprintf(os.Stderr, "Repository data format is version %d, run `dstask migrate` to upgrade to version %d\n", version, dstask.FORMAT_VERSION)
+		}
+	}
+
+	// words that only look like a UUID prefix are text, which the tasks are
+	// needed to tell
+	if len(cmdLine.UUIDPrefixes) > 0 {
+		// housekeeping keeps the IDs of existing tasks, so is left to the
+		// command
+		ts, err := dstask.LoadTaskSetFromDisk(dstask.NON_RESOLVED_STATUSES)
+		if err != nil {
+			return err
+		}
+
+		if cmdLine, err = ts.ParseCmdLine(os.Args[1:]...); err != nil {
+			return err
+		}
+
+		if err := cmdLine.Err(); err != nil {
+			return err
+		}
+	}
+
+	if dstask.StrSliceContains([]string{
+		dstask.CMD_UNDO,
+		dstask.CMD_REDO,
+		dstask.CMD_HISTORY,
+		dstask.CMD_SYNC,
+		dstask.CMD_GIT,
+	}, cmdLine.Cmd) {
+		if _, ok := dstask.DefaultStore().(*dstask.GitStore); !ok {
+			return dstask.InvalidInput("%s is only available with the git store", cmdLine.Cmd)
+		}
+	}
+
 	switch cmdLine.Cmd {
 	case "":
 		// default command is CMD_NEXT if not specified
@@ -28,19 +278,40 @@ func main() {
 		// TODO replace with non-truncated equivalent
 		fallthrough
 	case dstask.CMD_NEXT:
-		ts := dstask.LoadTaskSetFromDisk(dstask.NON_RESOLVED_STATUSES)
+		ts, err := loadTaskSet(dstask.NON_RESOLVED_STATUSES)
+		if err != nil {
+			return err
+		}
+
 		ts.Filter(context)
 		ts.Filter(cmdLine)
+		// templates are not actionable, their instances are
+		ts.FilterOutStatus(dstask.STATUS_RECURRING)
+		ts.FilterOutStatus(dstask.STATUS_DEFERRED)
 		ts.SortByPriority()
+		if cmdLine.Format != "" {
+			return ts.WriteTasks(cmdLine.Format)
+		}
 		context.PrintContextDescription()
-		ts.DisplayByNext()
+		return ts.DisplayByNext()
 
 	case dstask.CMD_ADD:
-		ts := dstask.LoadTaskSetFromDisk(dstask.NON_RESOLVED_STATUSES)
+		ts, err := loadTaskSet(dstask.NON_RESOLVED_STATUSES)
+		if err != nil {
+			return err
+		}
 
 		if len(cmdLine.Text) != 0 {
 			context.PrintContextDescription()
-			cmdLine.MergeContext(context)
+			if err := cmdLine.MergeContext(context); err != nil {
+				return err
+			}
+
+			due, err := dstask.ParseDueDate(cmdLine.Due, time.Now())
+			if err != nil {
+				return err
+			}
+
 			task := dstask.Task{
 				WritePending: true,
 				Status:       dstask.STATUS_PENDING,
@@ -49,17 +320,47 @@ func main() {
 				Project:      cmdLine.Project,
 				Priority:     cmdLine.Priority,
 				Notes:        cmdLine.Note,
+				Due:          due,
+			}
+
+			if cmdLine.Recur != "" {
+				var instance dstask.Task
+				task.Recur = cmdLine.Recur
+				task, instance, err = ts.AddRecurringTask(task)
+				if err != nil {
+					return err
+				}
+				if err := ts.SaveToDisk("Added recurring %s (%s), first instance %s", task, task.Recur, instance); err != nil {
+					return err
+				}
+			} else {
+				task, err = ts.AddTask(task)
+				if err != nil {
+					return err
+				}
+				if err := ts.SaveToDisk("Added %s", task); err != nil {
+					return err
+				}
 			}
-			task = ts.AddTask(task)
-			ts.SaveToDisk("Added %s", task)
 		}
 
 	case dstask.CMD_LOG:
-		ts := dstask.LoadTaskSetFromDisk(dstask.NON_RESOLVED_STATUSES)
+		ts, err := loadTaskSet(dstask.NON_RESOLVED_STATUSES)
+		if err != nil {
+			return err
+		}
 
 		if len(cmdLine.Text) != 0 {
 			context.PrintContextDescription()
-			cmdLine.MergeContext(context)
+			if err := cmdLine.MergeContext(context); err != nil {
+				return err
+			}
+
+			due, err := dstask.ParseDueDate(cmdLine.Due, time.Now())
+			if err != nil {
+				return err
+			}
+
 			task := dstask.Task{
 				WritePending: true,
 				Status:       dstask.STATUS_RESOLVED,
@@ -67,25 +368,55 @@ func main() {
 				Tags:         cmdLine.Tags,
 				Project:      cmdLine.Project,
 				Priority:     cmdLine.Priority,
+				Due:          due,
 				Resolved:     time.Now(),
 			}
-			task = ts.AddTask(task)
-			ts.SaveToDisk("Logged %s", task)
+			task, err = ts.AddTask(task)
+			if err != nil {
+				return err
+			}
+			if err := ts.SaveToDisk("Logged %s", task); err != nil {
+				return err
+			}
 		}
 
 	case dstask.CMD_START:
-		ts := dstask.LoadTaskSetFromDisk(dstask.NON_RESOLVED_STATUSES)
+		ts, err := loadTaskSet(dstask.NON_RESOLVED_STATUSES)
+		if err != nil {
+			return err
+		}
+
+		if dstask.SINGLE_ACTIVE && len(cmdLine.IDs) > 1 {
+			return dstask.InvalidInput("Only one task can be active, as DSTASK_SINGLE_ACTIVE is set")
+		}
+
+		var paused []dstask.Task
+
 		if len(cmdLine.IDs) > 0 {
 			// start given tasks by IDs
 			for _, id := range cmdLine.IDs {
-				task := ts.MustGetByID(id)
+				task, err := ts.GetByID(id)
+				if err != nil {
+					return err
+				}
+
+				if dstask.SINGLE_ACTIVE {
+					if paused, err = ts.PauseOtherActive(task.UUID); err != nil {
+						return err
+					}
+				}
+
 				task.Status = dstask.STATUS_ACTIVE
 				if cmdLine.Text != "" {
 					task.Notes += "\n" + cmdLine.Text
 				}
-				ts.MustUpdateTask(task)
+				if err := ts.UpdateTask(task); err != nil {
+					return err
+				}
 
-				ts.SaveToDisk("Started %s", task)
+				if err := ts.SaveToDisk("Started %s", task); err != nil {
+					return err
+				}
 
 				if task.Notes != "" {
 					fmt.Printf("\nNotes on task %d:\n\033[38;5;245m%s\033[0m", task.ID, task.Notes)
@@ -93,7 +424,15 @@ func main() {
 			}
 		} else if len(cmdLine.Text) != 0 {
 			// create a new task that is already active (started)
-			cmdLine.MergeContext(context)
+			if err := cmdLine.MergeContext(context); err != nil {
+				return err
+			}
+
+			due, err := dstask.ParseDueDate(cmdLine.Due, time.Now())
+			if err != nil {
+				return err
+			}
+
 			task := dstask.Task{
 				WritePending: true,
 				Status:       dstask.STATUS_ACTIVE,
@@ -102,50 +441,321 @@ func main() {
 				Project:      cmdLine.Project,
 				Priority:     cmdLine.Priority,
 				Notes:        cmdLine.Note,
+				Due:          due,
+			}
+			task, err = ts.AddTask(task)
+			if err != nil {
+				return err
 			}
-			task = ts.AddTask(task)
-			ts.SaveToDisk("Added and started %s", task)
+
+			if dstask.SINGLE_ACTIVE {
+				if paused, err = ts.PauseOtherActive(task.UUID); err != nil {
+					return err
+				}
+			}
+
+			if err := ts.SaveToDisk("Added and started %s", task); err != nil {
+				return err
+			}
+		}
+
+		for _, task := range paused {
+			fmt.Printf("Paused %s\n", task)
 		}
 
 	case dstask.CMD_STOP:
-		ts := dstask.LoadTaskSetFromDisk(dstask.NON_RESOLVED_STATUSES)
+		ts, err := loadTaskSet(dstask.NON_RESOLVED_STATUSES)
+		if err != nil {
+			return err
+		}
+
 		for _, id := range cmdLine.IDs {
-			task := ts.MustGetByID(id)
+			task, err := ts.GetByID(id)
+			if err != nil {
+				return err
+			}
+
 			task.Status = dstask.STATUS_PAUSED
 			if cmdLine.Text != "" {
 				task.Notes += "\n" + cmdLine.Text
 			}
-			ts.MustUpdateTask(task)
-			ts.SaveToDisk("Stopped %s", task)
+			if err := ts.UpdateTask(task); err != nil {
+				return err
+			}
+			if err := ts.SaveToDisk("Stopped %s", task); err != nil {
+				return err
+			}
 		}
 
 	case dstask.CMD_DONE:
 		fallthrough
 	case dstask.CMD_RESOLVE:
-		ts := dstask.LoadTaskSetFromDisk(dstask.NON_RESOLVED_STATUSES)
+		ts, err := loadTaskSet(dstask.NON_RESOLVED_STATUSES)
+		if err != nil {
+			return err
+		}
+
 		for _, id := range cmdLine.IDs {
-			task := ts.MustGetByID(id)
+			task, err := ts.GetByID(id)
+			if err != nil {
+				return err
+			}
+
+			if open := task.OpenSubtasks(); open > 0 {
+				if err := dstask.Confirm("Task %v has %d open subtasks. Resolve anyway?", task.ID, open); err != nil {
+					return err
+				}
+			}
 			task.Status = dstask.STATUS_RESOLVED
 			if cmdLine.Text != "" {
 				task.Notes += "\n" + cmdLine.Text
 			}
-			ts.MustUpdateTask(task)
-			ts.SaveToDisk("Resolved %s", task)
+			if err := ts.UpdateTask(task); err != nil {
+				return err
+			}
+			if err := ts.SaveToDisk("Resolved %s", task); err != nil {
+				return err
+			}
+
+			for _, unblocked := range ts.UnblockedBy(&task) {
+				fmt.Printf("Unblocked %s\n", unblocked)
+			}
+		}
+
+	case dstask.CMD_DEFER:
+		if cmdLine.Until == "" {
+			return dstask.InvalidInput("Specify when the task should return with until:<date>")
+		}
+
+		until, err := dstask.ParseDueDate(cmdLine.Until, time.Now())
+		if err != nil {
+			return err
+		}
+
+		if until.Before(time.Now()) {
+			return dstask.InvalidInput("until:%s is in the past", cmdLine.Until)
+		}
+
+		ts, err := loadTaskSet(dstask.NON_RESOLVED_STATUSES)
+		if err != nil {
+			return err
+		}
+
+		for _, id := range cmdLine.IDs {
+			task, err := ts.GetByID(id)
+			if err != nil {
+				return err
+			}
+
+			task.Status = dstask.STATUS_DEFERRED
+			task.DeferredUntil = until
+			if cmdLine.Text != "" {
+				task.Notes += "\n" + cmdLine.Text
+			}
+			if err := ts.UpdateTask(task); err != nil {
+				return err
+			}
+			if err := ts.SaveToDisk("Deferred %s until %s", task, dstask.FormatDue(until)); err != nil {
+				return err
+			}
+		}
+
+	case dstask.CMD_DELEGATE:
+		words := strings.SplitN(cmdLine.Text, " ", 2)
+		if words[0] == "" {
+			return dstask.InvalidInput("Specify who the task is delegated to")
+		}
+
+		person := words[0]
+		var note string
+		if len(words) > 1 {
+			note = words[1]
+		}
+
+		ts, err := loadTaskSet(dstask.NON_RESOLVED_STATUSES)
+		if err != nil {
+			return err
+		}
+
+		for _, id := range cmdLine.IDs {
+			task, err := ts.GetByID(id)
+			if err != nil {
+				return err
+			}
+
+			task.Delegate(person, note, time.Now())
+			if err := ts.UpdateTask(task); err != nil {
+				return err
+			}
+			if err := ts.SaveToDisk("Delegated %s to %s", task, person); err != nil {
+				return err
+			}
+		}
+
+	case dstask.CMD_UNDELEGATE:
+		ts, err := loadTaskSet(dstask.NON_RESOLVED_STATUSES)
+		if err != nil {
+			return err
+		}
+
+		for _, id := range cmdLine.IDs {
+			task, err := ts.GetByID(id)
+			if err != nil {
+				return err
+			}
+
+			if task.Status != dstask.STATUS_DELEGATED {
+				return dstask.InvalidInput("Task %v is not delegated", task.ID)
+			}
+			task.Undelegate(cmdLine.Text, time.Now())
+			if err := ts.UpdateTask(task); err != nil {
+				return err
+			}
+			if err := ts.SaveToDisk("Took back %s", task); err != nil {
+				return err
+			}
+		}
+
+	case dstask.CMD_SUBTASK:
+		if len(cmdLine.IDs) == 0 {
+			return dstask.InvalidInput("Specify a task")
+		}
+
+		action, number, summary, err := dstask.ParseSubtaskCmd(cmdLine)
+		if err != nil {
+			return err
+		}
+
+		ts, err := loadTaskSet(dstask.NON_RESOLVED_STATUSES)
+		if err != nil {
+			return err
+		}
+
+		task, err := ts.GetByID(cmdLine.IDs[0])
+		if err != nil {
+			return err
+		}
+
+		var st dstask.SubTask
+		var verb string
+
+		switch action {
+		case "":
+			return ts.DisplayTask(&task)
+		case dstask.SUBTASK_ADD:
+			task.AddSubtask(summary)
+			if err := ts.UpdateTask(task); err != nil {
+				return err
+			}
+			return ts.SaveToDisk("Added subtask to %s: %s", task, summary)
+		case dstask.SUBTASK_DONE:
+			verb = "Resolved"
+			st, err = task.SetSubtaskResolved(number, true)
+		case dstask.SUBTASK_UNDONE:
+			verb = "Reopened"
+			st, err = task.SetSubtaskResolved(number, false)
+		case dstask.SUBTASK_RM:
+			verb = "Removed"
+			st, err = task.RemoveSubtask(number)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if err := ts.UpdateTask(task); err != nil {
+			return err
+		}
+		if err := ts.SaveToDisk("%s subtask %d of %s: %s", verb, number, task, st.Summary); err != nil {
+			return err
+		}
+
+	case dstask.CMD_DEPENDS:
+		if len(cmdLine.IDs) < 2 {
+			return dstask.InvalidInput("Specify a task followed by the tasks it depends on")
+		}
+
+		ts, err := loadTaskSet(dstask.NON_RESOLVED_STATUSES)
+		if err != nil {
+			return err
+		}
+
+		task, err := ts.GetByID(cmdLine.IDs[0])
+		if err != nil {
+			return err
+		}
+
+		for _, id := range cmdLine.IDs[1:] {
+			dep, err := ts.GetByID(id)
+			if err != nil {
+				return err
+			}
+
+			if err := ts.AddDependency(&task, dep); err != nil {
+				return err
+			}
+		}
+
+		if err := ts.UpdateTask(task); err != nil {
+			return err
+		}
+		if err := ts.SaveToDisk("Added dependencies to %s", task); err != nil {
+			return err
+		}
+
+	case dstask.CMD_NODEPEND:
+		if len(cmdLine.IDs) < 2 {
+			return dstask.InvalidInput("Specify a task followed by the tasks it should no longer depend on")
+		}
+
+		ts, err := loadTaskSet(dstask.NON_RESOLVED_STATUSES)
+		if err != nil {
+			return err
+		}
+
+		task, err := ts.GetByID(cmdLine.IDs[0])
+		if err != nil {
+			return err
+		}
+
+		for _, id := range cmdLine.IDs[1:] {
+			dep, err := ts.GetByID(id)
+			if err != nil {
+				return err
+			}
+
+			if !task.RemoveDependency(dep.UUID) {
+				return dstask.InvalidInput("Task %v does not depend on task %v", task.ID, id)
+			}
+		}
+
+		if err := ts.UpdateTask(task); err != nil {
+			return err
+		}
+		if err := ts.SaveToDisk("Removed dependencies from %s", task); err != nil {
+			return err
 		}
 
 	case dstask.CMD_CONTEXT:
 		if len(os.Args) < 3 {
 			fmt.Printf("Current context: %s", context)
 		} else if os.Args[2] == "none" {
-			dstask.SaveContext(dstask.CmdLine{})
+			return dstask.SaveContext(dstask.CmdLine{})
 		} else {
-			dstask.SaveContext(cmdLine)
+			return dstask.SaveContext(cmdLine)
 		}
 
 	case dstask.CMD_MODIFY:
-		ts := dstask.LoadTaskSetFromDisk(dstask.NON_RESOLVED_STATUSES)
+		ts, err := loadTaskSet(dstask.NON_RESOLVED_STATUSES)
+		if err != nil {
+			return err
+		}
+
 		for _, id := range cmdLine.IDs {
-			task := ts.MustGetByID(id)
+			task, err := ts.GetByID(id)
+			if err != nil {
+				return err
+			}
 
 			for _, tag := range cmdLine.Tags {
 				if !dstask.StrSliceContains(task.Tags, tag) {
@@ -172,48 +782,104 @@ func main() {
 				task.Priority = cmdLine.Priority
 			}
 
-			ts.MustUpdateTask(task)
-			ts.SaveToDisk("Modified %s", task)
+			if cmdLine.Due != "" {
+				task.Due, err = dstask.ParseDueDate(cmdLine.Due, time.Now())
+				if err != nil {
+					return err
+				}
+			}
+
+			if cmdLine.Recur != "" {
+				if task.Status != dstask.STATUS_RECURRING {
+					return dstask.InvalidInput("Task %v is not a recurring template", task.ID)
+				}
+				task.Recur = cmdLine.Recur
+			}
+
+			if err := ts.UpdateTask(task); err != nil {
+				return err
+			}
+			if err := ts.SaveToDisk("Modified %s", task); err != nil {
+				return err
+			}
 		}
 
 	case dstask.CMD_EDIT:
-		ts := dstask.LoadTaskSetFromDisk(dstask.NON_RESOLVED_STATUSES)
+		ts, err := loadTaskSet(dstask.NON_RESOLVED_STATUSES)
+		if err != nil {
+			return err
+		}
+
 		for _, id := range cmdLine.IDs {
-			task := ts.MustGetByID(id)
+			task, err := ts.GetByID(id)
+			if err != nil {
+				return err
+			}
 
 			// hide ID
-			task.ID = 0
+			edited := task
+			edited.ID = 0
 
-			data, err := yaml.Marshal(&task)
+			data, err := yaml.Marshal(&edited)
 			if err != nil {
 				// TODO present error to user, specific error message is important
-				dstask.ExitFail("Failed to marshal task %s", task)
+				return fmt.Errorf("Failed to marshal task %s: %w", task, err)
+			}
+
+			data, err = editUnlocked(data, "yml")
+			if err != nil {
+				return err
 			}
 
-			data = dstask.MustEditBytes(data, "yml")
+			ts, task, err = reloadEdited(task)
+			if err != nil {
+				return err
+			}
 
-			err = yaml.Unmarshal(data, &task)
+			err = yaml.Unmarshal(data, &edited)
 			if err != nil {
 				// TODO present error to user, specific error message is important
 				// TODO reattempt mechanism
-				dstask.ExitFail("Failed to unmarshal yml")
+				return dstask.InvalidInput("Failed to unmarshal yml: %s", err)
 			}
 
 			// re-add ID
-			task.ID = id
+			edited.ID = task.ID
+			task = edited
 
-			ts.MustUpdateTask(task)
-			ts.SaveToDisk("Edited %s", task)
+			if err := ts.UpdateTask(task); err != nil {
+				return err
+			}
+			if err := ts.SaveToDisk("Edited %s", task); err != nil {
+				return err
+			}
 		}
 
 	case dstask.CMD_NOTES:
 		fallthrough
 	case dstask.CMD_NOTE:
-		ts := dstask.LoadTaskSetFromDisk(dstask.NON_RESOLVED_STATUSES)
+		ts, err := loadTaskSet(dstask.NON_RESOLVED_STATUSES)
+		if err != nil {
+			return err
+		}
+
 		for _, id := range cmdLine.IDs {
-			task := ts.MustGetByID(id)
+			task, err := ts.GetByID(id)
+			if err != nil {
+				return err
+			}
+
 			if cmdLine.Text == "" {
-				task.Notes = string(dstask.MustEditBytes([]byte(task.Notes), "md"))
+				notes, err := editUnlocked([]byte(task.Notes), "md")
+				if err != nil {
+					return err
+				}
+
+				ts, task, err = reloadEdited(task)
+				if err != nil {
+					return err
+				}
+				task.Notes = string(notes)
 			} else {
 				if task.Notes == "" {
 					task.Notes = cmdLine.Text
@@ -222,83 +888,479 @@ func main() {
 				}
 			}
 
-			ts.MustUpdateTask(task)
-			ts.SaveToDisk("Edit note %s", task)
+			if err := ts.UpdateTask(task); err != nil {
+				return err
+			}
+			if err := ts.SaveToDisk("Edit note %s", task); err != nil {
+				return err
+			}
 		}
 
 	case dstask.CMD_UNDO:
-		dstask.MustRunGitCmd("revert", "--no-edit", "HEAD")
+		n, force, err := parseHistoryArgs(os.Args[2:], 1, true)
+		if err != nil {
+			return err
+		}
+
+		if err := dstask.DefaultStore().(*dstask.GitStore).Undo(n, force); err != nil {
+			return err
+		}
+
+		return dstask.WriteICalFeed(dstask.DefaultStore())
+
+	case dstask.CMD_REDO:
+		n, _, err := parseHistoryArgs(os.Args[2:], 1, false)
+		if err != nil {
+			return err
+		}
+
+		if err := dstask.DefaultStore().(*dstask.GitStore).Redo(n); err != nil {
+			return err
+		}
+
+		return dstask.WriteICalFeed(dstask.DefaultStore())
+
+	case dstask.CMD_HISTORY:
+		// dstask <id> history, rather than dstask history [N]
+		if len(cmdLine.IDs) > 0 && !strings.EqualFold(os.Args[1], dstask.CMD_HISTORY) {
+			return taskHistory(cmdLine)
+		}
+
+		// all by default
+		n, _, err := parseHistoryArgs(os.Args[2:], 0, false)
+		if err != nil {
+			return err
+		}
+
+		entries, err := dstask.DefaultStore().(*dstask.GitStore).History(n)
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range entries {
+			line := fmt.Sprintf("%s  %s  %s", entry.Hash[:7], entry.Time.Local().Format("2006-01-02 15:04"), entry.Summary)
+
+			if entry.Undone {
+				fmt.Printf("\033[38;5;245m%s (undone)\033[0m\n", line)
+			} else {
+				fmt.Println(line)
+			}
+		}
 
 	case dstask.CMD_SYNC:
-		dstask.MustRunGitCmd("pull", "--no-edit", "--commit", "origin", "master")
-		dstask.MustRunGitCmd("push", "origin", "master")
+		store := dstask.DefaultStore().(*dstask.GitStore)
+
+		target, err := store.SyncTarget()
+		if err != nil {
+			return err
+		}
+
+		if dstask.StrSliceContains(os.Args[2:], "--status") {
+			commits, err := store.UnpushedCommits(target)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("%d local commits not pushed to %s, as of the last sync\n", len(commits), target)
+			for _, commit := range commits {
+				fmt.Printf("    %s\n", commit)
+			}
+			return nil
+		}
+
+		executable, err := os.Executable()
+		if err != nil {
+			return err
+		}
+
+		if err := store.Sync(target, executable); err != nil {
+			return err
+		}
+
+		return dstask.WriteICalFeed(store)
 
 	case dstask.CMD_GIT:
-		dstask.MustRunGitCmd(os.Args[2:]...)
+		if err := dstask.RunGitCmd(os.Args[2:]...); err != nil {
+			return err
+		}
+
+		// the command may have changed tasks, as with git pull
+		return dstask.WriteICalFeed(dstask.DefaultStore())
 
 	case dstask.CMD_SHOW_ACTIVE:
-		context.PrintContextDescription()
-		ts := dstask.LoadTaskSetFromDisk(dstask.NON_RESOLVED_STATUSES)
+		ts, err := loadTaskSet(dstask.NON_RESOLVED_STATUSES)
+		if err != nil {
+			return err
+		}
+
 		ts.Filter(context)
 		ts.Filter(cmdLine)
 		ts.FilterByStatus(dstask.STATUS_ACTIVE)
 		ts.SortByPriority()
-		ts.DisplayByNext()
+		if cmdLine.Format != "" {
+			return ts.WriteTasks(cmdLine.Format)
+		}
+		context.PrintContextDescription()
+		return ts.DisplayByNext()
 
 	case dstask.CMD_SHOW_PAUSED:
-		context.PrintContextDescription()
-		ts := dstask.LoadTaskSetFromDisk(dstask.NON_RESOLVED_STATUSES)
+		ts, err := loadTaskSet(dstask.NON_RESOLVED_STATUSES)
+		if err != nil {
+			return err
+		}
+
 		ts.Filter(context)
 		ts.Filter(cmdLine)
 		ts.FilterByStatus(dstask.STATUS_PAUSED)
 		ts.SortByPriority()
-		ts.DisplayByNext()
+		if cmdLine.Format != "" {
+			return ts.WriteTasks(cmdLine.Format)
+		}
+		context.PrintContextDescription()
+		return ts.DisplayByNext()
+
+	case dstask.CMD_SHOW_DEFERRED:
+		ts, err := loadTaskSet(dstask.NON_RESOLVED_STATUSES)
+		if err != nil {
+			return err
+		}
+
+		ts.Filter(context)
+		ts.Filter(cmdLine)
+		ts.FilterByStatus(dstask.STATUS_DEFERRED)
+		ts.SortByDeferredUntil()
+		if cmdLine.Format != "" {
+			return ts.WriteTasks(cmdLine.Format)
+		}
+		context.PrintContextDescription()
+		return ts.DisplayDeferred()
+
+	case dstask.CMD_SHOW_DELEGATED:
+		ts, err := loadTaskSet(dstask.NON_RESOLVED_STATUSES)
+		if err != nil {
+			return err
+		}
+
+		ts.Filter(context)
+		ts.Filter(cmdLine)
+		ts.FilterByStatus(dstask.STATUS_DELEGATED)
+		if cmdLine.Format != "" {
+			return ts.WriteTasks(cmdLine.Format)
+		}
+		context.PrintContextDescription()
+		return ts.DisplayDelegated()
+
+	case dstask.CMD_SHOW_RECURRING:
+		ts, err := loadTaskSet(dstask.NON_RESOLVED_STATUSES)
+		if err != nil {
+			return err
+		}
+
+		ts.Filter(context)
+		ts.Filter(cmdLine)
+		ts.FilterByStatus(dstask.STATUS_RECURRING)
+		ts.SortByPriority()
+		if cmdLine.Format != "" {
+			return ts.WriteTasks(cmdLine.Format)
+		}
+		context.PrintContextDescription()
+		return ts.DisplayByNext()
 
 	case dstask.CMD_OPEN:
-		ts := dstask.LoadTaskSetFromDisk(dstask.NON_RESOLVED_STATUSES)
+		ts, err := loadTaskSet(dstask.NON_RESOLVED_STATUSES)
+		if err != nil {
+			return err
+		}
+
 		for _, id := range cmdLine.IDs {
-			task := ts.MustGetByID(id)
+			task, err := ts.GetByID(id)
+			if err != nil {
+				return err
+			}
+
 			urls := xurls.Relaxed().FindAllString(task.Summary+" "+task.Notes, -1)
 
 			if len(urls) == 0 {
-				dstask.ExitFail("No URLs found in task %v", task.ID)
+				return fmt.Errorf("No URLs found in task %v", task.ID)
 			}
 
 			for _, url := range urls {
-				dstask.MustOpenBrowser(url)
+				if err := dstask.OpenBrowser(url); err != nil {
+					return err
+				}
+			}
+		}
+
+	case dstask.CMD_REINDEX:
+		store, ok := dstask.DefaultStore().(*dstask.GitStore)
+		if !ok {
+			return dstask.InvalidInput("%s is only available with the git store", cmdLine.Cmd)
+		}
+
+		n, err := store.Reindex()
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Indexed %d tasks\n", n)
+
+	case dstask.CMD_FSCK:
+		store, ok := dstask.DefaultStore().(*dstask.GitStore)
+		if !ok {
+			return dstask.InvalidInput("%s is only available with the git store", cmdLine.Cmd)
+		}
+
+		fix := dstask.StrSliceContains(os.Args[2:], "--fix")
+
+		problems, err := store.Fsck()
+		if err != nil {
+			return err
+		}
+
+		var fixed, remaining int
+
+		for _, problem := range problems {
+			if fix && problem.Fixable() {
+				if err := problem.Fix(); err != nil {
+					return fmt.Errorf("Failed to fix %s: %w", problem.Path, err)
+				}
+				fixed++
+				fmt.Printf("%s: %s \033[32m(fixed)\033[0m\n", problem.Path, problem.Description)
+			} else {
+				remaining++
+				fmt.Printf("%s: %s\n", problem.Path, problem.Description)
+			}
+		}
+
+		if fixed > 0 {
+			msg := fmt.Sprintf("Fsck fixed %d problems", fixed)
+			fmt.Printf("\n%s\n", msg)
+			if err := store.Commit(msg); err != nil {
+				return err
+			}
+		}
+
+		if remaining > 0 {
+			return fmt.Errorf("%d problems found", remaining)
+		}
+
+		if len(problems) == 0 {
+			fmt.Println("No problems found")
+		}
+
+	case dstask.CMD_MIGRATE:
+		store, ok := dstask.DefaultStore().(*dstask.GitStore)
+		if !ok {
+			return dstask.InvalidInput("%s is only available with the git store", cmdLine.Cmd)
+		}
+
+		dryRun := dstask.StrSliceContains(os.Args[2:], "--dry-run")
+
+		results, err := store.Migrate(dryRun)
+		if err != nil {
+			return err
+		}
+
+		if len(results) == 0 {
+			fmt.Printf("Already at data format version %d\n", dstask.FORMAT_VERSION)
+		}
+
+		if dryRun {
+			for _, result := range results {
+				fmt.Printf("Version %d: %s, %d tasks\n", result.Version, result.Description, len(result.Changed))
+				for _, path := range result.Changed {
+					fmt.Printf("    %s\n", path)
+				}
 			}
 		}
 
 	case dstask.CMD_IMPORT_TW:
-		ts := dstask.LoadTaskSetFromDisk(dstask.ALL_STATUSES)
-		ts.ImportFromTaskwarrior()
-		ts.SaveToDisk("Import from taskwarrior")
+		ts, err := loadTaskSet(dstask.ALL_STATUSES)
+		if err != nil {
+			return err
+		}
+
+		if err := ts.ImportFromTaskwarrior(os.Stdin); err != nil {
+			return err
+		}
+
+		if err := ts.SaveToDisk("Import from taskwarrior"); err != nil {
+			return err
+		}
+
+	case dstask.CMD_EXPORT_TW:
+		ts, err := loadTaskSet(dstask.ALL_STATUSES)
+		if err != nil {
+			return err
+		}
+
+		ts.Filter(context)
+		ts.Filter(cmdLine)
+		return ts.ExportToTaskwarrior(os.Stdout)
+
+	case dstask.CMD_IMPORT_TODOTXT:
+		ts, err := loadTaskSet(dstask.ALL_STATUSES)
+		if err != nil {
+			return err
+		}
+
+		counts, err := ts.ImportTodoTxt(os.Stdin)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("%d added, %d updated, %d unchanged\n", counts.Added, counts.Updated, counts.Unchanged)
+
+		if counts.Added+counts.Updated > 0 {
+			if err := ts.SaveToDisk("Import from todo.txt: %d added, %d updated", counts.Added, counts.Updated); err != nil {
+				return err
+			}
+		}
+
+	case dstask.CMD_EXPORT_TODOTXT:
+		ts, err := loadTaskSet(dstask.ALL_STATUSES)
+		if err != nil {
+			return err
+		}
+
+		ts.Filter(context)
+		ts.Filter(cmdLine)
+		// templates are not things to do, their instances are
+		ts.FilterOutStatus(dstask.STATUS_RECURRING)
+		return ts.ExportTodoTxt(os.Stdout)
+
+	case dstask.CMD_EXPORT_ICAL:
+		ts, err := loadTaskSet(dstask.ALL_STATUSES)
+		if err != nil {
+			return err
+		}
+
+		ts.Filter(context)
+		ts.Filter(cmdLine)
+		ts.FilterOutStatus(dstask.STATUS_RECURRING)
+		return ts.ExportICal(os.Stdout)
+
+	case dstask.CMD_EXPORT:
+		ts, err := loadTaskSet(dstask.ALL_STATUSES)
+		if err != nil {
+			return err
+		}
+
+		ts.Filter(context)
+		ts.Filter(cmdLine)
+
+		if cmdLine.Format == "" {
+			cmdLine.Format = dstask.OUTPUT_JSON
+		}
+		return ts.WriteTasks(cmdLine.Format)
+
+	case dstask.CMD_IMPORT:
+		ts, err := loadTaskSet(dstask.ALL_STATUSES)
+		if err != nil {
+			return err
+		}
+
+		counts, err := ts.ImportJSON(os.Stdin)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("%d added, %d updated, %d unchanged\n", counts.Added, counts.Updated, counts.Unchanged)
+
+		if counts.Added+counts.Updated > 0 {
+			if err := ts.SaveToDisk("Import: %d added, %d updated", counts.Added, counts.Updated); err != nil {
+				return err
+			}
+		}
 
 	case dstask.CMD_SHOW_PROJECTS:
-		context.PrintContextDescription()
-		ts := dstask.LoadTaskSetFromDisk(dstask.ALL_STATUSES)
-		cmdLine.MergeContext(context)
+		ts, err := loadTaskSet(dstask.ALL_STATUSES)
+		if err != nil {
+			return err
+		}
+
+		if err := cmdLine.MergeContext(context); err != nil {
+			return err
+		}
 		ts.Filter(context)
-		ts.DisplayProjects()
+		if cmdLine.Format != "" {
+			return ts.WriteProjects(cmdLine.Format)
+		}
+		context.PrintContextDescription()
+		return ts.DisplayProjects()
 
 	case dstask.CMD_SHOW_TAGS:
-		context.PrintContextDescription()
-		ts := dstask.LoadTaskSetFromDisk(dstask.NON_RESOLVED_STATUSES)
-		cmdLine.MergeContext(context)
+		ts, err := loadTaskSet(dstask.NON_RESOLVED_STATUSES)
+		if err != nil {
+			return err
+		}
+
+		if err := cmdLine.MergeContext(context); err != nil {
+			return err
+		}
 		ts.Filter(context)
+		if cmdLine.Format != "" {
+			return ts.WriteTags(cmdLine.Format)
+		}
+		context.PrintContextDescription()
 		for tag := range ts.GetTags() {
 			fmt.Println(tag)
 		}
 
 	case dstask.CMD_SHOW_RESOLVED:
-		ts := dstask.LoadTaskSetFromDisk(dstask.ALL_STATUSES)
+		ts, err := loadTaskSet(dstask.ALL_STATUSES)
+		if err != nil {
+			return err
+		}
+
 		ts.Filter(context)
 		ts.Filter(cmdLine)
 		ts.FilterByStatus(dstask.STATUS_RESOLVED)
 		ts.SortByResolved()
-		ts.DisplayByWeek()
+		if cmdLine.Format != "" {
+			return ts.WriteTasks(cmdLine.Format)
+		}
+		if err := ts.DisplayByWeek(); err != nil {
+			return err
+		}
 		context.PrintContextDescription()
 
+	case dstask.CMD_REPORT:
+		// the report name is not part of the filter
+		args := os.Args[1:]
+		i := 0
+		for i < len(args) && !strings.EqualFold(args[i], dstask.CMD_REPORT) {
+			i++
+		}
+		if i+1 >= len(args) || args[i+1] != dstask.REPORT_TIME {
+			return dstask.InvalidInput("Usage: dstask report time [filter] [since:<date>] [until:<date>]")
+		}
+
+		cmdLine = dstask.ParseCmdLine(append(args[:i+1:i+1], args[i+2:]...)...)
+		if err := cmdLine.Err(); err != nil {
+			return err
+		}
+
+		since, err := dstask.ParseSinceDate(cmdLine.Since, time.Now())
+		if err != nil {
+			return err
+		}
+
+		until, err := dstask.ParseDueDate(cmdLine.Until, time.Now())
+		if err != nil {
+			return err
+		}
+
+		ts, err := loadTaskSet(dstask.ALL_STATUSES)
+		if err != nil {
+			return err
+		}
+
+		ts.Filter(context)
+		ts.Filter(cmdLine)
+		context.PrintContextDescription()
+		return ts.DisplayTimeReport(since, until)
+
 	case dstask.CMD_HELP:
 		if len(os.Args) > 2 {
 			dstask.Help(os.Args[2])
@@ -342,10 +1404,16 @@ func main() {
 			dstask.CMD_STOP,
 			dstask.CMD_DONE,
 			dstask.CMD_RESOLVE,
+			dstask.CMD_DEFER,
+			dstask.CMD_DELEGATE,
 			dstask.CMD_CONTEXT,
 			dstask.CMD_MODIFY,
 		}, cmdLine.Cmd) {
-			ts := dstask.LoadTaskSetFromDisk(dstask.NON_RESOLVED_STATUSES)
+			ts, err := dstask.LoadTaskSetFromDisk(dstask.NON_RESOLVED_STATUSES)
+			if err != nil {
+				return err
+			}
+
 			// limit completions to available context, but not if the user is
 			// trying to change context, context ignore is on, or modify
 			// command is being completed
@@ -361,6 +1429,35 @@ func main() {
 			completions = append(completions, dstask.PRIORITY_NORMAL)
 			completions = append(completions, dstask.PRIORITY_LOW)
 
+			// due dates
+			for _, due := range []string{"today", "tomorrow", "eow", "eom"} {
+				completions = append(completions, "due:"+due)
+				completions = append(completions, "due.before:"+due)
+				completions = append(completions, "due.after:"+due)
+			}
+
+			if !dstask.StrSliceContains(dstask.TEXT_CMDS, cmdLine.Cmd) {
+				completions = append(completions, dstask.ALL_SELECTORS...)
+			}
+
+			if cmdLine.Cmd == dstask.CMD_DELEGATE {
+				completions = append(completions, ts.GetDelegatees()...)
+			}
+
+			if cmdLine.Cmd == dstask.CMD_DEFER {
+				for _, until := range []string{"tomorrow", "monday", "eow", "eom", "+1w", "+1m"} {
+					completions = append(completions, "until:"+until)
+				}
+			}
+
+			// recurrence rules
+			if cmdLine.Cmd == dstask.CMD_ADD || cmdLine.Cmd == dstask.CMD_MODIFY {
+				completions = append(completions, "recur:"+dstask.RECUR_DAILY)
+				completions = append(completions, "recur:"+dstask.RECUR_WEEKLY)
+				completions = append(completions, "recur:"+dstask.RECUR_MONTHLY)
+				completions = append(completions, "recur:"+dstask.RECUR_EVERY+":")
+			}
+
 			// projects
 			for project := range ts.GetProjects() {
 				completions = append(completions, "project:"+project)
@@ -384,4 +1481,6 @@ func main() {
 			}
 		}
 	}
+
+	return nil
 }
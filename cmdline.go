@@ -4,6 +4,7 @@ package dstask
 
 import (
 	"fmt"
+	"os"
 	"strconv"
 	"strings"
 )
@@ -19,10 +20,32 @@ type CmdLine struct {
 	AntiProjects  []string
 	Priority      string
 	Text          string
+	Recur         string
+	Due           string
+	DueBefore     string
+	DueAfter      string
+	Until         string
+	Since         string
+	Selectors     []string
 	IgnoreContext bool
 	IDsExhausted  bool
 	// any words after the note operator: /
 	Note string
+	// output format given with --format, or empty for a table. See output.go
+	Format string
+	// UUID prefixes given instead of IDs, by position in IDs. See ids.go
+	UUIDPrefixes map[int]string
+	// the filter as an expression, which the fields above are derived from.
+	// Nil if there is no filter, or in contexts saved before expressions.
+	Query *Query
+
+	// a filter that could not be parsed, see Err
+	err error
+}
+
+// the error parsing the filter, if any
+func (cmdLine CmdLine) Err() error {
+	return cmdLine.err
 }
 
 // reconstruct args string
@@ -30,8 +53,12 @@ func (cmdLine CmdLine) String() string {
 	var args []string
 	var annotatedTags []string
 
-	for _, id := range cmdLine.IDs {
-		args = append(args, strconv.Itoa(id))
+	for i, id := range cmdLine.IDs {
+		if prefix, ok := cmdLine.UUIDPrefixes[i]; ok {
+			args = append(args, prefix)
+		} else {
+			args = append(args, strconv.Itoa(id))
+		}
 	}
 
 	for _, tag := range cmdLine.Tags {
@@ -40,91 +67,217 @@ func (cmdLine CmdLine) String() string {
 	for _, tag := range cmdLine.AntiTags {
 		annotatedTags = append(annotatedTags, "-"+tag)
 	}
-	args = append(args, annotatedTags...)
 
-	if cmdLine.Project != "" {
-		args = append(args, "project:"+cmdLine.Project)
+	if cmdLine.Query != nil {
+		args = append(args, cmdLine.Query.String())
+	} else {
+		args = append(args, annotatedTags...)
+
+		if cmdLine.Project != "" {
+			args = append(args, "project:"+cmdLine.Project)
+		}
+
+		if cmdLine.Priority != "" {
+			args = append(args, cmdLine.Priority)
+		}
+
+		if cmdLine.Due != "" {
+			args = append(args, "due:"+cmdLine.Due)
+		}
+
+		if cmdLine.DueBefore != "" {
+			args = append(args, "due.before:"+cmdLine.DueBefore)
+		}
+
+		if cmdLine.DueAfter != "" {
+			args = append(args, "due.after:"+cmdLine.DueAfter)
+		}
+
+		args = append(args, cmdLine.Selectors...)
+
+		if cmdLine.Text != "" {
+			args = append(args, "\""+cmdLine.Text+"\"")
+		}
+	}
+
+	if cmdLine.Recur != "" {
+		args = append(args, "recur:"+cmdLine.Recur)
 	}
 
-	if cmdLine.Priority != "" {
-		args = append(args, cmdLine.Priority)
+	if cmdLine.Until != "" {
+		args = append(args, "until:"+cmdLine.Until)
 	}
 
-	if cmdLine.Text != "" {
-		args = append(args, "\""+cmdLine.Text+"\"")
+	if cmdLine.Since != "" {
+		args = append(args, "since:"+cmdLine.Since)
 	}
 
 	return strings.Join(args, " ")
 }
 
+// to stderr if stdout is not a terminal, so it is not mistaken for output
 func (cmdLine CmdLine) PrintContextDescription() {
-	if cmdLine.String() != "" {
+	if cmdLine.String() == "" {
+		return
+	}
+
+	if IsTTY() {
 		fmt.Printf("\033[33mActive context: %s\033[0m\n", cmdLine)
+	} else {
+		fmt.Fprintf(os.Stderr, "Active context: %s\n", cmdLine)
 	}
 }
 
+// set the field of a filter keyword, returning false if the word is not one,
+// or an error if it is one with an invalid value
+func (cmdLine *CmdLine) setFilterField(item string) (bool, error) {
+	lcItem := strings.ToLower(item)
+
+	if field, _, value, ok := splitDateTerm(lcItem); ok && field == "due" {
+		value = item[len(item)-len(value):]
+		if !IsValidDueDate(value) {
+			return true, InvalidInput("Invalid due date %q", value)
+		}
+	}
+
+	if strings.HasPrefix(lcItem, "project:") {
+		cmdLine.Project = lcItem[8:]
+	} else if strings.HasPrefix(lcItem, "due:") {
+		cmdLine.Due = item[4:]
+	} else if strings.HasPrefix(lcItem, "due.before:") {
+		cmdLine.DueBefore = item[11:]
+	} else if strings.HasPrefix(lcItem, "due.after:") {
+		cmdLine.DueAfter = item[10:]
+	} else if StrSliceContains(ALL_SELECTORS, lcItem) && !StrSliceContains(TEXT_CMDS, cmdLine.Cmd) {
+		cmdLine.Selectors = append(cmdLine.Selectors, lcItem)
+	} else if strings.HasPrefix(lcItem, "-project:") {
+		cmdLine.AntiProjects = append(cmdLine.AntiProjects, lcItem[9:])
+	} else if len(item) > 2 && lcItem[0:1] == "+" {
+		cmdLine.Tags = append(cmdLine.Tags, lcItem[1:])
+	} else if len(item) > 2 && lcItem[0:1] == "-" {
+		cmdLine.AntiTags = append(cmdLine.AntiTags, lcItem[1:])
+	} else if IsValidPriority(item) {
+		cmdLine.Priority = item
+	} else {
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// parse the command line, taking any word that looks like a UUID prefix as
+// one. See TaskSet.ParseCmdLine.
 func ParseCmdLine(args ...string) CmdLine {
-	var cmd string
-	var ids []int
-	var tags []string
-	var antiTags []string
-	var project string
-	var antiProjects []string
-	var priority string
+	return parseCmdLine(args, IsUUIDPrefix)
+}
+
+func parseCmdLine(args []string, isUUIDPrefix func(string) bool) CmdLine {
+	var cmdLine CmdLine
 	var words []string
 	var notesModeActivated bool
 	var notes []string
-	var ignoreContext bool
+	// filter words, for commands that take a filter. See query.go
+	var filter []string
 
 	// something other than an ID has been parsed -- accept no more IDs
 	var IDsExhausted bool
+	// --format given without =, so the next word is the format
+	var formatNext bool
+	var formatErr error
+	// an invalid value of a keyword of a command that takes text
+	var fieldErr error
 
 	for _, item := range args {
 		lcItem := strings.ToLower(item)
-		if !IDsExhausted && cmd == "" && StrSliceContains(ALL_CMDS, lcItem) {
-			cmd = lcItem
+
+		// anywhere, so it does not end the IDs
+		if formatNext {
+			cmdLine.Format = lcItem
+			formatNext = false
+			continue
+		} else if !notesModeActivated && !StrSliceContains(RAW_CMDS, cmdLine.Cmd) {
+			if lcItem == FORMAT_FLAG {
+				formatNext = true
+				continue
+			} else if strings.HasPrefix(lcItem, FORMAT_FLAG+"=") {
+				cmdLine.Format = lcItem[len(FORMAT_FLAG)+1:]
+				continue
+			}
+		}
+
+		if !IDsExhausted && cmdLine.Cmd == "" && StrSliceContains(ALL_CMDS, lcItem) {
+			cmdLine.Cmd = lcItem
 			continue
 		}
 
 		if s, err := strconv.ParseInt(item, 10, 64); !IDsExhausted && err == nil {
-			ids = append(ids, int(s))
+			cmdLine.IDs = append(cmdLine.IDs, int(s))
+			continue
+		}
+
+		// placeholder ID, resolved later with TaskSet.ResolveUUIDPrefixes
+		if !IDsExhausted && isUUIDPrefix(item) {
+			if cmdLine.UUIDPrefixes == nil {
+				cmdLine.UUIDPrefixes = make(map[int]string)
+			}
+			cmdLine.UUIDPrefixes[len(cmdLine.IDs)] = lcItem
+			cmdLine.IDs = append(cmdLine.IDs, 0)
 			continue
 		}
 
 		IDsExhausted = true
 
-		if strings.HasPrefix(lcItem, "project:") {
-			project = lcItem[8:]
-		} else if strings.HasPrefix(lcItem, "-project:") {
-			antiProjects = append(antiProjects, lcItem[9:])
-		} else if len(item) > 2 && lcItem[0:1] == "+" {
-			tags = append(tags, lcItem[1:])
-		} else if len(item) > 2 && lcItem[0:1] == "-" {
-			antiTags = append(antiTags, lcItem[1:])
-		} else if IsValidPriority(item) {
-			priority = item
+		if notesModeActivated {
+			// everything after the note operator is a note, even if it looks
+			// like a tag, eg a markdown list item
+			notes = append(notes, item)
+		} else if strings.HasPrefix(lcItem, "recur:") {
+			cmdLine.Recur = lcItem[6:]
+		} else if strings.HasPrefix(lcItem, "until:") && IsValidDueDate(item[6:]) {
+			cmdLine.Until = item[6:]
+		} else if strings.HasPrefix(lcItem, "since:") && IsValidDueDate(item[6:]) {
+			cmdLine.Since = item[6:]
 		} else if item == IGNORE_CONTEXT_KEYWORD {
-			ignoreContext = true
+			cmdLine.IgnoreContext = true
 		} else if item == NOTE_MODE_KEYWORD {
 			notesModeActivated = true
-		} else if notesModeActivated {
-			notes = append(notes, item)
-		} else {
+		} else if !StrSliceContains(TEXT_CMDS, cmdLine.Cmd) && !StrSliceContains(RAW_CMDS, cmdLine.Cmd) {
+			filter = append(filter, item)
+		} else if isField, err := cmdLine.setFilterField(item); err != nil {
+			fieldErr = err
+		} else if !isField {
 			words = append(words, item)
 		}
 	}
 
-	return CmdLine{
-		Cmd:           cmd,
-		IDs:           ids,
-		Tags:          tags,
-		AntiTags:      antiTags,
-		Project:       project,
-		AntiProjects:  antiProjects,
-		Priority:      priority,
-		Text:          strings.Join(words, " "),
-		Note:          strings.Join(notes, " "),
-		IgnoreContext: ignoreContext,
-		IDsExhausted:  IDsExhausted,
+	if formatNext {
+		formatErr = InvalidInput("Specify a format after %s", FORMAT_FLAG)
+	} else if cmdLine.Format != "" && !IsValidOutputFormat(cmdLine.Format) {
+		formatErr = InvalidInput("Invalid format %s, expected one of %s", cmdLine.Format, strings.Join(ALL_OUTPUT_FORMATS, ", "))
+	}
+
+	query, terms, err := ParseQuery(filter)
+	cmdLine.Query = query
+	cmdLine.err = err
+	if fieldErr != nil {
+		cmdLine.err = fieldErr
+	}
+	if formatErr != nil {
+		cmdLine.err = formatErr
+	}
+
+	for _, term := range terms {
+		if term.Text {
+			words = append(words, term.Term)
+		} else {
+			// validated by ParseQuery
+			cmdLine.setFilterField(term.Term)
+		}
 	}
+
+	cmdLine.Text = strings.Join(words, " ")
+	cmdLine.Note = strings.Join(notes, " ")
+	cmdLine.IDsExhausted = IDsExhausted
+
+	return cmdLine
 }
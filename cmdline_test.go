@@ -0,0 +1,46 @@
+package dstask
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseCmdLineDue(t *testing.T) {
+	tests := []struct {
+		args string
+		due  string
+		text string
+		err  string
+	}{
+		{args: "add foo due:tomorrow", due: "tomorrow", text: "foo"},
+		{args: "add foo due:2026-11-03@15:00", due: "2026-11-03@15:00", text: "foo"},
+		{args: "add foo due:tomorow", err: `Invalid due date "tomorow"`},
+		{args: "add foo due.before:someday", err: `Invalid due date "someday"`},
+		{args: "next due:eow", due: "eow"},
+		{args: "next due:Bogus", err: `Invalid due date "Bogus"`},
+		{args: "next due.after:bogus", err: `Invalid due date "bogus"`},
+		// after the note operator, text
+		{args: "add foo / due:later", text: "foo"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.args, func(t *testing.T) {
+			cmdLine := ParseCmdLine(strings.Fields(test.args)...)
+
+			if test.err != "" {
+				if err := cmdLine.Err(); err == nil || err.Error() != test.err {
+					t.Errorf("error %v, want %s", err, test.err)
+				}
+				return
+			}
+
+			if err := cmdLine.Err(); err != nil {
+				t.Fatal(err)
+			}
+
+			if cmdLine.Due != test.due || cmdLine.Text != test.text {
+				t.Errorf("due %q text %q, want due %q text %q", cmdLine.Due, cmdLine.Text, test.due, test.text)
+			}
+		})
+	}
+}
@@ -6,6 +6,23 @@ var (
 	GIT_REPO = "~/.dstask/"
 	// space delimited keyword file for compgen
 	CONTEXT_FILE = "~/.cache/dstask/context"
+	// cache of parsed task files, see index.go
+	INDEX_FILE = "~/.cache/dstask/index"
+	// single file database to use instead of GIT_REPO, if set
+	DB_FILE = ""
+	// remote and branch to sync with, if not the upstream of the current
+	// branch. See sync.go
+	SYNC_REMOTE = ""
+	SYNC_BRANCH = ""
+	// commit author, if not the user from git config
+	GIT_AUTHOR_NAME  = ""
+	GIT_AUTHOR_EMAIL = ""
+	// starting a task pauses the active one, so there is one clock. See
+	// timetrack.go
+	SINGLE_ACTIVE = false
+	// directory of an iCalendar feed rewritten when tasks change, if set. See
+	// ical.go
+	ICAL_DIR = ""
 	// for CI testing
 	FAKE_PTY = false
 )
@@ -17,34 +34,56 @@ const (
 	STATUS_DELEGATED = "delegated"
 	STATUS_DEFERRED  = "deferred"
 	STATUS_PAUSED    = "paused"
-	STATUS_RECURRING = "recurring" // tentative
-
-	CMD_NEXT          = "next"
-	CMD_ADD           = "add"
-	CMD_LOG           = "log"
-	CMD_START         = "start"
-	CMD_NOTE          = "note"
-	CMD_NOTES         = "notes"
-	CMD_STOP          = "stop"
-	CMD_DONE          = "done"
-	CMD_RESOLVE       = "resolve"
-	CMD_CONTEXT       = "context"
-	CMD_MODIFY        = "modify"
-	CMD_EDIT          = "edit"
-	CMD_UNDO          = "undo"
-	CMD_SYNC          = "sync"
-	CMD_OPEN          = "open"
-	CMD_GIT           = "git"
-	CMD_SHOW_NEXT     = "show-next"
-	CMD_SHOW_PROJECTS = "show-projects"
-	CMD_SHOW_TAGS     = "show-tags"
-	CMD_SHOW_ACTIVE   = "show-active"
-	CMD_SHOW_PAUSED   = "show-paused"
-	CMD_SHOW_OPEN     = "show-open"
-	CMD_SHOW_RESOLVED = "show-resolved"
-	CMD_COMPLETIONS   = "_completions"
-	CMD_IMPORT_TW     = "import-tw"
-	CMD_HELP          = "help"
+	STATUS_RECURRING = "recurring"
+
+	CMD_NEXT           = "next"
+	CMD_ADD            = "add"
+	CMD_LOG            = "log"
+	CMD_START          = "start"
+	CMD_NOTE           = "note"
+	CMD_NOTES          = "notes"
+	CMD_STOP           = "stop"
+	CMD_DONE           = "done"
+	CMD_DEFER          = "defer"
+	CMD_DELEGATE       = "delegate"
+	CMD_UNDELEGATE     = "undelegate"
+	CMD_SUBTASK        = "subtask"
+	CMD_DEPENDS        = "depends"
+	CMD_NODEPEND       = "nodepend"
+	CMD_RESOLVE        = "resolve"
+	CMD_CONTEXT        = "context"
+	CMD_MODIFY         = "modify"
+	CMD_EDIT           = "edit"
+	CMD_UNDO           = "undo"
+	CMD_REDO           = "redo"
+	CMD_HISTORY        = "history"
+	CMD_SYNC           = "sync"
+	CMD_OPEN           = "open"
+	CMD_GIT            = "git"
+	CMD_SHOW_NEXT      = "show-next"
+	CMD_SHOW_PROJECTS  = "show-projects"
+	CMD_SHOW_TAGS      = "show-tags"
+	CMD_SHOW_ACTIVE    = "show-active"
+	CMD_SHOW_PAUSED    = "show-paused"
+	CMD_SHOW_OPEN      = "show-open"
+	CMD_SHOW_RESOLVED  = "show-resolved"
+	CMD_SHOW_RECURRING = "show-recurring"
+	CMD_SHOW_DEFERRED  = "show-deferred"
+	CMD_SHOW_DELEGATED = "show-delegated"
+	CMD_COMPLETIONS    = "_completions"
+	CMD_IMPORT_TW      = "import-tw"
+	CMD_EXPORT_TW      = "export-tw"
+	CMD_IMPORT_TODOTXT = "import-todotxt"
+	CMD_EXPORT_TODOTXT = "export-todotxt"
+	CMD_EXPORT_ICAL    = "export-ical"
+	CMD_EXPORT         = "export"
+	CMD_IMPORT         = "import"
+	CMD_REINDEX        = "reindex"
+	CMD_FSCK           = "fsck"
+	CMD_MIGRATE        = "migrate"
+	CMD_MERGE_DRIVER   = "merge-driver"
+	CMD_REPORT         = "report"
+	CMD_HELP           = "help"
 
 	// filter: P1 P2 etc
 	PRIORITY_CRITICAL = "P0"
@@ -54,8 +93,30 @@ const (
 
 	MAX_TASKS_OPEN = 10000
 
+	// recurrence periods, see recur.go
+	RECUR_DAILY   = "daily"
+	RECUR_WEEKLY  = "weekly"
+	RECUR_MONTHLY = "monthly"
+	RECUR_EVERY   = "every"
+
+	// reports, see report.go
+	REPORT_TIME = "time"
+
+	// machine readable output formats, see output.go
+	OUTPUT_JSON     = "json"
+	OUTPUT_CSV      = "csv"
+	OUTPUT_TSV      = "tsv"
+	OUTPUT_YAML     = "yaml"
+	OUTPUT_MARKDOWN = "markdown"
+
+	// filter keywords that select tasks by derived state
+	SELECTOR_OVERDUE  = "overdue"
+	SELECTOR_BLOCKED  = "blocked"
+	SELECTOR_BLOCKING = "blocking"
+
 	IGNORE_CONTEXT_KEYWORD = "--"
 	NOTE_MODE_KEYWORD      = "/"
+	FORMAT_FLAG            = "--format"
 
 	// theme loosely based on https://github.com/GothenburgBitFactory/taskwarrior/blob/2.6.0/doc/rc/dark-256.theme
 	TABLE_MAX_WIDTH      = 160 // keep it readable
@@ -93,6 +154,21 @@ var VALID_STATUS_TRANSITIONS = [][]string{
 	[]string{STATUS_PENDING, STATUS_RESOLVED},
 	[]string{STATUS_PAUSED, STATUS_RESOLVED},
 	[]string{STATUS_ACTIVE, STATUS_RESOLVED},
+	// stop a recurring template
+	[]string{STATUS_RECURRING, STATUS_RESOLVED},
+	[]string{STATUS_PENDING, STATUS_DEFERRED},
+	[]string{STATUS_ACTIVE, STATUS_DEFERRED},
+	[]string{STATUS_PAUSED, STATUS_DEFERRED},
+	// woken up, either automatically or by starting the task early
+	[]string{STATUS_DEFERRED, STATUS_PENDING},
+	[]string{STATUS_DEFERRED, STATUS_ACTIVE},
+	[]string{STATUS_DEFERRED, STATUS_RESOLVED},
+	[]string{STATUS_PENDING, STATUS_DELEGATED},
+	[]string{STATUS_ACTIVE, STATUS_DELEGATED},
+	[]string{STATUS_PAUSED, STATUS_DELEGATED},
+	// taken back
+	[]string{STATUS_DELEGATED, STATUS_PENDING},
+	[]string{STATUS_DELEGATED, STATUS_RESOLVED},
 }
 
 // for most operations, it's not necessary or desirable to load the expensive resolved tasks
@@ -115,10 +191,18 @@ var ALL_CMDS = []string{
 	CMD_STOP,
 	CMD_DONE,
 	CMD_RESOLVE,
+	CMD_DEFER,
+	CMD_DELEGATE,
+	CMD_UNDELEGATE,
+	CMD_SUBTASK,
+	CMD_DEPENDS,
+	CMD_NODEPEND,
 	CMD_CONTEXT,
 	CMD_MODIFY,
 	CMD_EDIT,
 	CMD_UNDO,
+	CMD_REDO,
+	CMD_HISTORY,
 	CMD_SYNC,
 	CMD_OPEN,
 	CMD_GIT,
@@ -129,12 +213,92 @@ var ALL_CMDS = []string{
 	CMD_SHOW_PAUSED,
 	CMD_SHOW_OPEN,
 	CMD_SHOW_RESOLVED,
+	CMD_SHOW_RECURRING,
+	CMD_SHOW_DEFERRED,
+	CMD_SHOW_DELEGATED,
 	CMD_IMPORT_TW,
+	CMD_EXPORT_TW,
+	CMD_IMPORT_TODOTXT,
+	CMD_EXPORT_TODOTXT,
+	CMD_EXPORT_ICAL,
+	CMD_EXPORT,
+	CMD_IMPORT,
+	CMD_REINDEX,
+	CMD_FSCK,
+	CMD_MIGRATE,
+	CMD_MERGE_DRIVER,
+	CMD_REPORT,
 	CMD_COMPLETIONS,
 	CMD_HELP,
 }
 
-// Replaces default GIT_REPO and CONTEXT_FILE from env if set
+var ALL_SELECTORS = []string{
+	SELECTOR_OVERDUE,
+	SELECTOR_BLOCKED,
+	SELECTOR_BLOCKING,
+}
+
+// commands where any words are a task summary or note rather than a filter,
+// so selector keywords are kept as text
+var TEXT_CMDS = []string{
+	CMD_ADD,
+	CMD_LOG,
+	CMD_START,
+	CMD_STOP,
+	CMD_DONE,
+	CMD_RESOLVE,
+	CMD_DEFER,
+	CMD_DELEGATE,
+	CMD_UNDELEGATE,
+	CMD_SUBTASK,
+	CMD_NOTE,
+	CMD_NOTES,
+}
+
+var ALL_OUTPUT_FORMATS = []string{
+	OUTPUT_JSON,
+	OUTPUT_CSV,
+	OUTPUT_TSV,
+	OUTPUT_YAML,
+	OUTPUT_MARKDOWN,
+}
+
+// commands that only read tasks, so they take a shared lock on the store and
+// can run alongside each other
+var READ_ONLY_CMDS = []string{
+	"",
+	CMD_NEXT,
+	CMD_SHOW_NEXT,
+	CMD_SHOW_PROJECTS,
+	CMD_SHOW_TAGS,
+	CMD_SHOW_ACTIVE,
+	CMD_SHOW_PAUSED,
+	CMD_SHOW_OPEN,
+	CMD_SHOW_RESOLVED,
+	CMD_SHOW_RECURRING,
+	CMD_SHOW_DEFERRED,
+	CMD_SHOW_DELEGATED,
+	CMD_OPEN,
+	CMD_EXPORT_TW,
+	CMD_EXPORT_TODOTXT,
+	CMD_EXPORT_ICAL,
+	CMD_EXPORT,
+	CMD_REPORT,
+	CMD_COMPLETIONS,
+}
+
+// commands that take their arguments as given, so they are not parsed as a
+// filter, see query.go
+var RAW_CMDS = []string{
+	CMD_GIT,
+	CMD_MERGE_DRIVER,
+	CMD_COMPLETIONS,
+	CMD_HELP,
+}
+
+// Replaces default GIT_REPO, CONTEXT_FILE, INDEX_FILE, DB_FILE, SYNC_REMOTE,
+// SYNC_BRANCH, GIT_AUTHOR_NAME, GIT_AUTHOR_EMAIL, SINGLE_ACTIVE and ICAL_DIR
+// from env if set
 func LoadConfigFromEnv() {
 	_GIT_REPO := os.Getenv("DSTASK_GIT_REPO")
 
@@ -148,6 +312,52 @@ func LoadConfigFromEnv() {
 		CONTEXT_FILE = _CONTEXT_FILE
 	}
 
+	_INDEX_FILE := os.Getenv("DSTASK_INDEX_FILE")
+
+	if _INDEX_FILE != "" {
+		INDEX_FILE = _INDEX_FILE
+	}
+
+	_DB_FILE := os.Getenv("DSTASK_DB_FILE")
+
+	if _DB_FILE != "" {
+		DB_FILE = _DB_FILE
+	}
+
+	_SYNC_REMOTE := os.Getenv("DSTASK_SYNC_REMOTE")
+
+	if _SYNC_REMOTE != "" {
+		SYNC_REMOTE = _SYNC_REMOTE
+	}
+
+	_SYNC_BRANCH := os.Getenv("DSTASK_SYNC_BRANCH")
+
+	if _SYNC_BRANCH != "" {
+		SYNC_BRANCH = _SYNC_BRANCH
+	}
+
+	_GIT_AUTHOR_NAME := os.Getenv("DSTASK_GIT_AUTHOR_NAME")
+
+	if _GIT_AUTHOR_NAME != "" {
+		GIT_AUTHOR_NAME = _GIT_AUTHOR_NAME
+	}
+
+	_GIT_AUTHOR_EMAIL := os.Getenv("DSTASK_GIT_AUTHOR_EMAIL")
+
+	if _GIT_AUTHOR_EMAIL != "" {
+		GIT_AUTHOR_EMAIL = _GIT_AUTHOR_EMAIL
+	}
+
+	_ICAL_DIR := os.Getenv("DSTASK_ICAL_DIR")
+
+	if _ICAL_DIR != "" {
+		ICAL_DIR = _ICAL_DIR
+	}
+
+	if os.Getenv("DSTASK_SINGLE_ACTIVE") != "" {
+		SINGLE_ACTIVE = true
+	}
+
 	if os.Getenv("DSTASK_FAKE_PTY") != "" {
 		FAKE_PTY = true
 	}
@@ -0,0 +1,201 @@
+package dstask
+
+// parsing of human friendly dates for due: and friends. All dates are
+// interpreted in local time. A date without a time means the end of that day,
+// so a task due today is not overdue until tomorrow.
+
+// accepted forms:
+//   2026-11-03  2026-11-03T15:00  2026-11-03@15:00  15:00 (today)
+//   today  tomorrow  yesterday  eod  eow  eom  eoy
+//   monday  mon ... (next occurrence, not today)
+//   +3d  +2w  +1m  +1y  -1w ... (relative to today)
+//   any of the above with @<time>, eg tomorrow@9:30 or fri@3pm
+//   none (clear the date)
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+var weekdayLongNames = map[string]time.Weekday{
+	"sunday":    time.Sunday,
+	"monday":    time.Monday,
+	"tuesday":   time.Tuesday,
+	"wednesday": time.Wednesday,
+	"thursday":  time.Thursday,
+	"friday":    time.Friday,
+	"saturday":  time.Saturday,
+}
+
+func ParseDueDate(str string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, str); err == nil {
+		return t, nil
+	}
+
+	str = strings.ToLower(str)
+
+	if str == "" || str == "none" {
+		return time.Time{}, nil
+	}
+
+	var dayStr, timeStr string
+
+	if i := strings.Index(str, "@"); i >= 0 {
+		dayStr, timeStr = str[:i], str[i+1:]
+	} else if len(str) > 10 && str[10] == 't' {
+		// ISO 8601 without seconds or zone
+		dayStr, timeStr = str[:10], str[11:]
+	} else if strings.Contains(str, ":") || strings.HasSuffix(str, "am") || strings.HasSuffix(str, "pm") {
+		dayStr, timeStr = "today", str
+	} else {
+		dayStr = str
+	}
+
+	day, err := parseDay(dayStr, now)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if timeStr == "" {
+		return endOfDay(day), nil
+	}
+
+	hour, min, err := parseTimeOfDay(timeStr)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	// not day.Add, as days with a DST change are not 24 hours long
+	return time.Date(day.Year(), day.Month(), day.Day(), hour, min, 0, 0, day.Location()), nil
+}
+
+func IsValidDueDate(str string) bool {
+	_, err := ParseDueDate(str, time.Now())
+	return err == nil
+}
+
+// like ParseDueDate, for the start of a period. A date without a time means
+// the start of that day, and a weekday the last occurrence, today included,
+// so since:monday is this week.
+func ParseSinceDate(str string, now time.Time) (time.Time, error) {
+	lcStr := strings.ToLower(str)
+
+	wd, ok := weekdayLongNames[lcStr]
+	if !ok {
+		wd, ok = weekdayNames[lcStr]
+	}
+
+	if ok {
+		today := startOfDay(now)
+		return today.AddDate(0, 0, -((int(today.Weekday()) - int(wd) + 7) % 7)), nil
+	}
+
+	t, err := ParseDueDate(str, now)
+	if err != nil || t.IsZero() {
+		return t, err
+	}
+
+	if t.Equal(endOfDay(t)) {
+		return startOfDay(t), nil
+	}
+
+	return t, nil
+}
+
+// return the start of the given day
+func parseDay(str string, now time.Time) (time.Time, error) {
+	today := startOfDay(now)
+
+	switch str {
+	case "today", "eod":
+		return today, nil
+	case "tomorrow":
+		return today.AddDate(0, 0, 1), nil
+	case "yesterday":
+		return today.AddDate(0, 0, -1), nil
+	case "eow":
+		// weeks end on sunday
+		return today.AddDate(0, 0, (7-int(today.Weekday()))%7), nil
+	case "eom":
+		return time.Date(today.Year(), today.Month()+1, 0, 0, 0, 0, 0, today.Location()), nil
+	case "eoy":
+		return time.Date(today.Year(), time.December, 31, 0, 0, 0, 0, today.Location()), nil
+	}
+
+	wd, ok := weekdayLongNames[str]
+	if !ok {
+		wd, ok = weekdayNames[str]
+	}
+
+	if ok {
+		// next occurrence, not today
+		days := (int(wd)-int(today.Weekday())+6)%7 + 1
+		return today.AddDate(0, 0, days), nil
+	}
+
+	if (strings.HasPrefix(str, "+") || strings.HasPrefix(str, "-")) && len(str) > 2 {
+		n, err := strconv.Atoi(str[1 : len(str)-1])
+		if err != nil {
+			return time.Time{}, InvalidInput("Invalid relative date: %s", str)
+		}
+
+		if str[0] == '-' {
+			n = -n
+		}
+
+		switch str[len(str)-1] {
+		case 'd':
+			return today.AddDate(0, 0, n), nil
+		case 'w':
+			return today.AddDate(0, 0, 7*n), nil
+		case 'm':
+			return today.AddDate(0, n, 0), nil
+		case 'y':
+			return today.AddDate(n, 0, 0), nil
+		}
+
+		return time.Time{}, InvalidInput("Invalid relative date: %s", str)
+	}
+
+	t, err := time.ParseInLocation("2006-01-02", str, now.Location())
+	if err != nil {
+		return time.Time{}, InvalidInput("Invalid date: %s", str)
+	}
+
+	return t, nil
+}
+
+// return the hour and minute of 15:04, 3:04pm or 3pm
+func parseTimeOfDay(str string) (int, int, error) {
+	for _, layout := range []string{"15:04", "3:04pm", "3pm"} {
+		if t, err := time.Parse(layout, str); err == nil {
+			return t.Hour(), t.Minute(), nil
+		}
+	}
+
+	return 0, 0, InvalidInput("Invalid time: %s", str)
+}
+
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+func endOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 23, 59, 59, 0, t.Location())
+}
+
+// concise representation for tables, with time only if not the end of the day
+func FormatDue(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	t = t.Local()
+
+	if t.Equal(endOfDay(t)) {
+		return t.Format("Mon 2 Jan")
+	}
+
+	return t.Format("Mon 2 Jan 15:04")
+}
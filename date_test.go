@@ -0,0 +1,123 @@
+package dstask
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDueDate(t *testing.T) {
+	loc := time.FixedZone("test", 2*60*60)
+	// a Wednesday
+	now := time.Date(2026, 3, 4, 10, 0, 0, 0, loc)
+
+	at := func(month time.Month, day, hour, min, sec int) time.Time {
+		return time.Date(2026, month, day, hour, min, sec, 0, loc)
+	}
+
+	eod := func(month time.Month, day int) time.Time {
+		return at(month, day, 23, 59, 59)
+	}
+
+	tests := []struct {
+		str  string
+		want time.Time
+	}{
+		{"none", time.Time{}},
+		{"", time.Time{}},
+		{"2026-03-10", eod(3, 10)},
+		{"2026-03-10T15:00", at(3, 10, 15, 0, 0)},
+		{"2026-03-10@3pm", at(3, 10, 15, 0, 0)},
+		{"2026-03-10T15:00:00Z", time.Date(2026, 3, 10, 15, 0, 0, 0, time.UTC)},
+		{"15:30", at(3, 4, 15, 30, 0)},
+		{"9:15am", at(3, 4, 9, 15, 0)},
+		{"today", eod(3, 4)},
+		{"eod", eod(3, 4)},
+		{"tomorrow@9:30", at(3, 5, 9, 30, 0)},
+		{"yesterday", eod(3, 3)},
+		{"eow", eod(3, 8)},
+		{"eom", eod(3, 31)},
+		{"eoy", eod(12, 31)},
+		{"mon", eod(3, 9)},
+		{"Friday", eod(3, 6)},
+		// the next, not today
+		{"wednesday", eod(3, 11)},
+		{"fri@3pm", at(3, 6, 15, 0, 0)},
+		{"+3d", eod(3, 7)},
+		{"+2w", eod(3, 18)},
+		{"+1m", eod(4, 4)},
+		{"+1y", time.Date(2027, 3, 4, 23, 59, 59, 0, loc)},
+		{"-1w", eod(2, 25)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.str, func(t *testing.T) {
+			got, err := ParseDueDate(test.str, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !got.Equal(test.want) {
+				t.Errorf("parsed %s, want %s", got, test.want)
+			}
+		})
+	}
+
+	for _, str := range []string{"tomorow", "+3x", "+d", "+1.5d", "2026-13-01", "today@25:00", "tomorrow@noon", "soon"} {
+		if got, err := ParseDueDate(str, now); err == nil {
+			t.Errorf("%q parsed as %s, want an error", str, got)
+		}
+	}
+}
+
+func TestParseDueDateDST(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Skip("no time zone database:", err)
+	}
+
+	now := time.Date(2026, 3, 28, 10, 0, 0, 0, loc)
+
+	// clocks go forward at 1am, so 3pm is 14 hours after midnight
+	for str, want := range map[string]time.Time{
+		"tomorrow@15:00":   time.Date(2026, 3, 29, 15, 0, 0, 0, loc),
+		"2026-03-29T09:30": time.Date(2026, 3, 29, 9, 30, 0, 0, loc),
+		"2026-10-25@3pm":   time.Date(2026, 10, 25, 15, 0, 0, 0, loc),
+	} {
+		got, err := ParseDueDate(str, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !got.Equal(want) {
+			t.Errorf("%s parsed as %s, want %s", str, got, want)
+		}
+	}
+}
+
+func TestParseSinceDate(t *testing.T) {
+	// a Wednesday
+	now := time.Date(2026, 3, 4, 10, 0, 0, 0, time.Local)
+
+	tests := []struct {
+		str  string
+		want time.Time
+	}{
+		{"today", time.Date(2026, 3, 4, 0, 0, 0, 0, time.Local)},
+		{"2026-03-01", time.Date(2026, 3, 1, 0, 0, 0, 0, time.Local)},
+		{"yesterday@15:00", time.Date(2026, 3, 3, 15, 0, 0, 0, time.Local)},
+		// this week, today included
+		{"monday", time.Date(2026, 3, 2, 0, 0, 0, 0, time.Local)},
+		{"wed", time.Date(2026, 3, 4, 0, 0, 0, 0, time.Local)},
+	}
+
+	for _, test := range tests {
+		got, err := ParseSinceDate(test.str, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !got.Equal(test.want) {
+			t.Errorf("%s parsed as %s, want %s", test.str, got, test.want)
+		}
+	}
+}
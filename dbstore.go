@@ -0,0 +1,123 @@
+package dstask
+
+// a store that keeps every task in a single local file. Much faster than the
+// git store with many tasks, but there is no history or sync.
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+type DBStore struct {
+	Path string
+
+	// read on first use
+	tasks  map[string]Task
+	loaded bool
+	dirty  bool
+}
+
+func NewDBStore(path string) *DBStore {
+	return &DBStore{Path: path}
+}
+
+func (s *DBStore) read() error {
+	if s.loaded {
+		return nil
+	}
+
+	s.tasks = make(map[string]Task)
+	fp := MustExpandHome(s.Path)
+
+	file, err := os.Open(fp)
+	if os.IsNotExist(err) {
+		s.loaded = true
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("Failed to open %s for reading: %w", fp, err)
+	}
+	defer file.Close()
+
+	var tasks []Task
+	if err := gob.NewDecoder(file).Decode(&tasks); err != nil {
+		return &ParseError{Path: fp, Err: err}
+	}
+
+	for _, task := range tasks {
+		s.tasks[task.UUID] = task
+	}
+
+	s.loaded = true
+	return nil
+}
+
+func (s *DBStore) Load(statuses []string) ([]Task, error) {
+	if err := s.read(); err != nil {
+		return nil, err
+	}
+
+	return tasksWithStatuses(s.tasks, statuses), nil
+}
+
+func (s *DBStore) Save(task Task) error {
+	if err := s.read(); err != nil {
+		return err
+	}
+
+	task.WritePending = false
+	s.tasks[task.UUID] = task
+	s.dirty = true
+	return nil
+}
+
+func (s *DBStore) Delete(uuid string) error {
+	if err := s.read(); err != nil {
+		return err
+	}
+
+	delete(s.tasks, uuid)
+	s.dirty = true
+	return nil
+}
+
+// write the whole database atomically. The message is not recorded.
+func (s *DBStore) Commit(msg string) error {
+	if !s.dirty {
+		return nil
+	}
+
+	fp := MustExpandHome(s.Path)
+	if err := os.MkdirAll(filepath.Dir(fp), 0700); err != nil {
+		return fmt.Errorf("Failed to create directory for %s: %w", fp, err)
+	}
+
+	var tasks []Task
+	for _, task := range s.tasks {
+		tasks = append(tasks, task)
+	}
+	sortTasksByUUID(tasks)
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(tasks); err != nil {
+		return fmt.Errorf("Failed to encode %s: %w", fp, err)
+	}
+
+	if err := WriteFileAtomic(fp, buf.Bytes(), 0600); err != nil {
+		return fmt.Errorf("Failed to write %s: %w", fp, err)
+	}
+
+	s.dirty = false
+	return nil
+}
+
+func (s *DBStore) Lock(exclusive bool) (func(), error) {
+	fp := MustExpandHome(s.Path)
+	if err := os.MkdirAll(filepath.Dir(fp), 0700); err != nil {
+		return nil, fmt.Errorf("Failed to create directory for %s: %w", fp, err)
+	}
+
+	return LockFile(fp+".lock", exclusive)
+}
@@ -0,0 +1,27 @@
+package dstask
+
+// deferred tasks sleep in STATUS_DEFERRED until their wake-up time, after
+// which they return to pending.
+
+import "time"
+
+// move deferred tasks whose wake-up time has passed back to pending,
+// returning the tasks woken.
+func (ts *TaskSet) WakeDeferredTasks(now time.Time) ([]Task, error) {
+	var woken []Task
+
+	for _, task := range ts.tasks {
+		if task.Status != STATUS_DEFERRED || task.DeferredUntil.IsZero() || task.DeferredUntil.After(now) {
+			continue
+		}
+
+		t := *task
+		t.Status = STATUS_PENDING
+		if err := ts.UpdateTask(t); err != nil {
+			return woken, err
+		}
+		woken = append(woken, *task)
+	}
+
+	return woken, nil
+}
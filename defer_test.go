@@ -0,0 +1,70 @@
+package dstask
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWakeDeferredTasks(t *testing.T) {
+	now := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+
+	due := testTask(1, 1, now.AddDate(0, 0, -7))
+	due.Status = STATUS_DEFERRED
+	due.DeferredUntil = now.Add(-time.Minute)
+
+	// exactly now
+	dueNow := testTask(2, 2, now.AddDate(0, 0, -7))
+	dueNow.Status = STATUS_DEFERRED
+	dueNow.DeferredUntil = now
+
+	later := testTask(3, 3, now.AddDate(0, 0, -7))
+	later.Status = STATUS_DEFERRED
+	later.DeferredUntil = now.Add(time.Minute)
+
+	store := NewMemoryStore(due, dueNow, later)
+	ts, err := LoadTaskSet(store, NON_RESOLVED_STATUSES)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ts.Housekeep(now); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		testUUID(1): STATUS_PENDING,
+		testUUID(2): STATUS_PENDING,
+		testUUID(3): STATUS_DEFERRED,
+	}
+
+	for uuid, status := range want {
+		task := ts.tasksByUUID[uuid]
+
+		if task.Status != status {
+			t.Errorf("task %s is %s, want %s", uuid, task.Status, status)
+		}
+
+		if status == STATUS_PENDING && !task.DeferredUntil.IsZero() {
+			t.Errorf("woken task %s still deferred until %s", uuid, task.DeferredUntil)
+		}
+	}
+
+	if err := ts.SaveToDisk("Housekeeping"); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(store.Commits) != 1 || !strings.Contains(store.Commits[0], "\n\nWoke 1: task 1, 2: task 2") {
+		t.Errorf("commits %q, want the tasks woken", store.Commits)
+	}
+
+	// saved, so there is nothing more to wake
+	ts, err = LoadTaskSet(store, NON_RESOLVED_STATUSES)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if woken, err := ts.WakeDeferredTasks(now); err != nil || len(woken) != 0 {
+		t.Errorf("woke %v again, %v", woken, err)
+	}
+}
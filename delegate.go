@@ -0,0 +1,87 @@
+package dstask
+
+// delegated tasks are waiting on someone else. The hand-off and any take-back
+// are recorded in the notes.
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+func (task *Task) appendNote(note string) {
+	if task.Notes == "" {
+		task.Notes = note
+	} else {
+		task.Notes += "\n" + note
+	}
+}
+
+// hand the task over to the given person, with an optional note
+func (task *Task) Delegate(person, note string, now time.Time) {
+	task.Status = STATUS_DELEGATED
+	task.DelegatedTo = person
+	task.Delegated = now
+
+	line := fmt.Sprintf("Delegated to %s on %s", person, now.Format("Mon 2 Jan 2006"))
+	if note != "" {
+		line += ": " + note
+	}
+
+	task.appendNote(line)
+}
+
+// take back a delegated task, returning it to pending
+func (task *Task) Undelegate(note string, now time.Time) {
+	line := fmt.Sprintf("Taken back from %s on %s", task.DelegatedTo, now.Format("Mon 2 Jan 2006"))
+	if note != "" {
+		line += ": " + note
+	}
+
+	task.appendNote(line)
+	task.Status = STATUS_PENDING
+	task.DelegatedTo = ""
+	task.Delegated = time.Time{}
+}
+
+// people with delegated tasks, sorted
+func (ts *TaskSet) GetDelegatees() []string {
+	var people []string
+
+	for _, task := range ts.tasks {
+		if task.Status == STATUS_DELEGATED && !StrSliceContains(people, task.DelegatedTo) {
+			people = append(people, task.DelegatedTo)
+		}
+	}
+
+	sort.Strings(people)
+	return people
+}
+
+// human readable time elapsed, eg 3 days
+func FormatWaiting(since, now time.Time) string {
+	if since.IsZero() {
+		return "unknown"
+	}
+
+	d := now.Sub(since)
+
+	switch {
+	case d < time.Hour:
+		return "under an hour"
+	case d < 24*time.Hour:
+		return pluralise(int(d.Hours()), "hour")
+	case d < 14*24*time.Hour:
+		return pluralise(int(d.Hours()/24), "day")
+	default:
+		return pluralise(int(d.Hours()/24/7), "week")
+	}
+}
+
+func pluralise(n int, unit string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, unit)
+	}
+
+	return fmt.Sprintf("%d %ss", n, unit)
+}
@@ -0,0 +1,88 @@
+package dstask
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestDelegate(t *testing.T) {
+	monday := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	friday := monday.AddDate(0, 0, 4)
+
+	task := testTask(1, 1, monday)
+	task.Notes = "ring first"
+
+	ts, err := LoadTaskSet(NewMemoryStore(task), NON_RESOLVED_STATUSES)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	task.Delegate("alice", "she has the keys", monday)
+	if err := ts.UpdateTask(task); err != nil {
+		t.Fatal(err)
+	}
+
+	if task.Status != STATUS_DELEGATED || task.DelegatedTo != "alice" || !task.Delegated.Equal(monday) {
+		t.Errorf("delegated task is %s to %q since %s", task.Status, task.DelegatedTo, task.Delegated)
+	}
+
+	task.Undelegate("", friday)
+	if err := ts.UpdateTask(task); err != nil {
+		t.Fatal(err)
+	}
+
+	if task.Status != STATUS_PENDING || task.DelegatedTo != "" || !task.Delegated.IsZero() {
+		t.Errorf("taken back task is %s to %q since %s", task.Status, task.DelegatedTo, task.Delegated)
+	}
+
+	want := "ring first\nDelegated to alice on Mon 2 Mar 2026: she has the keys\nTaken back from alice on Fri 6 Mar 2026"
+	if task.Notes != want {
+		t.Errorf("notes %q, want %q", task.Notes, want)
+	}
+}
+
+func TestGetDelegatees(t *testing.T) {
+	day := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	var tasks []Task
+
+	for n, person := range []string{"bob", "alice", "bob", ""} {
+		task := testTask(n+1, n+1, day)
+		if person != "" {
+			task.Delegate(person, "", day)
+		}
+		tasks = append(tasks, task)
+	}
+
+	ts, err := LoadTaskSet(NewMemoryStore(tasks...), NON_RESOLVED_STATUSES)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := fmt.Sprint(ts.GetDelegatees()); got != "[alice bob]" {
+		t.Errorf("delegatees %s", got)
+	}
+}
+
+func TestFormatWaiting(t *testing.T) {
+	now := time.Date(2026, 3, 30, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		since time.Time
+		want  string
+	}{
+		{time.Time{}, "unknown"},
+		{now.Add(-59 * time.Minute), "under an hour"},
+		{now.Add(-time.Hour), "1 hour"},
+		{now.Add(-23 * time.Hour), "23 hours"},
+		{now.AddDate(0, 0, -1), "1 day"},
+		{now.AddDate(0, 0, -13), "13 days"},
+		{now.AddDate(0, 0, -14), "2 weeks"},
+	}
+
+	for _, test := range tests {
+		if got := FormatWaiting(test.since, now); got != test.want {
+			t.Errorf("waiting since %s formatted as %q, want %q", test.since, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package dstask
+
+// task dependencies. A task is blocked while any task it depends on is not
+// resolved. Dependencies that are not loaded are assumed resolved, as only
+// non-resolved tasks are normally loaded.
+
+import (
+	"fmt"
+)
+
+func (ts *TaskSet) IsBlocked(task *Task) bool {
+	for _, uuid := range task.Dependencies {
+		dep := ts.tasksByUUID[uuid]
+		if dep != nil && dep.Status != STATUS_RESOLVED {
+			return true
+		}
+	}
+
+	return false
+}
+
+// non-resolved tasks that depend on the given task
+func (ts *TaskSet) Dependents(task *Task) []*Task {
+	var dependents []*Task
+
+	for _, t := range ts.tasksByUUID {
+		if t.Status != STATUS_RESOLVED && StrSliceContains(t.Dependencies, task.UUID) {
+			dependents = append(dependents, t)
+		}
+	}
+
+	return dependents
+}
+
+func (ts *TaskSet) IsBlocking(task *Task) bool {
+	return task.Status != STATUS_RESOLVED && len(ts.Dependents(task)) > 0
+}
+
+// true if task a depends on task b, directly or indirectly
+func (ts *TaskSet) DependsOn(a, b string) bool {
+	seen := make(map[string]bool)
+	var visit func(uuid string) bool
+
+	visit = func(uuid string) bool {
+		if seen[uuid] {
+			return false
+		}
+		seen[uuid] = true
+
+		task := ts.tasksByUUID[uuid]
+		if task == nil {
+			return false
+		}
+
+		for _, dep := range task.Dependencies {
+			if dep == b || visit(dep) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	return visit(a)
+}
+
+// make task depend on dep, rejecting cycles
+func (ts *TaskSet) AddDependency(task *Task, dep Task) error {
+	if task.UUID == dep.UUID {
+		return InvalidInput("Task %v cannot depend on itself", task.ID)
+	}
+
+	if ts.DependsOn(dep.UUID, task.UUID) {
+		return InvalidInput("Task %v already depends on task %v, this would create a cycle", dep.ID, task.ID)
+	}
+
+	if !StrSliceContains(task.Dependencies, dep.UUID) {
+		task.Dependencies = append(task.Dependencies, dep.UUID)
+	}
+
+	return nil
+}
+
+func (task *Task) RemoveDependency(uuid string) bool {
+	for i, dep := range task.Dependencies {
+		if dep == uuid {
+			task.Dependencies = append(task.Dependencies[:i], task.Dependencies[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+// tasks that are no longer blocked now that the given task is resolved
+func (ts *TaskSet) UnblockedBy(task *Task) []*Task {
+	var unblocked []*Task
+
+	for _, t := range ts.Dependents(task) {
+		if !ts.IsBlocked(t) {
+			unblocked = append(unblocked, t)
+		}
+	}
+
+	return unblocked
+}
+
+// describe dependencies for display, by ID if loaded
+func (ts *TaskSet) DescribeDependencies(task *Task) []string {
+	var deps []string
+
+	for _, uuid := range task.Dependencies {
+		if dep := ts.tasksByUUID[uuid]; dep != nil {
+			deps = append(deps, fmt.Sprintf("%s (%s)", dep, dep.Status))
+		} else {
+			deps = append(deps, uuid)
+		}
+	}
+
+	return deps
+}
@@ -0,0 +1,77 @@
+package dstask
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestDependencies(t *testing.T) {
+	day := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+
+	ts, err := LoadTaskSet(NewMemoryStore(testTask(1, 1, day), testTask(2, 2, day), testTask(3, 3, day)), NON_RESOLVED_STATUSES)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// by UUID, as resolving a task removes its ID
+	task := func(n int) *Task {
+		return ts.tasksByUUID[testUUID(n)]
+	}
+
+	depend := func(id, on int) error {
+		t := *task(id)
+		if err := ts.AddDependency(&t, *task(on)); err != nil {
+			return err
+		}
+		return ts.UpdateTask(t)
+	}
+
+	// 3 on 2 on 1
+	for _, pair := range [][2]int{{2, 1}, {3, 2}, {3, 2}} {
+		if err := depend(pair[0], pair[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if deps := task(3).Dependencies; len(deps) != 1 {
+		t.Errorf("dependencies %v, want one", deps)
+	}
+
+	for _, pair := range [][2]int{{1, 1}, {1, 2}, {1, 3}} {
+		if err := depend(pair[0], pair[1]); err == nil {
+			t.Errorf("task %d made to depend on %d", pair[0], pair[1])
+		}
+	}
+
+	state := func() string {
+		var states []string
+		for id := 1; id <= 3; id++ {
+			states = append(states, fmt.Sprintf("%d:%t,%t", id, ts.IsBlocked(task(id)), ts.IsBlocking(task(id))))
+		}
+		return fmt.Sprint(states)
+	}
+
+	if got := state(); got != "[1:false,true 2:true,true 3:true,false]" {
+		t.Errorf("blocked and blocking %s", got)
+	}
+
+	first := *task(1)
+	first.Status = STATUS_RESOLVED
+	if err := ts.UpdateTask(first); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := fmt.Sprint(ts.UnblockedBy(task(1))); got != "[2: task 2]" {
+		t.Errorf("unblocked %s", got)
+	}
+
+	if got := state(); got != "[1:false,false 2:false,true 3:true,false]" {
+		t.Errorf("blocked and blocking %s after resolving", got)
+	}
+
+	second := *task(2)
+	if !second.RemoveDependency(first.UUID) || second.RemoveDependency(first.UUID) {
+		t.Errorf("dependency not removed once")
+	}
+}
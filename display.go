@@ -2,24 +2,30 @@ package dstask
 
 import (
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 )
 
 /// display list of filtered tasks with context and filter
-func (ts *TaskSet) DisplayByNext() {
+func (ts *TaskSet) DisplayByNext() error {
 	if ts.numTasksLoaded == 0 {
-		fmt.Println("\033[31mNo tasks found. Showing help.\033[0m")
+		if IsTTY() {
+			fmt.Println("\033[31mNo tasks found. Showing help.\033[0m")
+		} else {
+			fmt.Println("No tasks found. Showing help.")
+		}
 		Help("")
 	} else if len(ts.tasks) == 0 {
-		ExitFail("No matching tasks in given context or filter.")
+		return ErrNoMatchingTasks
 	} else if len(ts.tasks) == 1 {
-		ts.tasks[0].Display()
-		return
+		return ts.DisplayTask(ts.tasks[0])
 	} else {
 		var tasks []*Task
-		w, h := MustGetTermSize()
+		var showDue bool
+		var showProgress bool
+		w, h := TermSize()
 
 		h -= 8 // leave room for context message, header and prompt
 
@@ -29,43 +35,70 @@ func (ts *TaskSet) DisplayByNext() {
 			tasks = ts.tasks[:h]
 		}
 
-		table := NewTable(
-			w,
-			"ID",
-			"Priority",
-			"Tags",
-			"Project",
-			"Summary",
-		)
+		// only show due and progress columns if necessary
+		for _, t := range tasks {
+			if !t.Due.IsZero() {
+				showDue = true
+			}
+
+			if _, total := t.SubtaskProgress(); total > 0 {
+				showProgress = true
+			}
+		}
+
+		header := []string{"ID", "Priority", "Tags", "Project", "Summary"}
+		if showDue {
+			header = append(header, "Due")
+		}
+		if showProgress {
+			header = append(header, "Progress")
+		}
+
+		table := NewTable(w, header...)
 
 		for _, t := range tasks {
 			style := t.Style()
-			table.AddRow(
-				[]string{
-					// id should be at least 2 chars wide to match column header
-					// (headers can be truncated)
-					fmt.Sprintf("%-2d", t.ID),
-					t.Priority,
-					strings.Join(t.Tags, " "),
-					t.Project,
-					t.Summary,
-				},
-				style,
-			)
+			row := []string{
+				// id should be at least 2 chars wide to match column header
+				// (headers can be truncated)
+				fmt.Sprintf("%-2d", t.ID),
+				t.Priority,
+				strings.Join(t.Tags, " "),
+				t.Project,
+				t.Summary,
+			}
+
+			if showDue {
+				row = append(row, FormatDue(t.Due))
+			}
+
+			if showProgress {
+				var progress string
+				if resolved, total := t.SubtaskProgress(); total > 0 {
+					progress = fmt.Sprintf("%d/%d", resolved, total)
+				}
+				row = append(row, progress)
+			}
+
+			table.AddRow(row, style)
 		}
 
 		table.Render()
 
-		if h >= len(ts.tasks) {
+		if h >= len(ts.tasks) || h < 0 {
 			fmt.Printf("\n%v tasks.\n", len(ts.tasks))
 		} else {
 			fmt.Printf("\n%v tasks, truncated to %v lines.\n", len(ts.tasks), h)
 		}
 	}
+
+	return nil
 }
 
-func (task *Task) Display() {
-	w, _ := MustGetTermSize()
+// display a single task in detail. Dependencies are described using the
+// rest of the task set.
+func (ts *TaskSet) DisplayTask(task *Task) error {
+	w, _ := TermSize()
 
 	table := NewTable(
 		w,
@@ -77,6 +110,13 @@ func (task *Task) Display() {
 	table.AddRow([]string{"Priority", task.Priority}, RowStyle{})
 	table.AddRow([]string{"Summary", task.Summary}, RowStyle{})
 	table.AddRow([]string{"Notes", task.Notes}, RowStyle{})
+	for i, st := range task.AllSubtasks() {
+		var name string
+		if i == 0 {
+			name = "Subtasks"
+		}
+		table.AddRow([]string{name, fmt.Sprintf("%d %s", i+1, st)}, RowStyle{})
+	}
 	table.AddRow([]string{"Status", task.Status}, RowStyle{})
 	table.AddRow([]string{"Project", task.Project}, RowStyle{})
 	table.AddRow([]string{"Tags", strings.Join(task.Tags, ", ")}, RowStyle{})
@@ -88,7 +128,37 @@ func (task *Task) Display() {
 	if !task.Due.IsZero() {
 		table.AddRow([]string{"Due", task.Due.String()}, RowStyle{})
 	}
+	if len(task.WorkLog) > 0 {
+		table.AddRow([]string{"Worked", FormatDuration(task.TimeWorked(time.Now()))}, RowStyle{})
+	}
+	if task.DelegatedTo != "" {
+		table.AddRow([]string{"Delegated to", task.DelegatedTo}, RowStyle{})
+	}
+	if !task.DeferredUntil.IsZero() {
+		table.AddRow([]string{"Deferred until", task.DeferredUntil.String()}, RowStyle{})
+	}
+	if task.Recur != "" {
+		table.AddRow([]string{"Recur", task.Recur}, RowStyle{})
+	}
+	if task.Parent != "" {
+		table.AddRow([]string{"Parent", task.Parent}, RowStyle{})
+	}
+	for i, dep := range ts.DescribeDependencies(task) {
+		var name string
+		if i == 0 {
+			name = "Depends on"
+		}
+		table.AddRow([]string{name, dep}, RowStyle{})
+	}
+	for i, dependent := range ts.Dependents(task) {
+		var name string
+		if i == 0 {
+			name = "Blocking"
+		}
+		table.AddRow([]string{name, dependent.String()}, RowStyle{})
+	}
 	table.Render()
+	return nil
 }
 
 func (t *Task) Style() RowStyle {
@@ -98,7 +168,7 @@ func (t *Task) Style() RowStyle {
 	if t.Status == STATUS_ACTIVE {
 		style.Fg = FG_ACTIVE
 		style.Bg = BG_ACTIVE
-	} else if !t.Due.IsZero() && t.Due.Before(now) {
+	} else if t.IsOverdue(now) {
 		style.Fg = FG_PRIORITY_HIGH
 	} else if t.Priority == PRIORITY_CRITICAL {
 		style.Fg = FG_PRIORITY_CRITICAL
@@ -115,8 +185,8 @@ func (t *Task) Style() RowStyle {
 	return style
 }
 
-func (ts TaskSet) DisplayByWeek() {
-	w, _ := MustGetTermSize()
+func (ts TaskSet) DisplayByWeek() error {
+	w, _ := TermSize()
 
 	table := NewTable(
 		w,
@@ -166,13 +236,103 @@ func (ts TaskSet) DisplayByWeek() {
 
 	table.Render()
 	fmt.Printf("\n%v tasks.\n", len(ts.tasks))
+	return nil
+}
+
+// display deferred tasks with the time each wakes up
+func (ts TaskSet) DisplayDeferred() error {
+	if len(ts.tasks) == 0 {
+		return fmt.Errorf("%w: no deferred tasks", ErrNoMatchingTasks)
+	}
+
+	w, _ := TermSize()
+
+	table := NewTable(
+		w,
+		"ID",
+		"Priority",
+		"Tags",
+		"Project",
+		"Summary",
+		"Until",
+	)
+
+	for _, t := range ts.tasks {
+		until := FormatDue(t.DeferredUntil)
+		if until == "" {
+			until = "indefinitely"
+		}
+
+		table.AddRow(
+			[]string{
+				fmt.Sprintf("%-2d", t.ID),
+				t.Priority,
+				strings.Join(t.Tags, " "),
+				t.Project,
+				t.Summary,
+				until,
+			},
+			t.Style(),
+		)
+	}
+
+	table.Render()
+	fmt.Printf("\n%v tasks.\n", len(ts.tasks))
+	return nil
+}
+
+// display delegated tasks grouped by person, longest waiting first
+func (ts TaskSet) DisplayDelegated() error {
+	if len(ts.tasks) == 0 {
+		return fmt.Errorf("%w: no delegated tasks", ErrNoMatchingTasks)
+	}
+
+	now := time.Now()
+	w, _ := TermSize()
+
+	sort.SliceStable(ts.tasks, func(i, j int) bool { return ts.tasks[i].Delegated.Before(ts.tasks[j].Delegated) })
+
+	for _, person := range ts.GetDelegatees() {
+		fmt.Printf("\n> %s\n\n", person)
+
+		table := NewTable(
+			w,
+			"ID",
+			"Priority",
+			"Project",
+			"Summary",
+			"Waiting",
+		)
+
+		for _, t := range ts.tasks {
+			if t.DelegatedTo != person {
+				continue
+			}
+
+			table.AddRow(
+				[]string{
+					fmt.Sprintf("%-2d", t.ID),
+					t.Priority,
+					t.Project,
+					t.Summary,
+					FormatWaiting(t.Delegated, now),
+				},
+				t.Style(),
+			)
+		}
+
+		table.Render()
+	}
+
+	fmt.Printf("\n%v tasks.\n", len(ts.tasks))
+	return nil
 }
 
-func (ts TaskSet) DisplayProjects() {
+func (ts TaskSet) DisplayProjects() error {
 	var style RowStyle
 	projects := ts.GetProjects()
 
-	w, _ := MustGetTermSize()
+	w, _ := TermSize()
 	table := NewTable(
 		w,
 		"Created",
@@ -201,4 +361,5 @@ func (ts TaskSet) DisplayProjects() {
 	}
 
 	table.Render()
+	return nil
 }
@@ -0,0 +1,98 @@
+package dstask
+
+// errors returned by the library. Check with errors.Is or errors.As, as most
+// are wrapped with more detail. The dstask command maps these to exit codes.
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrTaskNotFound      = errors.New("Task not found")
+	ErrNoMatchingTasks   = errors.New("No matching tasks in given context or filter")
+	ErrInvalidTransition = errors.New("Invalid state transition")
+	ErrInvalidInput      = errors.New("Invalid input")
+	ErrRepoMissing       = errors.New("Could not find git repository")
+	ErrAborted           = errors.New("Aborted")
+	ErrLocked            = errors.New("Timed out waiting for another dstask process to finish")
+	ErrConflict          = errors.New("Tasks changed since")
+)
+
+// a task file that could not be parsed
+type ParseError struct {
+	Path string
+	// 1-based, zero if unknown
+	Line int
+	// content of the offending line
+	LineText string
+	Err      error
+}
+
+func (e *ParseError) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("Failed to parse %s: %s", e.Path, e.Err)
+	}
+
+	return fmt.Sprintf("Failed to parse %s line %d: %s\n    %s", e.Path, e.Line, e.Err, e.LineText)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+var yamlLineRegex = regexp.MustCompile(`line (\d+)`)
+
+// yaml.v2 errors mention the line number in the message only
+func newParseError(path string, data []byte, err error) *ParseError {
+	pe := &ParseError{
+		Path: path,
+		Err:  err,
+	}
+
+	if match := yamlLineRegex.FindStringSubmatch(err.Error()); match != nil {
+		pe.Line, _ = strconv.Atoi(match[1])
+		lines := strings.Split(string(data), "\n")
+
+		if pe.Line >= 1 && pe.Line <= len(lines) {
+			pe.LineText = lines[pe.Line-1]
+		}
+	}
+
+	return pe
+}
+
+// a git command that failed
+type GitError struct {
+	Args []string
+	Err  error
+}
+
+func (e *GitError) Error() string {
+	return fmt.Sprintf("git %s failed: %s", strings.Join(e.Args, " "), e.Err)
+}
+
+func (e *GitError) Unwrap() error {
+	return e.Err
+}
+
+// bad input from the user, matches ErrInvalidInput but keeps the message as
+// given
+type inputError struct {
+	msg string
+}
+
+func (e *inputError) Error() string {
+	return e.msg
+}
+
+func (e *inputError) Is(target error) bool {
+	return target == ErrInvalidInput
+}
+
+func InvalidInput(format string, a ...interface{}) error {
+	return &inputError{fmt.Sprintf(format, a...)}
+}
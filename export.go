@@ -0,0 +1,164 @@
+package dstask
+
+// export and import of tasks as JSON, in the format of --format json (see
+// output.go), for backups, bulk edits and moving tasks between repositories:
+//
+//   dstask export | jq '...' | dstask import
+//
+// Import merges by UUID. Tasks that exist are replaced by the imported
+// version, whatever its status, and others are added.
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+)
+
+type ImportCounts struct {
+	Added     int
+	Updated   int
+	Unchanged int
+}
+
+func timeOrZero(t *time.Time) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+
+	return *t
+}
+
+// the task of a record, as output by NewTaskRecord. The ID is not used, as
+// IDs are only meaningful in one repository.
+func (r TaskRecord) Task() Task {
+	task := Task{
+		UUID:          r.UUID,
+		Status:        r.Status,
+		Summary:       r.Summary,
+		Notes:         r.Notes,
+		Tags:          r.Tags,
+		Project:       r.Project,
+		Priority:      r.Priority,
+		DelegatedTo:   r.DelegatedTo,
+		Dependencies:  r.Dependencies,
+		Recur:         r.Recur,
+		RecurAnchor:   timeOrZero(r.RecurAnchor),
+		Parent:        r.Parent,
+		DeferredUntil: timeOrZero(r.DeferredUntil),
+		Delegated:     timeOrZero(r.Delegated),
+		Created:       timeOrZero(r.Created),
+		Resolved:      timeOrZero(r.Resolved),
+		Due:           timeOrZero(r.Due),
+		Modified:      timeOrZero(r.Modified),
+	}
+
+	// for records written by hand
+	if task.Status == "" {
+		task.Status = STATUS_PENDING
+	}
+
+	if task.Priority == "" {
+		task.Priority = PRIORITY_NORMAL
+	}
+
+	for _, st := range r.Subtasks {
+		task.Subtasks = append(task.Subtasks, SubTask{
+			Summary:  st.Summary,
+			Resolved: st.Resolved,
+		})
+	}
+
+	for _, interval := range r.WorkLog {
+		task.WorkLog = append(task.WorkLog, WorkInterval{
+			Start: interval.Start,
+			Stop:  timeOrZero(interval.Stop),
+		})
+	}
+
+	return task
+}
+
+// whether two versions of a task are the same, apart from the ID and when
+// they were saved
+func sameTaskContent(a, b *Task) bool {
+	ra, rb := NewTaskRecord(a), NewTaskRecord(b)
+	ra.ID, rb.ID = 0, 0
+	ra.Modified, rb.Modified = nil, nil
+
+	ja, _ := json.Marshal(ra)
+	jb, _ := json.Marshal(rb)
+	return string(ja) == string(jb)
+}
+
+// replace a task with another version, without the checks of UpdateTask, as
+// the version was made elsewhere. The ID is kept if the task is still open.
+func (ts *TaskSet) replaceTask(task Task) error {
+	task.Normalise()
+
+	if err := task.Validate(); err != nil {
+		return InvalidInput("%s, task %s", err, task.UUID)
+	}
+
+	old := ts.tasksByUUID[task.UUID]
+	task.ID = old.ID
+
+	if task.Status == STATUS_RESOLVED {
+		task.ID = 0
+	} else if task.ID == 0 {
+		task.ID = ts.freeID()
+	}
+
+	if old.ID > 0 && ts.tasksByID[old.ID] == old {
+		delete(ts.tasksByID, old.ID)
+	}
+
+	task.WritePending = true
+	*old = task
+	ts.tasksByID[task.ID] = old
+	return nil
+}
+
+// import tasks in the JSON format of export, merging by UUID
+func (ts *TaskSet) ImportJSON(r io.Reader) (ImportCounts, error) {
+	var counts ImportCounts
+	var records []TaskRecord
+
+	if err := json.NewDecoder(r).Decode(&records); err != nil {
+		return counts, InvalidInput("Failed to decode JSON from stdin: %s", err)
+	}
+
+	for _, record := range records {
+		task := record.Task()
+		task.Normalise()
+
+		existing := ts.tasksByUUID[task.UUID]
+
+		if existing == nil {
+			// keep the ID if it is free, as when restoring a backup
+			if record.ID > 0 && ts.tasksByID[record.ID] == nil && task.Status != STATUS_RESOLVED {
+				task.ID = record.ID
+			}
+
+			task.WritePending = true
+			if _, err := ts.AddTask(task); err != nil {
+				return counts, err
+			}
+
+			counts.Added++
+			continue
+		}
+
+		if sameTaskContent(existing, &task) {
+			counts.Unchanged++
+			continue
+		}
+
+		if err := ts.replaceTask(task); err != nil {
+			return counts, err
+		}
+
+		counts.Updated++
+	}
+
+	return counts, nil
+}
@@ -0,0 +1,112 @@
+package dstask
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func exportTasks() []Task {
+	day := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+
+	active := testTask(1, 4, day)
+	active.Status = STATUS_ACTIVE
+	active.Notes = "ring first"
+	active.Tags = []string{"phone"}
+	active.Subtasks = []SubTask{{Summary: "find the number", Resolved: true}}
+	active.WorkLog = []WorkInterval{{Start: day, Stop: day.Add(time.Hour)}, {Start: day.Add(2 * time.Hour)}}
+	active.Due = day.AddDate(0, 0, 3)
+
+	delegated := testTask(2, 5, day)
+	delegated.Delegate("alice", "", day)
+	delegated.Dependencies = []string{testUUID(1)}
+
+	resolved := testTask(3, 0, day)
+	resolved.Status = STATUS_RESOLVED
+	resolved.Resolved = day.Add(time.Hour)
+
+	return []Task{active, delegated, resolved}
+}
+
+func TestImportJSON(t *testing.T) {
+	exported, err := LoadTaskSet(NewMemoryStore(exportTasks()...), ALL_STATUSES)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := captureStdout(t, func() error { return exported.WriteTasks(OUTPUT_JSON) })
+
+	changed := exportTasks()
+	changed[0].Summary = "Call the bank"
+
+	tests := []struct {
+		name     string
+		existing []Task
+		want     ImportCounts
+	}{
+		{"into the same tasks", exportTasks(), ImportCounts{Unchanged: 3}},
+		{"into no tasks", nil, ImportCounts{Added: 3}},
+		{"into changed tasks", changed, ImportCounts{Updated: 1, Unchanged: 2}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ts, err := LoadTaskSet(NewMemoryStore(test.existing...), ALL_STATUSES)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			counts, err := ts.ImportJSON(strings.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if counts != test.want {
+				t.Errorf("counts %+v, want %+v", counts, test.want)
+			}
+
+			for _, want := range exported.Tasks() {
+				got := ts.tasksByUUID[want.UUID]
+				if got == nil || !sameTaskContent(got, want) {
+					t.Errorf("imported %+v, want %+v", got, want)
+					continue
+				}
+
+				// kept, as they were free
+				if got.ID != want.ID {
+					t.Errorf("task %s imported with ID %d, want %d", want.UUID, got.ID, want.ID)
+				}
+			}
+		})
+	}
+}
+
+func TestImportJSONRecords(t *testing.T) {
+	day := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+
+	ts, err := LoadTaskSet(NewMemoryStore(testTask(1, 1, day)), ALL_STATUSES)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// written by hand, with an ID already taken
+	counts, err := ts.ImportJSON(strings.NewReader(`[{"id": 1, "uuid": "` + testUUID(2) + `", "summary": "Fix the gate"}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	task := ts.tasksByUUID[testUUID(2)]
+	if counts.Added != 1 || task == nil {
+		t.Fatalf("counts %+v", counts)
+	}
+
+	if task.Status != STATUS_PENDING || task.Priority != PRIORITY_NORMAL || task.ID != 2 {
+		t.Errorf("imported as %s %s with ID %d", task.Status, task.Priority, task.ID)
+	}
+
+	for _, data := range []string{`{"uuid": 1}`, `[{"uuid": "` + testUUID(3) + `", "status": "sleeping"}]`} {
+		if _, err := ts.ImportJSON(strings.NewReader(data)); err == nil {
+			t.Errorf("imported %s", data)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package dstask
 
-// an interface to the filesystem/git based database -- loading, saving, committing
+// the filesystem/git based store -- loading, saving, committing. Also the
+// context file.
 
 import (
 	"fmt"
@@ -9,41 +10,70 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"time"
 )
 
+// tasks as one YAML file per task in a directory per status, in a git
+// repository. Each commit is a git commit.
+type GitStore struct {
+	Repo string
+	// cache of parsed tasks, see index.go. Empty to disable.
+	IndexFile string
+}
+
+func NewGitStore(repo, indexFile string) *GitStore {
+	return &GitStore{
+		Repo:      repo,
+		IndexFile: indexFile,
+	}
+}
+
 // leave file as an empty string to return directory
-func MustGetRepoPath(directory, file string) string {
-	root := MustExpandHome(GIT_REPO)
+func (s *GitStore) GetRepoPath(directory, file string) (string, error) {
+	root := MustExpandHome(s.Repo)
 	dir := path.Join(root, directory)
 
 	if _, err := os.Stat(dir); os.IsNotExist(err) {
 		err = os.Mkdir(dir, 0700)
 		if err != nil {
-			ExitFail("Failed to create directory in git repository")
+			return "", fmt.Errorf("Failed to create directory in git repository: %w", err)
 		}
 	}
 
-	return path.Join(dir, file)
+	return path.Join(dir, file), nil
 }
 
-func LoadTaskSetFromDisk(statuses []string) *TaskSet {
-	ts := &TaskSet{
-		tasksByID:   make(map[int]*Task),
-		tasksByUUID: make(map[string]*Task),
-	}
+func (s *GitStore) Load(statuses []string) ([]Task, error) {
+	var tasks []Task
+	now := time.Now()
+	seen := make(map[string]bool)
+	// position in tasks and modification time of each uuid, to resolve
+	// duplicates left by an interrupted save
+	byUUID := make(map[string]int)
+	modTimes := make(map[string]time.Time)
+	index := loadTaskIndex(s.IndexFile, MustExpandHome(s.Repo))
 
-	gitDotGitLocation := MustExpandHome(path.Join(GIT_REPO, ".git"))
+	gitDotGitLocation := MustExpandHome(path.Join(s.Repo, ".git"))
 
 	if _, err := os.Stat(gitDotGitLocation); os.IsNotExist(err) {
-		ExitFail("Could not find git repository at " + GIT_REPO + ", please clone or create. Try `dstask help` for more information.")
+		return nil, fmt.Errorf("%w at %s, please clone or create. Try `dstask help` for more information.", ErrRepoMissing, s.Repo)
+	}
+
+	// an older repository is upgraded in memory, see migrate.go
+	migrations, err := s.loadMigrations()
+	if err != nil {
+		return nil, err
 	}
 
 	for _, status := range statuses {
-		dir := MustGetRepoPath(status, "")
+		dir, err := s.GetRepoPath(status, "")
+		if err != nil {
+			return nil, err
+		}
 
 		files, err := ioutil.ReadDir(dir)
 		if err != nil {
-			ExitFail("Failed to read " + dir)
+			return nil, fmt.Errorf("Failed to read %s: %w", dir, err)
 		}
 
 		for _, file := range files {
@@ -60,105 +90,161 @@ func LoadTaskSetFromDisk(statuses []string) *TaskSet {
 				continue
 			}
 
-			t := Task{
-				UUID:   uuid,
-				Status: status,
+			relPath := path.Join(status, file.Name())
+			seen[relPath] = true
+
+			t, ok := index.get(relPath, file)
+			if !ok {
+				t = Task{
+					UUID:   uuid,
+					Status: status,
+				}
+
+				data, err := ioutil.ReadFile(filepath)
+				if err != nil {
+					return nil, fmt.Errorf("Failed to read %s: %w", filepath, err)
+				}
+				if len(migrations) > 0 {
+					migrated, err := migrateTaskData(data, status, migrations)
+					if err != nil {
+						return nil, newParseError(filepath, data, err)
+					}
+					data = migrated
+				}
+				err = yaml.Unmarshal(data, &t)
+				if err != nil {
+					return nil, newParseError(filepath, data, err)
+				}
+
+				index.put(relPath, file, t, now)
 			}
 
-			data, err := ioutil.ReadFile(filepath)
-			if err != nil {
-				ExitFail("Failed to read %s", filepath)
-			}
-			err = yaml.Unmarshal(data, &t)
-			if err != nil {
-				// TODO present error to user, specific error message is important
-				ExitFail("Failed to unmarshal %s", filepath)
+			if i, ok := byUUID[uuid]; ok {
+				if file.ModTime().After(modTimes[uuid]) {
+					tasks[i] = t
+					modTimes[uuid] = file.ModTime()
+				}
+				continue
 			}
 
-			ts.AddTask(t)
+			byUUID[uuid] = len(tasks)
+			modTimes[uuid] = file.ModTime()
+			tasks = append(tasks, t)
 		}
 	}
 
-	return ts
+	index.prune(statuses, seen)
+
+	// the index is only a cache, so failing to write it is not fatal
+	index.save(s.IndexFile)
+
+	return tasks, nil
 }
 
-func (t *Task) SaveToDisk() {
-	if !t.WritePending {
-		return
+func (s *GitStore) Save(t Task) error {
+	filepath, err := s.GetRepoPath(t.Status, t.UUID+".yml")
+	if err != nil {
+		return err
 	}
 
-	// save should be idempotent
-	t.WritePending = false
-
-	filepath := MustGetRepoPath(t.Status, t.UUID+".yml")
 	d, err := yaml.Marshal(&t)
 	if err != nil {
-		// TODO present error to user, specific error message is important
-		ExitFail("Failed to marshal task %s", t)
+		return fmt.Errorf("Failed to marshal task %s: %w", t, err)
 	}
 
-	err = ioutil.WriteFile(filepath, d, 0600)
+	err = WriteFileAtomic(filepath, d, 0600)
 	if err != nil {
-		ExitFail("Failed to write task %s", t)
+		return fmt.Errorf("Failed to write task %s: %w", t, err)
 	}
 
 	// delete from all other locations to make sure there is only one copy
-	// that exists
+	// that exists. If interrupted before this, Load picks the newest copy.
+	return s.remove(t.UUID, t.Status)
+}
+
+func (s *GitStore) Delete(uuid string) error {
+	return s.remove(uuid, "")
+}
+
+// remove the task file from every status directory except the given one
+func (s *GitStore) remove(uuid, except string) error {
 	for _, st := range ALL_STATUSES {
-		if st == t.Status {
+		if st == except {
 			continue
 		}
 
-		filepath := MustGetRepoPath(st, t.UUID+".yml")
+		filepath, err := s.GetRepoPath(st, uuid+".yml")
+		if err != nil {
+			return err
+		}
 
 		if _, err := os.Stat(filepath); !os.IsNotExist(err) {
 			err := os.Remove(filepath)
 			if err != nil {
-				ExitFail("Failed to delete " + filepath)
+				return fmt.Errorf("Failed to delete %s: %w", filepath, err)
 			}
 		}
 	}
+
+	return nil
+}
+
+// the lock file is inside .git so it is never committed
+func (s *GitStore) Lock(exclusive bool) (func(), error) {
+	gitDotGitLocation := MustExpandHome(path.Join(s.Repo, ".git"))
+
+	if _, err := os.Stat(gitDotGitLocation); os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w at %s, please clone or create. Try `dstask help` for more information.", ErrRepoMissing, s.Repo)
+	}
+
+	return LockFile(path.Join(gitDotGitLocation, "dstask.lock"), exclusive)
 }
 
-// may be removed
-func (ts *TaskSet) SaveToDisk(format string, a ...interface{}) {
-	for _, task := range ts.tasks {
-		task.SaveToDisk()
+func (s *GitStore) Commit(msg string) error {
+	repo, err := s.openRepo()
+	if err != nil {
+		return err
 	}
 
-	commitMsg := fmt.Sprintf(format, a...)
+	// a new repository starts at the current format version
+	if !s.hasCommits() {
+		if err := s.setFormatVersion(FORMAT_VERSION); err != nil {
+			return err
+		}
+	}
 
 	// git add all changed/created files
 	// could optimise this to be given an explicit list of
 	// added/modified/deleted files -- only if slow.
-	fmt.Printf("\n%s\n", commitMsg)
-	fmt.Printf("\033[38;5;245m")
-	MustRunGitCmd("add", ".")
-	MustRunGitCmd("commit", "--no-gpg-sign", "-m", commitMsg)
-	fmt.Printf("\033[0m")
+	changed, err := stageAll(repo)
+	if err != nil || !changed {
+		return err
+	}
+
+	return s.commit(repo, msg)
 }
 
-func SaveContext(context CmdLine) {
+func SaveContext(context CmdLine) error {
 	if len(context.IDs) != 0 {
-		ExitFail("Context cannot contain IDs")
+		return InvalidInput("Context cannot contain IDs")
 	}
 
 	if context.Text != "" {
-		ExitFail("Context cannot contain text")
+		return InvalidInput("Context cannot contain text")
 	}
 
 	fp := MustExpandHome(CONTEXT_FILE)
 	os.MkdirAll(filepath.Dir(fp), os.ModePerm)
-	MustWriteGob(fp, &context)
+	return WriteGob(fp, &context)
 }
 
-func LoadContext() CmdLine {
+func LoadContext() (CmdLine, error) {
 	fp := MustExpandHome(CONTEXT_FILE)
 	if _, err := os.Stat(fp); os.IsNotExist(err) {
-		return CmdLine{}
+		return CmdLine{}, nil
 	}
 
 	context := CmdLine{}
-	MustReadGob(fp, &context)
-	return context
+	err := ReadGob(fp, &context)
+	return context, err
 }
@@ -0,0 +1,46 @@
+package dstask
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	git "gopkg.in/src-d/go-git.v4"
+)
+
+// a git store in a new temporary repository, and a function to remove it
+func newTestGitStore(t *testing.T) (*GitStore, func()) {
+	dir, err := ioutil.TempDir("", "dstask-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := git.PlainInit(dir, false); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	store := NewGitStore(dir, filepath.Join(dir, ".git", "dstask-index"))
+	return store, func() { os.RemoveAll(dir) }
+}
+
+// the message of the last commit of the store
+func lastCommitMessage(t *testing.T, store *GitStore) string {
+	repo, err := store.openRepo()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return commit.Message
+}
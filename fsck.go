@@ -0,0 +1,265 @@
+package dstask
+
+// integrity checks for the git store, with optional repairs. Works on the
+// files directly, as a damaged repository may not load as a TaskSet.
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// unloadable files are moved here by fsck --fix rather than deleted
+const LOST_AND_FOUND_DIR = "lost+found"
+
+type Problem struct {
+	// relative to the repository
+	Path        string
+	Description string
+	// nil if the problem must be repaired by hand
+	fix func() error
+}
+
+func (p Problem) Fixable() bool {
+	return p.fix != nil
+}
+
+func (p Problem) Fix() error {
+	if p.fix == nil {
+		return InvalidInput("%s: cannot be fixed automatically", p.Path)
+	}
+
+	return p.fix()
+}
+
+// a task file as found on disk
+type fsckFile struct {
+	store   *GitStore
+	relPath string
+	modTime time.Time
+	task    Task
+}
+
+func (f *fsckFile) abs() string {
+	return path.Join(MustExpandHome(f.store.Repo), f.relPath)
+}
+
+func (f *fsckFile) write() error {
+	d, err := yaml.Marshal(&f.task)
+	if err != nil {
+		return fmt.Errorf("Failed to marshal task %s: %w", f.task, err)
+	}
+
+	return WriteFileAtomic(f.abs(), d, 0600)
+}
+
+// move a file out of the status directories so it is no longer loaded
+func (s *GitStore) moveToLostAndFound(relPath string) error {
+	dir, err := s.GetRepoPath(LOST_AND_FOUND_DIR, "")
+	if err != nil {
+		return err
+	}
+
+	src := path.Join(MustExpandHome(s.Repo), relPath)
+	dst := path.Join(dir, strings.Replace(relPath, "/", "-", -1))
+	return os.Rename(src, dst)
+}
+
+// check the whole repository, returning the problems found
+func (s *GitStore) Fsck() ([]Problem, error) {
+	var problems []Problem
+	var files []*fsckFile
+
+	gitDotGitLocation := MustExpandHome(path.Join(s.Repo, ".git"))
+
+	if _, err := os.Stat(gitDotGitLocation); os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w at %s, please clone or create. Try `dstask help` for more information.", ErrRepoMissing, s.Repo)
+	}
+
+	// read everything, reporting files that cannot be loaded
+	for _, status := range ALL_STATUSES {
+		dir, err := s.GetRepoPath(status, "")
+		if err != nil {
+			return nil, err
+		}
+
+		entries, err := ioutil.ReadDir(dir)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read %s: %w", dir, err)
+		}
+
+		for _, entry := range entries {
+			name := entry.Name()
+			relPath := path.Join(status, name)
+
+			if entry.IsDir() {
+				problems = append(problems, Problem{Path: relPath, Description: "unexpected directory"})
+				continue
+			}
+
+			if isAtomicTempFile(name) {
+				problems = append(problems, Problem{
+					Path:        relPath,
+					Description: "leftover temporary file",
+					fix:         func() error { return os.Remove(path.Join(dir, name)) },
+				})
+				continue
+			}
+
+			if len(name) != 40 || !strings.HasSuffix(name, ".yml") || !IsValidUUID4String(name[:36]) {
+				problems = append(problems, Problem{
+					Path:        relPath,
+					Description: "file name is not <uuid4>.yml, so it is ignored",
+					fix:         func() error { return s.moveToLostAndFound(relPath) },
+				})
+				continue
+			}
+
+			f := &fsckFile{
+				store:   s,
+				relPath: relPath,
+				modTime: entry.ModTime(),
+				task: Task{
+					UUID:   name[:36],
+					Status: status,
+				},
+			}
+
+			data, err := ioutil.ReadFile(f.abs())
+			if err != nil {
+				return nil, fmt.Errorf("Failed to read %s: %w", f.abs(), err)
+			}
+
+			if err := yaml.Unmarshal(data, &f.task); err != nil {
+				pe := newParseError(relPath, data, err)
+				description := "malformed YAML: " + pe.Err.Error()
+				if pe.LineText != "" {
+					description += fmt.Sprintf(" (%q)", strings.TrimSpace(pe.LineText))
+				}
+
+				problems = append(problems, Problem{
+					Path:        relPath,
+					Description: description,
+					fix:         func() error { return s.moveToLostAndFound(relPath) },
+				})
+				continue
+			}
+
+			files = append(files, f)
+		}
+	}
+
+	// the newest copy of a task wins, as with Load
+	sort.SliceStable(files, func(i, j int) bool { return files[i].modTime.After(files[j].modTime) })
+	byUUID := make(map[string]*fsckFile)
+	var tasks []*fsckFile
+
+	for _, f := range files {
+		if newest := byUUID[f.task.UUID]; newest != nil {
+			f := f
+			problems = append(problems, Problem{
+				Path:        f.relPath,
+				Description: fmt.Sprintf("duplicate of newer %s", newest.relPath),
+				fix:         func() error { return os.Remove(f.abs()) },
+			})
+			continue
+		}
+
+		byUUID[f.task.UUID] = f
+		tasks = append(tasks, f)
+	}
+
+	sort.SliceStable(tasks, func(i, j int) bool { return tasks[i].task.Created.Before(tasks[j].task.Created) })
+	usedIDs := make(map[int]*fsckFile)
+
+	for _, f := range tasks {
+		f := f
+		t := &f.task
+
+		var dangling []string
+		for _, uuid := range t.Dependencies {
+			if byUUID[uuid] == nil || uuid == t.UUID {
+				dangling = append(dangling, uuid)
+			}
+		}
+
+		if len(dangling) > 0 {
+			problems = append(problems, Problem{
+				Path:        f.relPath,
+				Description: "depends on missing tasks " + strings.Join(dangling, ", "),
+				fix: func() error {
+					for _, uuid := range dangling {
+						t.RemoveDependency(uuid)
+					}
+					return f.write()
+				},
+			})
+		}
+
+		if t.Priority != "" && !IsValidPriority(t.Priority) {
+			problems = append(problems, Problem{
+				Path:        f.relPath,
+				Description: fmt.Sprintf("invalid priority %q", t.Priority),
+				fix: func() error {
+					t.Priority = PRIORITY_NORMAL
+					return f.write()
+				},
+			})
+		}
+
+		if t.Status == STATUS_RESOLVED && t.Resolved.IsZero() {
+			problems = append(problems, Problem{
+				Path:        f.relPath,
+				Description: "resolved task has no resolved time",
+				fix: func() error {
+					// best guess
+					t.Resolved = f.modTime
+					return f.write()
+				},
+			})
+		}
+
+		// the oldest task keeps a contested ID
+		if t.Status != STATUS_RESOLVED && t.ID > 0 {
+			if owner := usedIDs[t.ID]; owner != nil {
+				problems = append(problems, Problem{
+					Path:        f.relPath,
+					Description: fmt.Sprintf("ID %d is also used by %s", t.ID, owner.relPath),
+					fix: func() error {
+						for id := 1; id <= MAX_TASKS_OPEN; id++ {
+							if usedIDs[id] == nil {
+								usedIDs[id] = f
+								t.ID = id
+								return f.write()
+							}
+						}
+						return errors.New("No free IDs")
+					},
+				})
+			} else {
+				usedIDs[t.ID] = f
+			}
+		}
+
+		// anything else that would stop the task loading, assuming the
+		// above are fixed
+		check := *t
+		check.Dependencies = nil
+		check.Priority = PRIORITY_NORMAL
+		if err := check.Validate(); err != nil {
+			problems = append(problems, Problem{
+				Path:        f.relPath,
+				Description: "invalid task: " + err.Error(),
+			})
+		}
+	}
+
+	return problems, nil
+}
@@ -0,0 +1,131 @@
+package dstask
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFsck(t *testing.T) {
+	store, cleanup := newTestGitStore(t)
+	defer cleanup()
+
+	day := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	write := func(relPath, content string) string {
+		fp := filepath.Join(store.Repo, relPath)
+		if err := os.MkdirAll(filepath.Dir(fp), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(fp, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return fp
+	}
+
+	save := func(task Task) {
+		if err := store.Save(task); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	save(testTask(1, 1, day))
+
+	dangling := testTask(2, 2, day.Add(time.Hour))
+	dangling.Dependencies = []string{testUUID(99)}
+	save(dangling)
+
+	priority := testTask(3, 3, day.Add(2*time.Hour))
+	priority.Priority = "P9"
+	save(priority)
+
+	resolved := testTask(4, 0, day.Add(3*time.Hour))
+	resolved.Status = STATUS_RESOLVED
+	save(resolved)
+
+	// newer, so renumbered
+	save(testTask(5, 1, day.Add(4*time.Hour)))
+
+	// an older copy of task 1, left by an interrupted save
+	old := write("active/"+testUUID(1)+".yml", "summary: task 1\n")
+	past := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(old, past, past); err != nil {
+		t.Fatal(err)
+	}
+
+	write("pending/."+testUUID(6)+".yml.123.tmp", "summary: half")
+	write("pending/notes.txt", "not a task")
+	write("pending/"+testUUID(7)+".yml", "summary: [unclosed\n")
+	write("pending/subdir/x", "")
+
+	problems, err := store.Fsck()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, problem := range problems {
+		got = append(got, problem.Path+": "+problem.Description)
+	}
+	sort.Strings(got)
+
+	want := []string{
+		"active/" + testUUID(1) + ".yml: duplicate of newer pending/" + testUUID(1) + ".yml",
+		"pending/." + testUUID(6) + ".yml.123.tmp: leftover temporary file",
+		"pending/" + testUUID(2) + ".yml: depends on missing tasks " + testUUID(99),
+		"pending/" + testUUID(3) + ".yml: invalid priority \"P9\"",
+		"pending/" + testUUID(5) + ".yml: ID 1 is also used by pending/" + testUUID(1) + ".yml",
+		"pending/" + testUUID(7) + ".yml: malformed YAML",
+		"pending/notes.txt: file name is not <uuid4>.yml, so it is ignored",
+		"pending/subdir: unexpected directory",
+		"resolved/" + testUUID(4) + ".yml: resolved task has no resolved time",
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("problems\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	for i := range want {
+		// the YAML error message is from the parser
+		if !strings.HasPrefix(got[i], want[i]) {
+			t.Errorf("problem %q, want %q", got[i], want[i])
+		}
+	}
+
+	for _, problem := range problems {
+		if problem.Fixable() {
+			if err := problem.Fix(); err != nil {
+				t.Fatalf("fixing %s: %v", problem.Path, err)
+			}
+		}
+	}
+
+	if err := os.RemoveAll(filepath.Join(store.Repo, "pending", "subdir")); err != nil {
+		t.Fatal(err)
+	}
+
+	if problems, err := store.Fsck(); err != nil || len(problems) != 0 {
+		t.Errorf("problems %+v after fixing, %v", problems, err)
+	}
+
+	if _, err := os.Stat(filepath.Join(store.Repo, LOST_AND_FOUND_DIR, "pending-notes.txt")); err != nil {
+		t.Errorf("ignored file not kept: %v", err)
+	}
+
+	ts, err := LoadTaskSet(store, ALL_STATUSES)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ts.IDConflicts()) != 0 {
+		t.Errorf("ID conflicts %v after fixing", ts.IDConflicts())
+	}
+
+	if task := ts.tasksByUUID[testUUID(5)]; task == nil || task.ID == 1 {
+		t.Errorf("newer task not renumbered: %v", task)
+	}
+}
@@ -0,0 +1,333 @@
+package dstask
+
+// git operations for the git store, using an embedded git implementation so
+// dstask works without the git binary and failures are reported as errors.
+// Only `dstask git`, and syncing with a remote that is not a local path, run
+// git itself.
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"syscall"
+	"time"
+
+	git "gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+	format "gopkg.in/src-d/go-git.v4/plumbing/format/config"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/index"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+func (s *GitStore) openRepo() (*git.Repository, error) {
+	repo, err := git.PlainOpen(MustExpandHome(s.Repo))
+
+	if err == git.ErrRepositoryNotExists {
+		return nil, fmt.Errorf("%w at %s, please clone or create. Try `dstask help` for more information.", ErrRepoMissing, s.Repo)
+	} else if err != nil {
+		return nil, &GitError{Args: []string{"open", s.Repo}, Err: err}
+	}
+
+	return repo, nil
+}
+
+func (s *GitStore) hasCommits() bool {
+	repo, err := s.openRepo()
+	if err != nil {
+		return false
+	}
+
+	_, err = repo.Head()
+	return err == nil
+}
+
+// the commit a reference points to, or nil if it does not exist
+func resolveCommit(repo *git.Repository, name plumbing.ReferenceName) (*object.Commit, error) {
+	ref, err := repo.Reference(name, true)
+	if err == plumbing.ErrReferenceNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, &GitError{Args: []string{"rev-parse", name.String()}, Err: err}
+	}
+
+	commit, err := repo.CommitObject(ref.Hash())
+	if err != nil {
+		return nil, &GitError{Args: []string{"rev-parse", name.String()}, Err: err}
+	}
+
+	return commit, nil
+}
+
+// commits reachable from c but not from exclude, newest first. Either may be
+// nil.
+func commitsNotIn(c, exclude *object.Commit) ([]*object.Commit, error) {
+	var commits []*object.Commit
+	seen := make(map[plumbing.Hash]bool)
+
+	if exclude != nil {
+		err := object.NewCommitPreorderIter(exclude, nil, nil).ForEach(func(c *object.Commit) error {
+			seen[c.Hash] = true
+			return nil
+		})
+		if err != nil {
+			return nil, &GitError{Args: []string{"log", exclude.Hash.String()}, Err: err}
+		}
+	}
+
+	if c == nil {
+		return nil, nil
+	}
+
+	err := object.NewCommitPreorderIter(c, seen, nil).ForEach(func(c *object.Commit) error {
+		commits = append(commits, c)
+		return nil
+	})
+	if err != nil {
+		return nil, &GitError{Args: []string{"log", c.Hash.String()}, Err: err}
+	}
+
+	return commits, nil
+}
+
+// the first line of the message
+func commitSubject(c *object.Commit) string {
+	return strings.SplitN(c.Message, "\n", 2)[0]
+}
+
+// like git log --oneline
+func commitSummary(c *object.Commit) string {
+	return c.Hash.String()[:7] + " " + commitSubject(c)
+}
+
+// the author of commits: GIT_AUTHOR_NAME and GIT_AUTHOR_EMAIL if set,
+// otherwise the user of the repository or global git config
+func (s *GitStore) signature(repo *git.Repository) *object.Signature {
+	name := GIT_AUTHOR_NAME
+	email := GIT_AUTHOR_EMAIL
+
+	var sections []*format.Section
+
+	if cfg, err := repo.Config(); err == nil {
+		sections = append(sections, cfg.Raw.Section("user"))
+	}
+
+	for _, cfg := range globalGitConfigs() {
+		sections = append(sections, cfg.Section("user"))
+	}
+
+	for _, section := range sections {
+		if name == "" {
+			name = section.Option("name")
+		}
+
+		if email == "" {
+			email = section.Option("email")
+		}
+	}
+
+	if name == "" {
+		name = "dstask"
+	}
+
+	if email == "" {
+		hostname, _ := os.Hostname()
+		email = os.Getenv("USER") + "@" + hostname
+	}
+
+	return &object.Signature{
+		Name:  name,
+		Email: email,
+		When:  time.Now(),
+	}
+}
+
+// ~/.gitconfig then the XDG config, in order of precedence. Unreadable files
+// are skipped.
+func globalGitConfigs() []*format.Config {
+	var configs []*format.Config
+
+	xdgConfigHome := os.Getenv("XDG_CONFIG_HOME")
+	if xdgConfigHome == "" {
+		xdgConfigHome = "~/.config"
+	}
+
+	for _, fp := range []string{"~/.gitconfig", path.Join(xdgConfigHome, "git", "config")} {
+		f, err := os.Open(MustExpandHome(fp))
+		if err != nil {
+			continue
+		}
+
+		cfg := format.New()
+		err = format.NewDecoder(f).Decode(cfg)
+		f.Close()
+
+		if err == nil {
+			configs = append(configs, cfg)
+		}
+	}
+
+	return configs
+}
+
+// stage every change in the worktree, like git add -A, except temporary files
+// left by WriteFileAtomic. Only changed files are hashed; Worktree.Add would
+// hash the whole worktree again for each. Returns false if there was nothing
+// to commit.
+func stageAll(repo *git.Repository) (bool, error) {
+	w, err := repo.Worktree()
+	if err != nil {
+		return false, &GitError{Args: []string{"add"}, Err: err}
+	}
+
+	status, err := w.Status()
+	if err != nil {
+		return false, &GitError{Args: []string{"status"}, Err: err}
+	}
+
+	idx, err := repo.Storer.Index()
+	if err != nil {
+		return false, &GitError{Args: []string{"add"}, Err: err}
+	}
+
+	var changed bool
+
+	for fp, fileStatus := range status {
+		if isAtomicTempFile(path.Base(fp)) {
+			continue
+		}
+
+		switch fileStatus.Worktree {
+		case git.Unmodified:
+			// staged already
+		case git.Deleted:
+			if _, err := idx.Remove(fp); err != nil && err != index.ErrEntryNotFound {
+				return false, &GitError{Args: []string{"rm", fp}, Err: err}
+			}
+		default:
+			if err := stageFile(repo, idx, w.Filesystem.Root(), fp); err != nil {
+				return false, &GitError{Args: []string{"add", fp}, Err: err}
+			}
+		}
+
+		changed = changed || fileStatus.Worktree != git.Unmodified || fileStatus.Staging != git.Unmodified
+	}
+
+	if !changed {
+		return false, nil
+	}
+
+	if err := repo.Storer.SetIndex(idx); err != nil {
+		return false, &GitError{Args: []string{"add"}, Err: err}
+	}
+
+	return true, nil
+}
+
+// store the file as a blob and point its index entry at it
+func stageFile(repo *git.Repository, idx *index.Index, root, fp string) error {
+	info, err := os.Lstat(filepath.Join(root, fp))
+	if err != nil {
+		return err
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(root, fp))
+	if err != nil {
+		return err
+	}
+
+	obj := repo.Storer.NewEncodedObject()
+	obj.SetType(plumbing.BlobObject)
+	obj.SetSize(int64(len(data)))
+
+	writer, err := obj.Writer()
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(data); err != nil {
+		writer.Close()
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	hash, err := repo.Storer.SetEncodedObject(obj)
+	if err != nil {
+		return err
+	}
+
+	entry, err := idx.Entry(fp)
+	if err == index.ErrEntryNotFound {
+		entry = idx.Add(fp)
+	} else if err != nil {
+		return err
+	}
+
+	mode, err := filemode.NewFromOSFileMode(info.Mode())
+	if err != nil {
+		return err
+	}
+
+	entry.Hash = hash
+	entry.Mode = mode
+	entry.ModifiedAt = info.ModTime()
+	entry.Size = uint32(info.Size())
+	fillStatInfo(entry, info)
+	return nil
+}
+
+// the change time, device, inode and owner git compares to see if a file
+// changed, as Worktree.Add records them. The fields of the stat structure are
+// named differently on each system.
+func fillStatInfo(entry *index.Entry, info os.FileInfo) {
+	sys := reflect.Indirect(reflect.ValueOf(info.Sys()))
+	if sys.Kind() != reflect.Struct {
+		return
+	}
+
+	field := func(name string) uint32 {
+		switch f := sys.FieldByName(name); f.Kind() {
+		case reflect.Int, reflect.Int32, reflect.Int64:
+			return uint32(f.Int())
+		case reflect.Uint, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return uint32(f.Uint())
+		}
+		return 0
+	}
+
+	entry.Dev = field("Dev")
+	entry.Inode = field("Ino")
+	entry.UID = field("Uid")
+	entry.GID = field("Gid")
+
+	for _, name := range []string{"Ctim", "Ctimespec"} {
+		if f := sys.FieldByName(name); f.IsValid() {
+			if ts, ok := f.Interface().(syscall.Timespec); ok {
+				entry.CreatedAt = time.Unix(ts.Unix())
+			}
+		}
+	}
+}
+
+// commit the index. Without parents, the parent is HEAD.
+func (s *GitStore) commit(repo *git.Repository, msg string, parents ...plumbing.Hash) error {
+	w, err := repo.Worktree()
+	if err != nil {
+		return &GitError{Args: []string{"commit"}, Err: err}
+	}
+
+	_, err = w.Commit(msg, &git.CommitOptions{
+		Author:  s.signature(repo),
+		Parents: parents,
+	})
+	if err != nil {
+		return &GitError{Args: []string{"commit"}, Err: err}
+	}
+
+	return nil
+}
@@ -0,0 +1,135 @@
+package dstask
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	git "gopkg.in/src-d/go-git.v4"
+)
+
+func TestStageAll(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dstask-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	repo, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	write := func(name, content string) {
+		fp := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(fp), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(fp, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	staged := func() string {
+		idx, err := repo.Storer.Index()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var names []string
+		for _, entry := range idx.Entries {
+			if entry.Inode == 0 || entry.CreatedAt.IsZero() {
+				t.Errorf("%s staged without stat information", entry.Name)
+			}
+			names = append(names, entry.Name)
+		}
+		sort.Strings(names)
+		return strings.Join(names, " ")
+	}
+
+	store := &GitStore{Repo: dir}
+
+	tests := []struct {
+		name    string
+		change  func()
+		changed bool
+		staged  string
+	}{
+		{
+			name: "new files",
+			change: func() {
+				write("pending/a.yml", "a")
+				write("pending/b.yml", "b")
+			},
+			changed: true,
+			staged:  "pending/a.yml pending/b.yml",
+		},
+		{
+			name:   "nothing changed",
+			change: func() {},
+			staged: "pending/a.yml pending/b.yml",
+		},
+		{
+			name: "modified, moved and deleted",
+			change: func() {
+				write("pending/a.yml", "a2")
+				os.Remove(filepath.Join(dir, "pending/b.yml"))
+				write("resolved/b.yml", "b")
+			},
+			changed: true,
+			staged:  "pending/a.yml resolved/b.yml",
+		},
+		{
+			name: "temporary files",
+			change: func() {
+				write("pending/.a.yml.123.tmp", "a3")
+			},
+			staged: "pending/a.yml resolved/b.yml",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.change()
+
+			changed, err := stageAll(repo)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if changed != test.changed {
+				t.Errorf("changed %v, want %v", changed, test.changed)
+			}
+
+			if got := staged(); got != test.staged {
+				t.Errorf("staged %s, want %s", got, test.staged)
+			}
+
+			if changed {
+				if err := store.commit(repo, test.name); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// the index and worktree agree, but for temporary files
+			w, err := repo.Worktree()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			status, err := w.Status()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for fp := range status {
+				if !isAtomicTempFile(filepath.Base(fp)) {
+					t.Errorf("%s not committed", fp)
+				}
+			}
+		})
+	}
+}
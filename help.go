@@ -10,14 +10,41 @@ func Help(cmd string) {
 
 	switch cmd {
 	case CMD_NEXT:
-		helpStr = `Usage: dstask next [filter] [--]
+		helpStr = `Usage: dstask next [filter] [--] [--format <format>]
 Usage: dstask [filter] [--]
 Example: dstask +work +bug --
 
 Display list of non-resolved tasks in the current context, most recent last,
 optional filter. It is the default command, so "next" is unnecessary.
 
+Tasks are ordered by priority, then due date, then creation date. Filter by due
+date with due:<date>, due.before:<date> and due.after:<date>, or select tasks
+that are past due with overdue. Blocked tasks are shown last. Select tasks
+waiting on others with blocked, or holding others up with blocking.
+
+Filters can be combined with and, or, not and parentheses; terms next to each
+other must all match. Quote parentheses and comparisons for the shell.
+
+    dstask next +bug or +urgent
+    dstask next "(project:web or project:ops) priority<=P1"
+    dstask next not +someday created.after:-2w
+
+Outside parentheses, and, or and not are only operators next to a keyword or
+parenthesis, so "dstask next fish and chips" searches for the phrase. To
+combine searches, use parentheses: dstask next "(fish or chips)".
+
+As well as the above, compare priority with priority<P2, priority<=P1,
+priority>P1 or priority>=P2, creation and resolution dates with created:,
+created.before:, created.after:, resolved: and so on, and select a status with
+status:<status>. project:web also matches subprojects such as web.frontend,
+and project: alone tasks without a project.
+
 Bypass the current context with --.
+
+With --format json, yaml, csv, tsv or markdown, the tasks are written for
+scripts rather than shown as a table, without truncation. The same goes for the
+show- commands. The fields are listed in README.md. When output is not to a
+terminal, the table is plain text.
 `
 	case CMD_ADD:
 		helpStr = `Usage: dstask add [task summary] [--]
@@ -26,11 +53,30 @@ Example: dstask add Fix main web page 500 error +bug P1 project:website
 Add a task, returning the git commit output which contains the task ID, used
 later to reference the task.
 
-Tags, project and priority can be added anywhere within the task summary.
+Tags, project, priority and due date can be added anywhere within the task
+summary. Due dates can be absolute or relative, with an optional time:
+
+    due:2026-11-03  due:2026-11-03T15:00  due:15:00
+    due:today  due:tomorrow  due:eow  due:eom  due:eoy  due:monday
+    due:+3d  due:+2w  due:+1m  due:tomorrow@9:30  due:fri@3pm
+
+A date without a time means the end of that day.
 
 Add -- to ignore the current context. / can be used when adding tasks to note
 any words after.
 
+Add recur:<rule> to create a recurring template instead. A pending instance is
+created immediately, then again each time the rule falls due, and saved with
+the next command that changes tasks. Only one open instance exists per
+template at a time. Rules:
+
+    recur:daily
+    recur:weekly           same weekday as the template was added
+    recur:weekly:mon,thu
+    recur:monthly          same day of month as the template was added
+    recur:monthly:15
+    recur:every:3          3 days after the previous instance was resolved
+
 `
 
 	case CMD_LOG:
@@ -56,6 +102,9 @@ Alternatively, "start" can add a task and start it immediately with the same
 syntax is the "add" command.  Tags, project and priority can be added anywhere
 within the task summary.
 
+The time spent active is recorded, see "dstask help report". If
+DSTASK_SINGLE_ACTIVE is set, starting a task pauses the active one.
+
 Add -- to ignore the current context.
 `
 	case CMD_NOTE:
@@ -73,7 +122,8 @@ Example: dstask 15 stop
 Example: dstask 15 stop replaced some hardware
 
 Set a task as inactive, meaning you've stopped work on the task. Optional text
-may be added, which will be appended to the note.
+may be added, which will be appended to the note. This stops the clock started
+by "dstask start".
 `
 	case CMD_RESOLVE:
 		fallthrough
@@ -83,22 +133,86 @@ Example: dstask 15 done
 Example: dstask 15 done replaced some hardware
 
 Resolve a task. Optional text may be added, which will be appended to the note.
+`
+	case CMD_DEFER:
+		helpStr = `Usage: dstask <id...> defer until:<date> [text]
+Example: dstask 15 defer until:friday
+Example: dstask 15 defer until:+2w waiting for parts
+
+Put a task to sleep until the given date, hiding it from the next report.
+Optional text may be added, which will be appended to the note. The task
+returns to pending automatically once the date has passed, and is saved as
+pending with the next command that changes tasks. Dates are as for due:, see
+"dstask help add".
+`
+	case CMD_DELEGATE:
+		helpStr = `Usage: dstask <id...> delegate <person> [text]
+Example: dstask 7 delegate alice
+Example: dstask 7 delegate alice please review by friday
+
+Hand a task over to someone else. The hand-off and optional text are recorded
+in the notes. Delegated tasks can be resolved as normal when done, or taken
+back with the undelegate command.
+`
+	case CMD_UNDELEGATE:
+		helpStr = `Usage: dstask <id...> undelegate [text]
+Example: dstask 7 undelegate
+
+Take back a delegated task, returning it to pending. Optional text is recorded
+in the notes.
+`
+	case CMD_SUBTASK:
+		helpStr = `Usage: dstask <id> subtask
+Usage: dstask <id> subtask add <summary>
+Usage: dstask <id> subtask <n> done|undone|rm
+Example: dstask 5 subtask add order parts
+Example: dstask 5 subtask 2 done
+
+Show, add, resolve, reopen or remove the checklist of subtasks on a task.
+Markdown checkboxes in the notes ("- [ ] item" or "- [x] item") are treated
+as subtasks too, numbered after the others.
+
+The next report shows progress for tasks with subtasks. Resolving a task with
+open subtasks asks for confirmation.
+`
+	case CMD_DEPENDS:
+		helpStr = `Usage: dstask <id> depends <id...>
+Example: dstask 4 depends 9
+
+Make the first task depend on the others. A task is blocked until everything
+it depends on is resolved. Blocked tasks are shown at the bottom of the next
+report, and resolving a task lists the tasks it unblocked. Dependencies that
+would create a cycle are rejected.
+
+Use the blocked and blocking selectors to filter by dependency state.
+`
+	case CMD_NODEPEND:
+		helpStr = `Usage: dstask <id> nodepend <id...>
+Example: dstask 4 nodepend 9
+
+Remove dependencies added with the depends command.
 `
 	case CMD_CONTEXT:
 		helpStr = `Usage: dstask context <filter>
 Example: dstask context +work -bug
+Example: dstask context "(project:web or +urgent)" not +someday
 
-Set a global filter consisting of a project, tags or antitags. Subsequent new
-tasks and most commands will then have this filter applied automatically.
+Set a global filter, any filter as described in "dstask help next". Subsequent
+new tasks and most commands will then have this filter applied automatically.
 
 For example, if you were to run "task add fix the webserver," the given task
-would then have the tag "work" applied automatically.
+would then have the tag "work" applied automatically. Only the project, tags
+and priority that every task in the context must have are applied to new
+tasks, so none are from a context using or.
+
+Clear the context with "dstask context none".
 `
 	case CMD_MODIFY:
 		helpStr = `Usage: dstask <id...> modify <filter>
 Example: dstask 34 modify -work +home project:workbench -project:website
 
-Modify the attributes of a task.
+Modify the attributes of a task. Clear a due date with due:none. The rule of a recurring template can be
+changed with recur:<rule>.
 `
 	case CMD_EDIT:
 		helpStr = `Usage: dstask <id...> edit
@@ -106,17 +220,60 @@ Modify the attributes of a task.
 Edit a task in your text editor.
 `
 	case CMD_UNDO:
-		helpStr = `Usage: dstask undo
+		helpStr = `Usage: dstask undo [N] [--force]
+
+Undo the last N commands that changed tasks, 1 by default, with a commit
+reverting the changes of each. A change to a task that has changed again
+since, for instance by a sync, cannot be undone until the later change is.
+
+Changes pulled by sync, and commits made with "dstask git" that change other
+files, are skipped. Changes already pushed by sync are not undone without
+--force, as another machine may have built on them.
+`
+	case CMD_REDO:
+		helpStr = `Usage: dstask redo [N]
+
+Redo the last N changes undone with "dstask undo", 1 by default. Not possible
+once another change has been made.
+`
+	case CMD_HISTORY:
+		helpStr = `Usage: dstask history [N]
+Usage: dstask <id> history [restore <commit>]
+
+List the last N changes made by dstask, or all of them, newest first. Undone
+changes are marked. See "dstask help undo".
 
-Undo the last command that changed the repository. This uses git revert on one
-or more commits.
+With a task, show every version of it, oldest first, with the commit that made
+it and the fields that changed. This includes changes pulled by sync. With
+restore, set the fields of the task back to those of the version made by the
+given commit, keeping its status and ID.
 `
 	case CMD_SYNC:
-		helpStr = `Usage: dstask sync
+		helpStr = `Usage: dstask sync [--status]
+
+Synchronise with the remote git server. Fetches, reports how many commits there
+are to push and pull, merges then pushes. If there are conflicts that cannot be
+automatically resolved, it is necessary to manually resolve them in ~/.dstask
+or with the "task git" command.
+
+The remote and branch are those of the upstream of the current branch, or the
+only remote and the current branch. DSTASK_SYNC_REMOTE and DSTASK_SYNC_BRANCH
+override them.
+
+With --status, list the local commits not yet pushed, as of the last sync,
+without using the network.
+
+Task files changed on both sides are merged field by field: tags added on
+either side are kept, diverging notes are concatenated, other fields take the
+most recent change and a task resolved on either side stays resolved. Sync
+also registers "dstask merge-driver" in .gitattributes and the local git
+config, so merges made with "dstask git" do the same.
 
-Synchronise with the remote git server. Runs git pull then git push. If there
-are conflicts that cannot be automatically resolved, it is necessary to
-manually resolve them in  ~/.dstask or with the "task git" command.
+Remotes that are a local path are synced without the git binary. Other
+remotes are fetched from and pushed to with git.
+
+Tasks added on another machine may have been given the same ID as a local
+task. The older task keeps the ID and the other is renumbered, with a notice.
 `
 	case CMD_GIT:
 		helpStr = `Usage: dstask git <args...>
@@ -128,6 +285,23 @@ Run the given git command inside ~/.dstask
 		helpStr = `Usage: dstask resolved
 
 Show a report of last 1000 resolved tasks.
+`
+	case CMD_SHOW_DEFERRED:
+		helpStr = `Usage: dstask show-deferred [filter] [--]
+
+Show deferred tasks, and when each will return to pending.
+`
+	case CMD_SHOW_DELEGATED:
+		helpStr = `Usage: dstask show-delegated [filter] [--]
+
+Show delegated tasks grouped by person, and how long each has been waiting.
+`
+	case CMD_SHOW_RECURRING:
+		helpStr = `Usage: dstask show-recurring [filter] [--]
+
+Show recurring task templates. Templates are created with the recur: operator
+when adding a task, and are hidden from the next report. Resolve a template to
+stop it recurring; instances already created are unaffected.
 `
 	case CMD_OPEN:
 		helpStr = `Usage: dstask <id...> open
@@ -137,15 +311,125 @@ dozens of tabs open to later action, convert them into tasks to open later with
 this command.
 `
 	case CMD_SHOW_PROJECTS:
-		helpStr = `Usage: dstask show-projects
+		helpStr = `Usage: dstask show-projects [--format <format>]
 
-Show a breakdown of projects with progress information
+Show a breakdown of projects with progress information. With --format, all
+projects are written with name, tasks_not_resolved, tasks_resolved, active,
+created and resolved fields.
 `
 	case CMD_IMPORT_TW:
 		helpStr = `Usage: cat export.json | task import-tw
 
 Import tasks from a taskwarrior json dump. The "task export" taskwarrior
 command can be used for this.
+`
+	case CMD_EXPORT_TW:
+		helpStr = `Usage: dstask export-tw [filter] [--] | task import
+
+Write tasks matching the filter and context as taskwarrior JSON, for "task
+import". UUIDs are kept, so exporting again updates the same tasks. Notes,
+subtasks and delegation become annotations, and dependencies the depends
+field. Priorities P0 and P1 become H, P2 none and P3 L. Active tasks are
+started, deferred tasks waiting, and recurring templates keep their rule where
+taskwarrior has an equivalent, due when the next instance is. Other templates
+are left out and their instances exported as tasks that do not recur.
+`
+	case CMD_IMPORT_TODOTXT:
+		helpStr = `Usage: dstask import-todotxt < todo.txt
+
+Import tasks from a todo.txt file. Priorities (A) to (D) become P0 to P3, the
+first +project the project, other +projects and @contexts tags, x lines and
+their completion dates resolved tasks, creation dates the created time, and
+due:<date> the due date.
+
+Lines are matched to tasks by the uuid: written by export-todotxt, or else by
+summary and project, so the same file can be imported again without duplicate
+tasks. Matched tasks are updated; fields a line does not have are kept. The
+number of tasks added, updated and unchanged is printed.
+`
+	case CMD_EXPORT_TODOTXT:
+		helpStr = `Usage: dstask export-todotxt [filter] [--] > todo.txt
+
+Write tasks matching the filter and context as todo.txt lines, resolved tasks
+included, as for import-todotxt. P2, the default, is written without a
+priority. Each line ends with uuid:<uuid> so changes made elsewhere can be
+imported back.
+`
+	case CMD_EXPORT_ICAL:
+		helpStr = `Usage: dstask export-ical [filter] [--] > tasks.ics
+
+Write tasks matching the filter and context as iCalendar VTODO entries, for
+calendar applications, resolved tasks included. The UUID is the UID, notes the
+description, tags the categories, and P0 to P3 priorities 1, 3, 5 and 9.
+Active tasks are IN-PROCESS, resolved tasks COMPLETED and others NEEDS-ACTION.
+
+Set DSTASK_ICAL_DIR to a directory to have dstask.ics in it rewritten with all
+open tasks, whatever the context, whenever tasks change.
+`
+	case CMD_EXPORT:
+		helpStr = `Usage: dstask export [filter] [--] [--format <format>]
+Example: dstask export -- > backup.json
+
+Write all tasks matching the filter and context as JSON, including resolved
+tasks, with every field. The fields are as for --format json, listed in
+README.md. Add -- to export tasks outside the current context.
+`
+	case CMD_IMPORT:
+		helpStr = `Usage: dstask import < tasks.json
+Example: dstask export project:dstask | jq '.[].priority = "P1"' | dstask import
+
+Import tasks in the JSON format of export. Tasks are matched by UUID: new tasks
+are added, keeping their IDs if free, and existing tasks are replaced by the
+imported version. Records without a UUID are added as new tasks. The number of
+tasks added, updated and unchanged is printed.
+`
+	case CMD_REINDEX:
+		helpStr = `Usage: dstask reindex
+
+Rebuild the cache of parsed task files. The cache is kept up to date
+automatically, so this is only necessary if it is suspected to be wrong.
+The cache lives in ~/.cache/dstask/index, or DSTASK_INDEX_FILE if set.
+`
+	case CMD_FSCK:
+		helpStr = `Usage: dstask fsck [--fix]
+
+Check the repository for problems: malformed YAML, misnamed files, the same
+task in more than one status directory, dependencies on missing tasks, invalid
+priorities, resolved tasks without a resolved time and open tasks sharing an
+ID.
+
+With --fix, repair what can be repaired and commit the result. Files that
+cannot be loaded are moved to the lost+found directory for manual recovery.
+Exits non-zero if problems remain.
+`
+	case CMD_MIGRATE:
+		helpStr = `Usage: dstask migrate [--dry-run]
+
+Upgrade the repository to the data format of this version of dstask, making a
+commit for each step. With --dry-run, list the task files each step would
+change without changing anything.
+
+Older repositories can still be used without migrating, but a repository
+migrated by a newer dstask cannot be used by an older one.
+`
+	case CMD_REPORT:
+		helpStr = `Usage: dstask report time [filter] [since:<date>] [until:<date>]
+Example: dstask report time project:website since:monday
+Example: dstask report time +client since:2026-10-01 until:2026-10-31
+
+Show the time worked on the matching tasks, resolved ones included, as a
+timesheet of hours per task per day with totals by day, project and tag.
+
+Time is recorded while a task is active, from "dstask start" to "dstask stop",
+"dstask done" or any other change of status. since: takes the same dates as
+due:, but a weekday means the last one, so since:monday is this week.
+`
+	case CMD_MERGE_DRIVER:
+		helpStr = `Usage: dstask merge-driver <base> <ours> <theirs>
+
+Three-way merge of a task file, writing the result to <ours>. Run by git for
+merges made with "dstask git", see "dstask help sync". Exits non-zero, leaving a conflict, if any
+version cannot be parsed.
 `
 	default:
 		helpStr = `Usage: dstask [id...] <cmd> [task summary/filter]
@@ -153,31 +437,46 @@ command can be used for this.
 Where [task summary] is text with tags/project/priority specified. Tags are
 specified with + (or - for filtering) eg: +work. The project is specified with
 a project:g prefix eg: project:dstask -- no quotes. Priorities run from P3
-(low), P2 (default) to P1 (high) and P0 (critical). Text can also be specified
-for a substring search of description and notes.
+(low), P2 (default) to P1 (high) and P0 (critical). Due dates are set with
+due: eg: due:friday, see "dstask help add". Text can also be specified for a
+substring search of description and notes. Filters can be combined with and,
+or, not and parentheses, see "dstask help next". Outside parentheses these
+words are only operators next to a filter keyword or parenthesis, so "dstask
+fish and chips" still searches for the phrase; dstask "(fish or chips)"
+combines searches.
 
 Cmd and IDs can be swapped, multiple IDs can be specified for batch
-operations.
+operations. A UUID prefix of at least 4 characters, as shown by "dstask <id>",
+can be used in place of an ID.
 
 run "task help <cmd>" for command specific help.
 
 Add -- to ignore the current context. / can be used when adding tasks to note
-any words after.
+any words after. Add --format json (or yaml, csv, tsv, markdown) to a listing
+for output to use in scripts.
 
 Available commands:
 
-next           : Show most important tasks (priority, creation date -- truncated and default)
+next           : Show most important tasks (priority, due date, creation date -- truncated and default)
 add            : Add a task
 log            : Log a task (already resolved)
 start          : Change task status to active
 note           : Append to or edit note for a task
 stop           : Change task status to pending
 done           : Resolve a task
+defer          : Hide a task until a given date
+delegate       : Hand a task over to someone else
+undelegate     : Take back a delegated task
+subtask        : Add, resolve or remove subtasks of a task
+depends        : Make a task depend on others
+nodepend       : Remove dependencies from a task
 context        : Set global context for task list and new tasks
 modify         : Set attributes for a task
 edit           : Edit task with text editor
-undo           : Undo last action with git revert
-sync           : Pull then push to git repository, automatic merge commit.
+undo           : Undo the last N actions
+redo           : Redo the last N undone actions
+history        : List the changes made by dstask, or to a task. Can restore a task
+sync           : Pull then push to git repository, automatic merge commit. --status to show unpushed commits
 open           : Open all URLs found in summary/annotations
 git            : Pass a command to git in the repository. Used for push/pull.
 show-projects  : List projects with completion status
@@ -186,14 +485,31 @@ show-active    : Show tasks that have been started
 show-paused    : Show tasks that have been started then stopped
 show-open      : Show non-resolved tasks (without truncation)
 show-resolved  : Show resolved tasks
+show-recurring : Show recurring task templates
+show-deferred  : Show deferred tasks and when they return
+show-delegated : Show delegated tasks by person
 import-tw      : Import tasks from taskwarrior via stdin
+export-tw      : Write tasks as taskwarrior JSON, for task import
+import-todotxt : Add or update tasks from a todo.txt file via stdin
+export-todotxt : Write tasks as a todo.txt file
+export-ical    : Write tasks as iCalendar VTODO entries
+export         : Write tasks as JSON, for backups and scripts
+import         : Add or update tasks from JSON written by export
+reindex        : Rebuild the cache of parsed task files
+fsck           : Check the repository for problems, --fix to repair
+migrate        : Upgrade the repository data format
+merge-driver   : Merge two versions of a task file, run by git
+report         : Show a timesheet of time worked, from start and stop
 help           : Get help on any command or show this message
 
+Exit codes: 1 general failure, 2 invalid input, 3 no matching tasks, 4 git
+failure.
+
 Task table key:
 
 `
 	}
-	fmt.Fprintf(os.Stderr, helpStr)
+	fmt.Fprint(os.Stderr, helpStr)
 
 	colourPrintln(0, FG_PRIORITY_CRITICAL, BG_DEFAULT_2, "Critical priority")
 	colourPrintln(0, FG_PRIORITY_HIGH, BG_DEFAULT_2, "High priority")
@@ -201,8 +517,6 @@ Task table key:
 	colourPrintln(0, FG_PRIORITY_LOW, BG_DEFAULT_2, "Low priority")
 	colourPrintln(0, FG_ACTIVE, BG_ACTIVE, "Active")
 	colourPrintln(0, FG_DEFAULT, BG_PAUSED, "Paused")
-
-	os.Exit(0)
 }
 
 func colourPrintln(mode, fg, bg int, line string) {
@@ -0,0 +1,507 @@
+package dstask
+
+// the history of changes made by dstask, for undo and redo. Each command that
+// changes tasks is a commit; undoing it is a commit reverting its changes, and
+// redoing it a commit reapplying them, so both are recorded and synced like
+// any other change.
+
+// Only commits on the first parent line of HEAD are considered, so changes
+// pulled in by a sync merge are not undone here. Merges themselves, and
+// commits made with `dstask git` that touch other files, are skipped.
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	git "gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+)
+
+const (
+	HISTORY_CHANGE = "change"
+	HISTORY_UNDO   = "undo"
+	HISTORY_REDO   = "redo"
+	HISTORY_MERGE  = "merge"
+)
+
+// the same as git revert, so undos made by older versions are recognised
+var undoTrailer = regexp.MustCompile(`This reverts commit ([0-9a-f]{40})\.`)
+var redoTrailer = regexp.MustCompile(`This reapplies commit ([0-9a-f]{40})\.`)
+
+type HistoryEntry struct {
+	Hash    string
+	Time    time.Time
+	Summary string
+	// one of the HISTORY_ kinds
+	Kind string
+	// for changes, whether they are currently undone
+	Undone bool
+	// whether the commit is on a remote, as of the last sync
+	Pushed bool
+
+	commit *object.Commit
+	// the change an undo or redo applies to
+	target plumbing.Hash
+}
+
+func (e *HistoryEntry) String() string {
+	return e.Hash[:7] + " " + e.Summary
+}
+
+// the changes that can be undone, oldest first, and those that can be
+// redone, in the order they were undone
+type historyStacks struct {
+	done   []*HistoryEntry
+	undone []*HistoryEntry
+}
+
+func removeEntry(entries []*HistoryEntry, e *HistoryEntry) ([]*HistoryEntry, bool) {
+	for i := range entries {
+		if entries[i] == e {
+			return append(entries[:i], entries[i+1:]...), true
+		}
+	}
+
+	return entries, false
+}
+
+// whether a commit changes tasks, and only files dstask writes
+func isDstaskCommit(c *object.Commit) (bool, error) {
+	tree, err := c.Tree()
+	if err != nil {
+		return false, err
+	}
+
+	parentTree := &object.Tree{}
+	if c.NumParents() == 1 {
+		parent, err := c.Parent(0)
+		if err != nil {
+			return false, err
+		}
+
+		if parentTree, err = parent.Tree(); err != nil {
+			return false, err
+		}
+	}
+
+	changes, err := object.DiffTree(parentTree, tree)
+	if err != nil {
+		return false, err
+	}
+
+	tasks := false
+
+	for _, change := range changes {
+		for _, name := range []string{change.From.Name, change.To.Name} {
+			if _, uuid := taskPath(name); uuid != "" {
+				tasks = true
+			} else if name != "" && name != FORMAT_VERSION_FILE && name != GITATTRIBUTES_FILE {
+				return false, nil
+			}
+		}
+	}
+
+	return tasks, nil
+}
+
+// commits reachable from any remote tracking ref, back to since. Remote
+// history is read newest first by commit time and no further, with a day to
+// spare for clocks that disagree.
+func pushedCommits(repo *git.Repository, since time.Time) (map[plumbing.Hash]bool, error) {
+	pushed := make(map[plumbing.Hash]bool)
+	since = since.Add(-24 * time.Hour)
+
+	refs, err := repo.References()
+	if err != nil {
+		return nil, err
+	}
+
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		if !ref.Name().IsRemote() || ref.Type() != plumbing.HashReference {
+			return nil
+		}
+
+		c, err := repo.CommitObject(ref.Hash())
+		if err != nil {
+			return err
+		}
+
+		return object.NewCommitIterCTime(c, pushed, nil).ForEach(func(c *object.Commit) error {
+			if c.Committer.When.Before(since) {
+				return storer.ErrStop
+			}
+
+			pushed[c.Hash] = true
+			return nil
+		})
+	})
+
+	return pushed, err
+}
+
+// how much history to read. Reading stops once enough is known, so the cost
+// does not grow with the age of the repository. The zero value reads it all.
+type historyLimit struct {
+	// entries to show
+	entries int
+	// changes to undo
+	changes int
+	// whether changes are to be redone, which needs the last new change
+	redo bool
+}
+
+// whether the entries read are enough. pending is the number of undos and
+// redos whose targets have not been read, changes the number of changes read
+// that no undo or redo refers to, and sawChange whether there are any.
+func (l historyLimit) enough(entries, pending, changes int, sawChange bool) bool {
+	if l == (historyLimit{}) || pending > 0 {
+		return false
+	}
+
+	return entries >= l.entries && changes >= l.changes && (sawChange || !l.redo)
+}
+
+// the commits made by dstask on the first parent line of HEAD, newest first,
+// as far back as the limit needs, and which of them can be undone and redone
+func (s *GitStore) history(repo *git.Repository, limit historyLimit) ([]*HistoryEntry, historyStacks, error) {
+	var entries []*HistoryEntry
+	var stacks historyStacks
+
+	head, err := resolveCommit(repo, plumbing.HEAD)
+	if err != nil || head == nil {
+		return nil, stacks, err
+	}
+
+	// targets of the undos and redos read, and those not yet read
+	targeted := make(map[plumbing.Hash]bool)
+	pending := make(map[plumbing.Hash]bool)
+	var changes int
+	var sawChange bool
+
+	for c := head; c != nil; {
+		entry := &HistoryEntry{
+			Hash:    c.Hash.String(),
+			Time:    c.Author.When,
+			Summary: commitSubject(c),
+			Kind:    HISTORY_CHANGE,
+			commit:  c,
+		}
+
+		if m := undoTrailer.FindStringSubmatch(c.Message); m != nil {
+			entry.Kind = HISTORY_UNDO
+			entry.target = plumbing.NewHash(m[1])
+		} else if m := redoTrailer.FindStringSubmatch(c.Message); m != nil {
+			entry.Kind = HISTORY_REDO
+			entry.target = plumbing.NewHash(m[1])
+		} else if c.NumParents() > 1 {
+			entry.Kind = HISTORY_MERGE
+		}
+
+		own := entry.Kind == HISTORY_MERGE
+		if !own {
+			if own, err = isDstaskCommit(c); err != nil {
+				return nil, stacks, &GitError{Args: []string{"log"}, Err: err}
+			}
+		}
+
+		if own {
+			entries = append(entries, entry)
+			delete(pending, c.Hash)
+
+			switch entry.Kind {
+			case HISTORY_UNDO, HISTORY_REDO:
+				targeted[entry.target] = true
+				pending[entry.target] = true
+			case HISTORY_CHANGE:
+				sawChange = true
+				if !targeted[c.Hash] {
+					changes++
+				}
+			}
+
+			if limit.enough(len(entries), len(pending), changes, sawChange) {
+				break
+			}
+		}
+
+		if c.NumParents() == 0 {
+			break
+		}
+
+		if c, err = c.Parent(0); err != nil {
+			return nil, stacks, &GitError{Args: []string{"log"}, Err: err}
+		}
+	}
+
+	if len(entries) > 0 {
+		pushed, err := pushedCommits(repo, entries[len(entries)-1].commit.Committer.When)
+		if err != nil {
+			return nil, stacks, &GitError{Args: []string{"log"}, Err: err}
+		}
+
+		for _, entry := range entries {
+			entry.Pushed = pushed[entry.commit.Hash]
+		}
+	}
+
+	byHash := make(map[plumbing.Hash]*HistoryEntry)
+
+	// replay from the oldest read. Undos and redos only refer to changes
+	// read, so the changes that can be undone are the last of those there
+	// would be if it was all read, in the same order.
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		byHash[entry.commit.Hash] = entry
+		target := byHash[entry.target]
+
+		// an undo of an undo, as made by older versions, is a redo
+		if entry.Kind == HISTORY_UNDO && target != nil && target.Kind == HISTORY_UNDO {
+			entry.Kind = HISTORY_REDO
+			target = byHash[target.target]
+		}
+
+		switch {
+		case entry.Kind == HISTORY_CHANGE:
+			stacks.done = append(stacks.done, entry)
+			// as in an editor, a new change cannot be followed by a redo
+			stacks.undone = nil
+		case target == nil || target.Kind != HISTORY_CHANGE:
+			// not a change made here
+		case entry.Kind == HISTORY_UNDO:
+			var ok bool
+			if stacks.done, ok = removeEntry(stacks.done, target); ok {
+				target.Undone = true
+				stacks.undone = append(stacks.undone, target)
+			}
+		case entry.Kind == HISTORY_REDO:
+			var ok bool
+			if stacks.undone, ok = removeEntry(stacks.undone, target); ok {
+				target.Undone = false
+				stacks.done = append(stacks.done, target)
+			}
+		}
+	}
+
+	return entries, stacks, nil
+}
+
+// the last n commits made by dstask, newest first, or all of them if n is 0
+func (s *GitStore) History(n int) ([]*HistoryEntry, error) {
+	repo, err := s.openRepo()
+	if err != nil {
+		return nil, err
+	}
+
+	entries, _, err := s.history(repo, historyLimit{entries: n})
+	if n > 0 && n < len(entries) {
+		entries = entries[:n]
+	}
+
+	return entries, err
+}
+
+// undo the last n changes, newest first, with a commit each. Changes already
+// pushed are only undone with force, as other machines may have built on
+// them.
+func (s *GitStore) Undo(n int, force bool) error {
+	repo, err := s.openRepo()
+	if err != nil {
+		return err
+	}
+
+	_, stacks, err := s.history(repo, historyLimit{changes: n})
+	if err != nil {
+		return err
+	}
+
+	if len(stacks.done) == 0 {
+		return InvalidInput("Nothing to undo")
+	}
+
+	if n > len(stacks.done) {
+		return InvalidInput("Only %d changes can be undone", len(stacks.done))
+	}
+
+	var changes []*HistoryEntry
+	for i := len(stacks.done) - 1; i >= len(stacks.done)-n; i-- {
+		changes = append(changes, stacks.done[i])
+	}
+
+	for _, change := range changes {
+		if change.Pushed && !force {
+			return InvalidInput("%s has already been pushed, use --force to undo it anyway", change)
+		}
+	}
+
+	for _, change := range changes {
+		msg := fmt.Sprintf("Revert %q", change.Summary)
+		trailer := fmt.Sprintf("This reverts commit %s.", change.Hash)
+
+		if err := s.applyChange(repo, change.commit, true, msg, trailer); err != nil {
+			return err
+		}
+	}
+
+	// a task brought back may have had its ID taken since
+	return resolveIDConflicts(s)
+}
+
+// redo the last n undone changes, in the reverse order they were undone. Only
+// possible until another change is made.
+func (s *GitStore) Redo(n int) error {
+	repo, err := s.openRepo()
+	if err != nil {
+		return err
+	}
+
+	_, stacks, err := s.history(repo, historyLimit{redo: true})
+	if err != nil {
+		return err
+	}
+
+	if len(stacks.undone) == 0 {
+		return InvalidInput("Nothing to redo")
+	}
+
+	if n > len(stacks.undone) {
+		return InvalidInput("Only %d changes can be redone", len(stacks.undone))
+	}
+
+	for i := len(stacks.undone) - 1; i >= len(stacks.undone)-n; i-- {
+		change := stacks.undone[i]
+		msg := fmt.Sprintf("Redo %q", change.Summary)
+		trailer := fmt.Sprintf("This reapplies commit %s.", change.Hash)
+
+		if err := s.applyChange(repo, change.commit, false, msg, trailer); err != nil {
+			return err
+		}
+	}
+
+	return resolveIDConflicts(s)
+}
+
+// apply the changes of a commit to HEAD, or reverse them, and commit. Each
+// file the commit changed must be as the commit left it, or the change is
+// reported as a conflict and nothing is written. Files already as they would
+// be are left, and there is no commit if that is all of them.
+func (s *GitStore) applyChange(repo *git.Repository, c *object.Commit, reverse bool, msg, trailer string) error {
+	args := []string{"revert", c.Hash.String()}
+
+	head, err := resolveCommit(repo, plumbing.HEAD)
+	if err != nil {
+		return err
+	}
+
+	headTree, err := head.Tree()
+	if err != nil {
+		return &GitError{Args: args, Err: err}
+	}
+
+	tree, err := c.Tree()
+	if err != nil {
+		return &GitError{Args: args, Err: err}
+	}
+
+	var parentTree *object.Tree
+	if c.NumParents() > 0 {
+		parent, err := c.Parent(0)
+		if err == nil {
+			parentTree, err = parent.Tree()
+		}
+		if err != nil {
+			return &GitError{Args: args, Err: err}
+		}
+	}
+
+	fromTree, toTree := parentTree, tree
+	if reverse {
+		fromTree, toTree = tree, parentTree
+	}
+
+	from, err := treeFiles(fromTree)
+	if err != nil {
+		return &GitError{Args: args, Err: err}
+	}
+
+	to, err := treeFiles(toTree)
+	if err != nil {
+		return &GitError{Args: args, Err: err}
+	}
+
+	current, err := treeFiles(headTree)
+	if err != nil {
+		return &GitError{Args: args, Err: err}
+	}
+
+	var keys []string
+	for _, files := range []map[string]*treeFile{from, to} {
+		for key := range files {
+			if !StrSliceContains(keys, key) && !sameTreeFile(from[key], to[key]) {
+				keys = append(keys, key)
+			}
+		}
+	}
+	sort.Strings(keys)
+
+	// relative path to new contents, or nil to remove
+	writes := make(map[string][]byte)
+	var conflicts []string
+
+	for _, key := range keys {
+		f, t, h := from[key], to[key], current[key]
+
+		switch {
+		case sameTreeFile(h, t):
+			// already done
+		case sameTreeFile(h, f):
+			if h != nil {
+				writes[h.path] = nil
+			}
+
+			if t != nil {
+				contents, err := t.file.Contents()
+				if err != nil {
+					return &GitError{Args: []string{"show", t.path}, Err: err}
+				}
+				writes[t.path] = []byte(contents)
+			}
+		case h == nil:
+			conflicts = append(conflicts, key+" (removed)")
+		case key == h.path:
+			// not a task
+			conflicts = append(conflicts, key)
+		default:
+			task, err := h.task()
+			if err != nil {
+				return err
+			}
+			conflicts = append(conflicts, task.String())
+		}
+	}
+
+	if len(conflicts) > 0 {
+		return fmt.Errorf("%w %s %q: %s", ErrConflict, c.Hash.String()[:7], commitSubject(c), strings.Join(conflicts, ", "))
+	}
+
+	if len(writes) == 0 {
+		fmt.Printf("\nNothing to change for %q, it is already as it would be\n", commitSubject(c))
+		return nil
+	}
+
+	if err := s.writeFiles(writes); err != nil {
+		return err
+	}
+
+	fmt.Printf("\n%s\n", msg)
+
+	if _, err := stageAll(repo); err != nil {
+		return err
+	}
+
+	return s.commit(repo, msg+"\n\n"+trailer+"\n")
+}
@@ -0,0 +1,210 @@
+package dstask
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+// save the task and commit it with the given message
+func commitTask(t *testing.T, store *GitStore, task Task, msg string) {
+	if err := store.Save(task); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Commit(msg); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// the summary of the task as stored, or "" if it is not
+func storedSummary(t *testing.T, store *GitStore, uuid string) string {
+	tasks, err := store.Load(ALL_STATUSES)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, task := range tasks {
+		if task.UUID == uuid {
+			return task.Summary
+		}
+	}
+
+	return ""
+}
+
+func headHash(t *testing.T, store *GitStore) plumbing.Hash {
+	repo, err := store.openRepo()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return head.Hash()
+}
+
+func TestUndoRedo(t *testing.T) {
+	store, cleanup := newTestGitStore(t)
+	defer cleanup()
+
+	task := testTask(1, 1, time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC))
+	commitTask(t, store, task, "Added 1: task 1")
+
+	task.Summary = "Fix the gate"
+	commitTask(t, store, task, "Modified 1: Fix the gate")
+	changed := headHash(t, store)
+
+	if err := store.Undo(1, false); err != nil {
+		t.Fatal(err)
+	}
+
+	if summary := storedSummary(t, store, task.UUID); summary != "task 1" {
+		t.Errorf("undone to %q", summary)
+	}
+
+	if msg := lastCommitMessage(t, store); !strings.Contains(msg, fmt.Sprintf("This reverts commit %s.", changed)) {
+		t.Errorf("undone with %q", msg)
+	}
+
+	if err := store.Redo(1); err != nil {
+		t.Fatal(err)
+	}
+
+	if summary := storedSummary(t, store, task.UUID); summary != "Fix the gate" {
+		t.Errorf("redone to %q", summary)
+	}
+
+	if msg := lastCommitMessage(t, store); !strings.Contains(msg, fmt.Sprintf("This reapplies commit %s.", changed)) {
+		t.Errorf("redone with %q", msg)
+	}
+
+	entries, err := store.History(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var kinds []string
+	for _, entry := range entries {
+		kinds = append(kinds, entry.Kind)
+	}
+
+	if got := strings.Join(kinds, " "); got != "redo undo change change" {
+		t.Errorf("history %s", got)
+	}
+
+	if err := store.Redo(1); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("redone twice, %v", err)
+	}
+}
+
+// undos made by git revert, or by older versions of dstask, which undid an
+// undo to redo a change
+func TestHistoryTrailers(t *testing.T) {
+	store, cleanup := newTestGitStore(t)
+	defer cleanup()
+
+	task := testTask(1, 1, time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC))
+	commitTask(t, store, task, "Added 1: task 1")
+	added := headHash(t, store)
+
+	task.Summary = "task one"
+	commitTask(t, store, task, fmt.Sprintf("Revert \"Added 1: task 1\"\n\nThis reverts commit %s.\n", added))
+	undo := headHash(t, store)
+
+	task.Summary = "task 1"
+	commitTask(t, store, task, fmt.Sprintf("Revert \"Revert\"\n\nThis reverts commit %s.\n", undo))
+
+	entries, err := store.History(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo, err := store.openRepo()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, stacks, err := store.history(repo, historyLimit{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 3 || entries[0].Kind != HISTORY_REDO || entries[1].Kind != HISTORY_UNDO {
+		t.Fatalf("history %v", entries)
+	}
+
+	if len(stacks.done) != 1 || stacks.done[0].Hash != added.String() || len(stacks.undone) != 0 {
+		t.Errorf("done %v and undone %v, want the first change done", stacks.done, stacks.undone)
+	}
+}
+
+func TestUndoPushed(t *testing.T) {
+	store, cleanup := newTestGitStore(t)
+	defer cleanup()
+
+	task := testTask(1, 1, time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC))
+	commitTask(t, store, task, "Added 1: task 1")
+
+	repo, err := store.openRepo()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ref := plumbing.NewHashReference(plumbing.NewRemoteReferenceName("origin", "master"), headHash(t, store))
+	if err := repo.Storer.SetReference(ref); err != nil {
+		t.Fatal(err)
+	}
+
+	err = store.Undo(1, false)
+	if !errors.Is(err, ErrInvalidInput) || !strings.Contains(err.Error(), "--force") {
+		t.Fatalf("undid a pushed change, %v", err)
+	}
+
+	if storedSummary(t, store, task.UUID) == "" {
+		t.Errorf("task removed without --force")
+	}
+
+	if err := store.Undo(1, true); err != nil {
+		t.Fatal(err)
+	}
+
+	if storedSummary(t, store, task.UUID) != "" {
+		t.Errorf("task kept with --force")
+	}
+}
+
+func TestUndoConflict(t *testing.T) {
+	store, cleanup := newTestGitStore(t)
+	defer cleanup()
+
+	task := testTask(1, 1, time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC))
+	commitTask(t, store, task, "Added 1: task 1")
+
+	// changed since, by a commit that is not a dstask change as it touches
+	// another file too
+	task.Summary = "Fix the gate"
+	if err := ioutil.WriteFile(filepath.Join(store.Repo, "README"), []byte("tasks\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	commitTask(t, store, task, "Edited by hand")
+	head := headHash(t, store)
+
+	err := store.Undo(1, false)
+	if !errors.Is(err, ErrConflict) || !strings.Contains(err.Error(), "1: Fix the gate") {
+		t.Fatalf("undo returned %v, want a conflict on the task", err)
+	}
+
+	if headHash(t, store) != head || storedSummary(t, store, task.UUID) != "Fix the gate" {
+		t.Errorf("conflicting undo changed the repository")
+	}
+}
@@ -0,0 +1,230 @@
+package dstask
+
+// iCalendar (RFC 5545) export of tasks as VTODO components, for calendar
+// applications:
+//
+//   dstask export-ical +work > work.ics
+//
+// Priorities P0 to P3 are 1, 3, 5 and 9 on the 1-9 scale, where 1 to 4 are
+// high, 5 medium and 6 to 9 low. Active tasks are IN-PROCESS, resolved tasks
+// COMPLETED and any others NEEDS-ACTION. Due dates at the end of a day, as
+// given without a time, are written as dates.
+//
+// If ICAL_DIR is set, commands that change tasks rewrite ICAL_DIR/dstask.ics
+// with the open tasks of the whole repository, whatever the context, so a
+// calendar application can subscribe to it.
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	ICAL_DATETIME  = "20060102T150405Z"
+	ICAL_DATE      = "20060102"
+	ICAL_FEED_FILE = "dstask.ics"
+	// longer content lines are folded, in bytes excluding the line break
+	ICAL_LINE_LENGTH = 75
+)
+
+var icalPriorities = map[string]int{
+	PRIORITY_CRITICAL: 1,
+	PRIORITY_HIGH:     3,
+	PRIORITY_NORMAL:   5,
+	PRIORITY_LOW:      9,
+}
+
+// escapes of TEXT values. \r\n before \n, so it is one line break.
+var icalEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	";", `\;`,
+	",", `\,`,
+	"\r\n", `\n`,
+	"\n", `\n`,
+)
+
+func icalTime(t time.Time) string {
+	return t.UTC().Format(ICAL_DATETIME)
+}
+
+func icalStatus(status string) string {
+	switch status {
+	case STATUS_ACTIVE:
+		return "IN-PROCESS"
+	case STATUS_RESOLVED:
+		return "COMPLETED"
+	default:
+		return "NEEDS-ACTION"
+	}
+}
+
+// fold a content line so no line is longer than ICAL_LINE_LENGTH bytes,
+// without splitting a character. Continuation lines start with a space.
+func foldICalLine(line string) string {
+	var b strings.Builder
+	n := 0
+
+	for _, r := range line {
+		size := utf8.RuneLen(r)
+		if n+size > ICAL_LINE_LENGTH {
+			b.WriteString("\r\n ")
+			n = 1
+		}
+
+		b.WriteRune(r)
+		n += size
+	}
+
+	b.WriteString("\r\n")
+	return b.String()
+}
+
+// writes content lines, keeping the first error so callers need only check
+// once at the end
+type icalWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (iw *icalWriter) line(name, value string) {
+	if iw.err != nil {
+		return
+	}
+
+	_, iw.err = io.WriteString(iw.w, foldICalLine(name+":"+value))
+}
+
+// write the task as a VTODO. now is the DTSTAMP of tasks never saved.
+func (task *Task) writeVTodo(iw *icalWriter, now time.Time) {
+	stamp := task.Modified
+	if stamp.IsZero() {
+		stamp = task.Created
+	}
+	if stamp.IsZero() {
+		stamp = now
+	}
+
+	iw.line("BEGIN", "VTODO")
+	iw.line("UID", task.UUID)
+	iw.line("DTSTAMP", icalTime(stamp))
+
+	if !task.Created.IsZero() {
+		iw.line("CREATED", icalTime(task.Created))
+	}
+
+	if !task.Modified.IsZero() {
+		iw.line("LAST-MODIFIED", icalTime(task.Modified))
+	}
+
+	iw.line("SUMMARY", icalEscaper.Replace(task.Summary))
+
+	if task.Notes != "" {
+		iw.line("DESCRIPTION", icalEscaper.Replace(task.Notes))
+	}
+
+	if !task.Due.IsZero() {
+		due := task.Due.Local()
+		if due.Equal(endOfDay(due)) {
+			iw.line("DUE;VALUE=DATE", due.Format(ICAL_DATE))
+		} else {
+			iw.line("DUE", icalTime(due))
+		}
+	}
+
+	if priority, ok := icalPriorities[task.Priority]; ok {
+		iw.line("PRIORITY", fmt.Sprint(priority))
+	}
+
+	iw.line("STATUS", icalStatus(task.Status))
+
+	if task.Status == STATUS_RESOLVED && !task.Resolved.IsZero() {
+		iw.line("COMPLETED", icalTime(task.Resolved))
+	}
+
+	if len(task.Tags) > 0 {
+		var categories []string
+		for _, tag := range task.Tags {
+			categories = append(categories, icalEscaper.Replace(tag))
+		}
+		iw.line("CATEGORIES", strings.Join(categories, ","))
+	}
+
+	iw.line("END", "VTODO")
+}
+
+// write the tasks of the set as an iCalendar file
+func (ts *TaskSet) ExportICal(w io.Writer) error {
+	iw := &icalWriter{w: w}
+	now := time.Now()
+
+	iw.line("BEGIN", "VCALENDAR")
+	iw.line("VERSION", "2.0")
+	iw.line("PRODID", "-//dstask//dstask//EN")
+
+	for _, task := range ts.tasks {
+		task.writeVTodo(iw, now)
+	}
+
+	iw.line("END", "VCALENDAR")
+	return iw.err
+}
+
+// rewrite the feed in ICAL_DIR from the open tasks of the store. Does nothing
+// if ICAL_DIR is not set.
+func WriteICalFeed(store Store) error {
+	if ICAL_DIR == "" {
+		return nil
+	}
+
+	ts, err := LoadTaskSet(store, NON_RESOLVED_STATUSES)
+	if err != nil {
+		return err
+	}
+
+	return ts.writeICalFeed()
+}
+
+// rewrite the feed in ICAL_DIR from the open tasks of the set, filtered or
+// not. The set must have been loaded with every open status.
+func (ts *TaskSet) writeICalFeed() error {
+	if ICAL_DIR == "" {
+		return nil
+	}
+
+	feed := &TaskSet{}
+	for _, task := range ts.tasksByUUID {
+		// templates are not things to do, their instances are
+		if task.Status != STATUS_RESOLVED && task.Status != STATUS_RECURRING {
+			feed.tasks = append(feed.tasks, task)
+		}
+	}
+
+	// as loaded, so the file only changes when tasks do
+	sort.Slice(feed.tasks, func(i, j int) bool {
+		a, b := feed.tasks[i], feed.tasks[j]
+		return a.Created.Before(b.Created) || a.Created.Equal(b.Created) && a.UUID < b.UUID
+	})
+
+	var buf bytes.Buffer
+	if err := feed.ExportICal(&buf); err != nil {
+		return err
+	}
+
+	dir := MustExpandHome(ICAL_DIR)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("Failed to write iCalendar feed: %w", err)
+	}
+
+	if err := WriteFileAtomic(filepath.Join(dir, ICAL_FEED_FILE), buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("Failed to write iCalendar feed: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,129 @@
+package dstask
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestICalEscaper(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"Fix the gate", "Fix the gate"},
+		{"Call Bob; then Alice, maybe", `Call Bob\; then Alice\, maybe`},
+		{`C:\temp`, `C:\\temp`},
+		{"one\ntwo\r\nthree", `one\ntwo\nthree`},
+		{`\n`, `\\n`},
+	}
+
+	for _, test := range tests {
+		if got := icalEscaper.Replace(test.text); got != test.want {
+			t.Errorf("%q escaped as %q, want %q", test.text, got, test.want)
+		}
+	}
+}
+
+func TestFoldICalLine(t *testing.T) {
+	long := strings.Repeat("a", ICAL_LINE_LENGTH)
+	// a two byte character that would end one byte past the limit
+	straddle := strings.Repeat("a", ICAL_LINE_LENGTH-1) + "é"
+
+	tests := []struct {
+		name string
+		line string
+		want string
+	}{
+		{"short", "SUMMARY:Fix the gate", "SUMMARY:Fix the gate\r\n"},
+		{"at the limit", long, long + "\r\n"},
+		{"over the limit", long + "bc", long + "\r\n bc\r\n"},
+		{"multibyte", straddle, straddle[:ICAL_LINE_LENGTH-1] + "\r\n é\r\n"},
+		{
+			"several folds",
+			strings.Repeat("x", 3*ICAL_LINE_LENGTH),
+			strings.Repeat("x", ICAL_LINE_LENGTH) + "\r\n " +
+				strings.Repeat("x", ICAL_LINE_LENGTH-1) + "\r\n " +
+				strings.Repeat("x", ICAL_LINE_LENGTH-1) + "\r\n xx\r\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := foldICalLine(test.line)
+
+			if got != test.want {
+				t.Errorf("folded to %q, want %q", got, test.want)
+			}
+
+			for _, line := range strings.Split(strings.TrimSuffix(got, "\r\n"), "\r\n") {
+				if len(line) > ICAL_LINE_LENGTH {
+					t.Errorf("line of %d bytes", len(line))
+				}
+			}
+		})
+	}
+}
+
+func TestExportICal(t *testing.T) {
+	created := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	task := testTask(1, 1, created)
+	task.Summary = "Call the bank, then the council"
+	task.Notes = "account 1234\nask about fees"
+	task.Tags = []string{"phone", "money"}
+	task.Priority = PRIORITY_HIGH
+	task.Status = STATUS_ACTIVE
+	task.Modified = created.Add(time.Hour)
+	task.Due = endOfDay(time.Date(2026, 3, 4, 0, 0, 0, 0, time.Local))
+
+	resolved := testTask(2, 0, created)
+	resolved.Status = STATUS_RESOLVED
+	resolved.Resolved = created.Add(2 * time.Hour)
+	resolved.Due = time.Date(2026, 3, 2, 9, 30, 0, 0, time.UTC)
+
+	ts, err := LoadTaskSet(NewMemoryStore(task, resolved), ALL_STATUSES)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := ts.ExportICal(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	want := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//dstask//dstask//EN",
+		"BEGIN:VTODO",
+		"UID:" + testUUID(1),
+		"DTSTAMP:20260301T130000Z",
+		"CREATED:20260301T120000Z",
+		"LAST-MODIFIED:20260301T130000Z",
+		`SUMMARY:Call the bank\, then the council`,
+		`DESCRIPTION:account 1234\nask about fees`,
+		"DUE;VALUE=DATE:20260304",
+		"PRIORITY:3",
+		"STATUS:IN-PROCESS",
+		"CATEGORIES:money,phone",
+		"END:VTODO",
+		"BEGIN:VTODO",
+		"UID:" + testUUID(2),
+		"DTSTAMP:20260301T120000Z",
+		"CREATED:20260301T120000Z",
+		"SUMMARY:task 2",
+		"DUE:20260302T093000Z",
+		"PRIORITY:5",
+		"STATUS:COMPLETED",
+		"COMPLETED:20260301T140000Z",
+		"END:VTODO",
+		"END:VCALENDAR",
+		"",
+	}, "\r\n")
+
+	if buf.String() != want {
+		t.Errorf("exported\n%s\nwant\n%s", buf.String(), want)
+	}
+}
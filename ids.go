@@ -0,0 +1,136 @@
+package dstask
+
+// IDs are stored with each task so they stay the same between commands. Two
+// machines adding tasks offline can pick the same ID; after a sync the older
+// task keeps it and the newer is renumbered, the same way on every machine.
+
+// A task can also be addressed by a prefix of its UUID, for when an ID is
+// not known to be stable. Words that look like a prefix but match no open
+// task, such as cafe1, are text.
+
+import (
+	"fmt"
+	"strings"
+)
+
+// UUID prefixes must be this long to be distinguished from text
+const MIN_UUID_PREFIX_LEN = 4
+
+type IDConflict struct {
+	// the ID in the task file, now held by an older task
+	OldID int
+	UUID  string
+}
+
+// a UUID prefix has a digit and a letter, so numbers are IDs and most words
+// are text
+func IsUUIDPrefix(str string) bool {
+	var digit, letter bool
+
+	if len(str) < MIN_UUID_PREFIX_LEN || len(str) > 36 {
+		return false
+	}
+
+	for _, c := range strings.ToLower(str) {
+		switch {
+		case c >= '0' && c <= '9':
+			digit = true
+		case c >= 'a' && c <= 'f':
+			letter = true
+		case c == '-':
+		default:
+			return false
+		}
+	}
+
+	return digit && letter
+}
+
+// the open tasks whose UUID starts with the prefix
+func (ts *TaskSet) withUUIDPrefix(prefix string) []*Task {
+	var matches []*Task
+	prefix = strings.ToLower(prefix)
+
+	for _, task := range ts.tasks {
+		if task.ID > 0 && strings.HasPrefix(task.UUID, prefix) {
+			matches = append(matches, task)
+		}
+	}
+
+	return matches
+}
+
+func (ts *TaskSet) GetByUUIDPrefix(prefix string) (Task, error) {
+	matches := ts.withUUIDPrefix(prefix)
+
+	if len(matches) == 0 {
+		return Task{}, fmt.Errorf("%w: no open task with UUID prefix %s exists", ErrTaskNotFound, prefix)
+	}
+
+	if len(matches) > 1 {
+		return Task{}, InvalidInput("UUID prefix %s is ambiguous, it matches %s and %s", prefix, matches[0], matches[1])
+	}
+
+	return *matches[0], nil
+}
+
+// replace the UUID prefixes in the command line with the IDs of the tasks
+// they match
+func (ts *TaskSet) ResolveUUIDPrefixes(cmdLine *CmdLine) error {
+	for i, prefix := range cmdLine.UUIDPrefixes {
+		task, err := ts.GetByUUIDPrefix(prefix)
+		if err != nil {
+			return err
+		}
+
+		cmdLine.IDs[i] = task.ID
+	}
+
+	cmdLine.UUIDPrefixes = nil
+	return nil
+}
+
+// parse the command line, taking only words that are a prefix of the UUID of
+// an open task as UUID prefixes, and replace them with the IDs of the tasks
+func (ts *TaskSet) ParseCmdLine(args ...string) (CmdLine, error) {
+	cmdLine := parseCmdLine(args, func(word string) bool {
+		return IsUUIDPrefix(word) && len(ts.withUUIDPrefix(word)) > 0
+	})
+
+	if err := ts.ResolveUUIDPrefixes(&cmdLine); err != nil {
+		return CmdLine{}, err
+	}
+
+	return cmdLine, nil
+}
+
+// tasks renumbered on load as their ID was taken by an older task
+func (ts *TaskSet) IDConflicts() []IDConflict {
+	return ts.idConflicts
+}
+
+func (conflict IDConflict) describe(ts *TaskSet) string {
+	return fmt.Sprintf("ID %d is also used by older task %s, renumbered %s", conflict.OldID, ts.tasksByID[conflict.OldID], ts.tasksByUUID[conflict.UUID])
+}
+
+// load tasks and commit the renumbering of any with conflicting IDs, for
+// instance after a sync. A notice is printed for each.
+func resolveIDConflicts(store Store) error {
+	ts, err := LoadTaskSet(store, NON_RESOLVED_STATUSES)
+	if err != nil {
+		return err
+	}
+
+	conflicts := ts.IDConflicts()
+	if len(conflicts) == 0 {
+		return nil
+	}
+
+	var names []string
+	for _, conflict := range conflicts {
+		fmt.Println(conflict.describe(ts))
+		names = append(names, ts.tasksByUUID[conflict.UUID].String())
+	}
+
+	return ts.SaveToDisk("Renumbered %s", strings.Join(names, ", "))
+}
@@ -0,0 +1,202 @@
+package dstask
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// a valid UUID4 that sorts and reads in the order of n
+func testUUID(n int) string {
+	return fmt.Sprintf("00000000-0000-4000-8000-%012d", n)
+}
+
+func testTask(n, id int, created time.Time) Task {
+	return Task{
+		UUID:     testUUID(n),
+		ID:       id,
+		Status:   STATUS_PENDING,
+		Summary:  fmt.Sprintf("task %d", n),
+		Priority: PRIORITY_NORMAL,
+		Created:  created,
+	}
+}
+
+func TestLoadTaskSetIDConflicts(t *testing.T) {
+	day := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		tasks []Task
+		// expected ID by task number
+		ids       map[int]int
+		conflicts []IDConflict
+	}{
+		{
+			name: "no conflicts",
+			tasks: []Task{
+				testTask(1, 1, day),
+				testTask(2, 2, day.Add(time.Hour)),
+			},
+			ids: map[int]int{1: 1, 2: 2},
+		},
+		{
+			name: "newer task renumbered",
+			tasks: []Task{
+				testTask(1, 3, day.Add(time.Hour)),
+				testTask(2, 3, day),
+			},
+			ids:       map[int]int{1: 1, 2: 3},
+			conflicts: []IDConflict{{OldID: 3, UUID: testUUID(1)}},
+		},
+		{
+			// the renumbered task must not take the ID stored by a newer
+			// task, or that one would be renumbered in turn
+			name: "no cascade",
+			tasks: []Task{
+				testTask(1, 5, day),
+				testTask(2, 5, day.Add(time.Hour)),
+				testTask(3, 1, day.Add(2*time.Hour)),
+			},
+			ids:       map[int]int{1: 5, 2: 2, 3: 1},
+			conflicts: []IDConflict{{OldID: 5, UUID: testUUID(2)}},
+		},
+		{
+			name: "tasks without an ID numbered last",
+			tasks: []Task{
+				testTask(1, 0, day),
+				testTask(2, 1, day.Add(time.Hour)),
+			},
+			ids: map[int]int{1: 2, 2: 1},
+		},
+		{
+			name: "resolved tasks keep no ID",
+			tasks: []Task{
+				func() Task {
+					task := testTask(1, 0, day)
+					task.Status = STATUS_RESOLVED
+					task.Resolved = day
+					return task
+				}(),
+				testTask(2, 1, day.Add(time.Hour)),
+			},
+			ids: map[int]int{1: 0, 2: 1},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ts, err := LoadTaskSet(NewMemoryStore(test.tasks...), ALL_STATUSES)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for n, id := range test.ids {
+				if got := ts.tasksByUUID[testUUID(n)].ID; got != id {
+					t.Errorf("task %d has ID %d, want %d", n, got, id)
+				}
+			}
+
+			conflicts := ts.IDConflicts()
+			if fmt.Sprint(conflicts) != fmt.Sprint(test.conflicts) {
+				t.Errorf("conflicts %v, want %v", conflicts, test.conflicts)
+			}
+
+			// loaded oldest first
+			for i := 1; i < len(ts.tasks); i++ {
+				if ts.tasks[i].Created.Before(ts.tasks[i-1].Created) {
+					t.Errorf("task %s loaded before older task %s", ts.tasks[i-1].UUID, ts.tasks[i].UUID)
+				}
+			}
+		})
+	}
+}
+
+func TestResolveIDConflicts(t *testing.T) {
+	day := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	store := NewMemoryStore(testTask(1, 1, day), testTask(2, 1, day.Add(time.Hour)))
+
+	if err := resolveIDConflicts(store); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(store.Commits) != 1 || !strings.HasPrefix(store.Commits[0], "Renumbered ") {
+		t.Fatalf("commits %q, want one renumbering", store.Commits)
+	}
+
+	// stored, so there is nothing to resolve the next time
+	ts, err := LoadTaskSet(store, NON_RESOLVED_STATUSES)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ts.IDConflicts()) != 0 {
+		t.Errorf("conflicts %v after resolving", ts.IDConflicts())
+	}
+
+	if id := ts.tasksByUUID[testUUID(2)].ID; id != 2 {
+		t.Errorf("renumbered task has ID %d, want 2", id)
+	}
+
+	if err := resolveIDConflicts(store); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(store.Commits) != 1 {
+		t.Errorf("commits %q, want no more", store.Commits)
+	}
+}
+
+func TestTaskSetParseCmdLine(t *testing.T) {
+	day := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	tea := testTask(1, 3, day)
+	tea.UUID = "b00c5e7a-0000-4000-8000-000000000001"
+	toast := testTask(2, 4, day)
+	toast.UUID = "b00c5e7b-0000-4000-8000-000000000002"
+
+	ts, err := LoadTaskSet(NewMemoryStore(tea, toast), NON_RESOLVED_STATUSES)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		args    []string
+		wantIDs []int
+		// the text, or the error if empty
+		wantText string
+	}{
+		{[]string{"b00c5e7a", "note", "brewed"}, []int{3}, "brewed"},
+		{[]string{"B00C5E7B", "4", "done"}, []int{4, 4}, ""},
+		// look like prefixes but match no task
+		{[]string{"add", "cafe1", "latte"}, nil, "cafe1 latte"},
+		{[]string{"add", "2fa0", "reset"}, nil, "2fa0 reset"},
+		{[]string{"b00c5e7", "done"}, nil, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(strings.Join(test.args, " "), func(t *testing.T) {
+			cmdLine, err := ts.ParseCmdLine(test.args...)
+
+			if test.wantText == "" && test.wantIDs == nil {
+				if err == nil {
+					t.Errorf("ambiguous prefix parsed as %v", cmdLine.IDs)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if fmt.Sprint(cmdLine.IDs) != fmt.Sprint(test.wantIDs) || cmdLine.Text != test.wantText {
+				t.Errorf("parsed IDs %v and text %q, want %v and %q", cmdLine.IDs, cmdLine.Text, test.wantIDs, test.wantText)
+			}
+
+			if len(cmdLine.UUIDPrefixes) != 0 {
+				t.Errorf("unresolved prefixes %v", cmdLine.UUIDPrefixes)
+			}
+		})
+	}
+}
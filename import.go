@@ -1,15 +1,19 @@
 package dstask
 
-// import tasks from taskwarrior
+// import tasks from taskwarrior, and export them back so the two can be used
+// side by side
 
 // see https://taskwarrior.org/docs/design/task.html
 
-// usage: task export | dstask import
+// usage: task export | dstask import-tw
+//        dstask export-tw | task import
 // Filters can be used in taskwarrior to specify a subset.
 
 import (
 	"encoding/json"
-	"os"
+	"fmt"
+	"io"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -48,8 +52,8 @@ func (tt *TwTime) UnmarshalJSON(b []byte) error {
 }
 
 type TwAnnotation struct {
-	Description string
-	Entry       string
+	Description string `json:"description"`
+	Entry       string `json:"entry"`
 }
 
 type TwTask struct {
@@ -59,6 +63,7 @@ type TwTask struct {
 	Start       TwTime
 	Modified    TwTime
 	Due         TwTime
+	Wait        TwTime
 	Status      string
 	Project     string
 	Priority    string
@@ -66,6 +71,10 @@ type TwTask struct {
 	Tags        []string
 	UUID        string
 	Annotations []TwAnnotation
+	// recurrence period of a template, eg weekly or 3d
+	Recur string
+	// uuid of the template of an instance
+	Parent string
 }
 
 var priorityMap = map[string]string{
@@ -75,6 +84,44 @@ var priorityMap = map[string]string{
 	"":  PRIORITY_NORMAL,
 }
 
+// the reverse of priorityMap. Normal is no priority, the default in both.
+var twPriorityMap = map[string]string{
+	PRIORITY_CRITICAL: "H",
+	PRIORITY_HIGH:     "H",
+	PRIORITY_NORMAL:   "",
+	PRIORITY_LOW:      "L",
+}
+
+// a task as read by task import. Times are in TwTime format, and left out if
+// not set.
+type TwExportTask struct {
+	UUID        string         `json:"uuid"`
+	Description string         `json:"description"`
+	Status      string         `json:"status"`
+	Entry       string         `json:"entry"`
+	Modified    string         `json:"modified,omitempty"`
+	Start       string         `json:"start,omitempty"`
+	End         string         `json:"end,omitempty"`
+	Due         string         `json:"due,omitempty"`
+	Wait        string         `json:"wait,omitempty"`
+	Project     string         `json:"project,omitempty"`
+	Priority    string         `json:"priority,omitempty"`
+	Depends     string         `json:"depends,omitempty"`
+	Tags        []string       `json:"tags,omitempty"`
+	Annotations []TwAnnotation `json:"annotations,omitempty"`
+	Recur       string         `json:"recur,omitempty"`
+	Parent      string         `json:"parent,omitempty"`
+}
+
+// ISO 8601 basic format, in UTC, as taskwarrior writes
+func formatTwTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	return t.UTC().Format("20060102T150405Z")
+}
+
 func (t *TwTask) ConvertAnnotations() string {
 	var comments []string
 
@@ -97,16 +144,61 @@ func (t *TwTask) ConvertStatus() string {
 	case "deleted":
 		return STATUS_RESOLVED
 	case "waiting":
+		if t.Wait.Time.After(time.Now()) {
+			return STATUS_DEFERRED
+		}
 		return STATUS_PENDING
 	case "recurring":
-		// TODO -- implement reccurence
-		//return STATUS_RECURRING
-		return STATUS_RESOLVED
+		if t.ConvertRecur() == "" {
+			// can't be represented, so stop it recurring
+			return STATUS_RESOLVED
+		}
+		return STATUS_RECURRING
 	default:
 		return t.Status
 	}
 }
 
+// convert a tw recurrence period into a dstask rule, see recur.go. An empty
+// string is returned if there is no equivalent.
+func (t *TwTask) ConvertRecur() string {
+	period := strings.ToLower(t.Recur)
+
+	switch period {
+	case "":
+		return ""
+	case "daily", "day":
+		return RECUR_DAILY
+	case "weekly", "week", "1w", "p1w", "p7d":
+		return RECUR_WEEKLY
+	case "monthly", "month", "1mo", "p1m":
+		return RECUR_MONTHLY
+	case "biweekly", "fortnight", "2w", "p2w":
+		return RECUR_EVERY + ":14"
+	case "weekdays":
+		return RECUR_WEEKLY + ":mon,tue,wed,thu,fri"
+	}
+
+	// N days, in taskwarrior shorthand or ISO 8601
+	period = strings.TrimPrefix(period, "p")
+	for _, suffix := range []string{"days", "day", "d"} {
+		if strings.HasSuffix(period, suffix) {
+			days, err := strconv.Atoi(strings.TrimSuffix(period, suffix))
+			if err != nil || days < 1 {
+				return ""
+			}
+
+			if days == 1 {
+				return RECUR_DAILY
+			}
+
+			return RECUR_EVERY + ":" + strconv.Itoa(days)
+		}
+	}
+
+	return ""
+}
+
 // resolved time is not tracked. Give best guess.
 func (t *TwTask) GetResolvedTime() time.Time {
 	if t.Status == "completed" {
@@ -116,19 +208,31 @@ func (t *TwTask) GetResolvedTime() time.Time {
 	}
 }
 
-func (ts *TaskSet) ImportFromTaskwarrior() error {
+// import the tasks of a taskwarrior export, read from stdin by import-tw
+func (ts *TaskSet) ImportFromTaskwarrior(r io.Reader) error {
 	var twtasks []TwTask
-	// from stdin
-	err := json.NewDecoder(os.Stdin).Decode(&twtasks)
+	err := json.NewDecoder(r).Decode(&twtasks)
 
 	if err != nil {
-		ExitFail("Failed to decode JSON from stdin")
+		return InvalidInput("Failed to decode JSON from stdin: %s", err)
 	}
 
 	for _, twTask := range twtasks {
-		ts.AddTask(Task{
+		status := twTask.ConvertStatus()
+		var recur string
+		var deferredUntil time.Time
+
+		if status == STATUS_RECURRING {
+			recur = twTask.ConvertRecur()
+		}
+
+		if status == STATUS_DEFERRED {
+			deferredUntil = twTask.Wait.Time
+		}
+
+		_, err := ts.AddTask(Task{
 			UUID:         twTask.UUID,
-			Status:       twTask.ConvertStatus(),
+			Status:       status,
 			WritePending: true,
 			Summary:      twTask.Description,
 			Tags:         twTask.Tags,
@@ -140,8 +244,168 @@ func (ts *TaskSet) ImportFromTaskwarrior() error {
 			Created:      twTask.Entry.Time,
 			Resolved:     twTask.GetResolvedTime(),
 			Due:          twTask.Due.Time,
+			Recur:        recur,
+			Parent:       twTask.Parent,
+			// only set for waiting tasks, see ConvertStatus
+			DeferredUntil: deferredUntil,
 		})
+
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
+
+// convert a dstask recurrence rule into a tw period, the reverse of
+// ConvertRecur. Taskwarrior takes the weekday or day of month from the due
+// date, and only recurs on the calendar, so every:N is approximate. An empty
+// string is returned if there is no equivalent.
+func twRecur(rule string) string {
+	r, err := ParseRecurrence(rule)
+	if err != nil {
+		return ""
+	}
+
+	switch r.Period {
+	case RECUR_DAILY:
+		return "daily"
+	case RECUR_WEEKLY:
+		switch {
+		case len(r.Weekdays) <= 1:
+			return "weekly"
+		case len(r.Weekdays) == 5 && !containsWeekday(r.Weekdays, time.Saturday) && !containsWeekday(r.Weekdays, time.Sunday):
+			return "weekdays"
+		}
+	case RECUR_MONTHLY:
+		return "monthly"
+	case RECUR_EVERY:
+		return fmt.Sprintf("%dd", r.Days)
+	}
+
+	return ""
+}
+
+func containsWeekday(weekdays []time.Weekday, day time.Weekday) bool {
+	for _, wd := range weekdays {
+		if wd == day {
+			return true
+		}
+	}
+
+	return false
+}
+
+// convert a task into the form read by task import. UUIDs are kept, so tasks
+// exported twice update rather than duplicate.
+func NewTwExportTask(task *Task) TwExportTask {
+	tw := TwExportTask{
+		UUID:        task.UUID,
+		Description: task.Summary,
+		Status:      "pending",
+		Entry:       formatTwTime(task.Created),
+		Modified:    formatTwTime(task.Modified),
+		Due:         formatTwTime(task.Due),
+		Project:     task.Project,
+		Priority:    twPriorityMap[task.Priority],
+		Depends:     strings.Join(task.Dependencies, ","),
+		Tags:        task.Tags,
+		Parent:      task.Parent,
+	}
+
+	switch task.Status {
+	case STATUS_ACTIVE:
+		start := task.Modified
+		if task.clockRunning() {
+			start = task.WorkLog[len(task.WorkLog)-1].Start
+		}
+		tw.Start = formatTwTime(start)
+	case STATUS_RESOLVED:
+		tw.Status = "completed"
+		tw.End = formatTwTime(task.Resolved)
+	case STATUS_DEFERRED:
+		if !task.DeferredUntil.IsZero() {
+			tw.Status = "waiting"
+			tw.Wait = formatTwTime(task.DeferredUntil)
+		}
+	case STATUS_RECURRING:
+		tw.Status = "recurring"
+		tw.Recur = twRecur(task.Recur)
+		if tw.Recur == "" {
+			// can't be represented, so stop it recurring, as ConvertStatus
+			// does the other way round. ExportToTaskwarrior leaves it out.
+			tw.Status = "deleted"
+		} else if tw.Due == "" {
+			// taskwarrior recurs from the due date
+			tw.Due = formatTwTime(task.NextRecurrence())
+		}
+	}
+
+	// annotations have no time of their own. Taskwarrior keys them by time,
+	// so each is a second after the last.
+	noted := task.Modified
+	if noted.IsZero() {
+		noted = task.Created
+	}
+
+	var lines []string
+	for _, line := range strings.Split(task.Notes, "\n") {
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	// no equivalent fields
+	for _, st := range task.Subtasks {
+		lines = append(lines, st.String())
+	}
+
+	if task.DelegatedTo != "" {
+		lines = append(lines, "Delegated to "+task.DelegatedTo)
+	}
+
+	for i, line := range lines {
+		tw.Annotations = append(tw.Annotations, TwAnnotation{
+			Description: line,
+			Entry:       formatTwTime(noted.Add(time.Duration(i) * time.Second)),
+		})
+	}
+
+	return tw
+}
+
+// write the tasks of the set as JSON for task import. Templates taskwarrior
+// cannot represent are left out, and their instances exported as tasks that
+// do not recur.
+func (ts *TaskSet) ExportToTaskwarrior(w io.Writer) error {
+	twTasks := []TwExportTask{}
+	templates := make(map[string]bool)
+
+	for _, task := range ts.tasks {
+		if task.Status == STATUS_RECURRING && twRecur(task.Recur) != "" {
+			templates[task.UUID] = true
+		}
+	}
+
+	for _, task := range ts.tasks {
+		if task.Status == STATUS_RECURRING && !templates[task.UUID] {
+			continue
+		}
+
+		tw := NewTwExportTask(task)
+		if !templates[tw.Parent] {
+			tw.Parent = ""
+		}
+
+		twTasks = append(twTasks, tw)
+	}
+
+	data, err := json.MarshalIndent(twTasks, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "%s\n", data)
+	return err
+}
@@ -0,0 +1,254 @@
+package dstask
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// export tasks as task export would and read them back
+func twRoundTrip(t *testing.T, tasks ...Task) []TwExportTask {
+	var exported []TwExportTask
+	for i := range tasks {
+		exported = append(exported, NewTwExportTask(&tasks[i]))
+	}
+
+	data, err := json.Marshal(exported)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// what taskwarrior reads back is what it writes
+	var read []TwExportTask
+	if err := json.Unmarshal(data, &read); err != nil {
+		t.Fatal(err)
+	}
+
+	return read
+}
+
+func TestTaskwarriorRoundTrip(t *testing.T) {
+	day := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	later := day.Add(time.Hour)
+
+	pending := testTask(1, 1, day)
+	pending.Summary = "Fix the gate"
+	pending.Project = "garden"
+	pending.Tags = []string{"weekend"}
+	pending.Priority = PRIORITY_HIGH
+	pending.Due = day.AddDate(0, 0, 3)
+	pending.Notes = "hinge is loose\nbought a hinge"
+	pending.Modified = later
+
+	resolved := testTask(2, 0, day)
+	resolved.Summary = "Call the bank"
+	resolved.Priority = PRIORITY_LOW
+	resolved.Status = STATUS_RESOLVED
+	resolved.Resolved = later
+	resolved.Modified = later
+	resolved.Dependencies = []string{testUUID(1)}
+
+	template := testTask(3, 2, day)
+	template.Summary = "Water the plants"
+	template.Status = STATUS_RECURRING
+	template.Recur = "weekly:mon,tue,wed,thu,fri"
+	template.Due = day
+
+	deferred := testTask(4, 3, day)
+	deferred.Summary = "Paint the fence"
+	deferred.Status = STATUS_DEFERRED
+	deferred.DeferredUntil = time.Now().Add(24 * time.Hour).Truncate(time.Second)
+
+	tasks := []Task{pending, resolved, template, deferred}
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(twRoundTrip(t, tasks...)); err != nil {
+		t.Fatal(err)
+	}
+
+	ts, err := LoadTaskSet(NewMemoryStore(), ALL_STATUSES)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ts.ImportFromTaskwarrior(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range tasks {
+		got := ts.tasksByUUID[want.UUID]
+		if got == nil {
+			t.Errorf("task %s not imported", want.UUID)
+			continue
+		}
+
+		switch {
+		case got.Summary != want.Summary,
+			got.Status != want.Status,
+			got.Project != want.Project,
+			got.Priority != want.Priority,
+			got.Notes != want.Notes,
+			got.Recur != want.Recur,
+			strings.Join(got.Tags, ",") != strings.Join(want.Tags, ","),
+			strings.Join(got.Dependencies, ",") != strings.Join(want.Dependencies, ","),
+			!got.Created.Equal(want.Created),
+			!got.Due.Equal(want.Due),
+			!got.Resolved.Equal(want.Resolved),
+			!got.DeferredUntil.Equal(want.DeferredUntil):
+			t.Errorf("imported %+v, want %+v", *got, want)
+		}
+	}
+}
+
+func TestNewTwExportTask(t *testing.T) {
+	day := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	template := testTask(1, 1, day)
+	template.Status = STATUS_RECURRING
+	template.Recur = "daily"
+	template.Due = day
+
+	tests := []struct {
+		name string
+		task func() Task
+		// status and recurrence period
+		status, recur string
+	}{
+		{"pending", func() Task { return testTask(1, 1, day) }, "pending", ""},
+		{"recurring", func() Task { return template }, "recurring", "daily"},
+		{
+			"recurring without an equivalent",
+			func() Task {
+				task := template
+				task.Recur = "weekly:mon,thu"
+				return task
+			},
+			"deleted", "",
+		},
+		{
+			"deferred without a wake-up time",
+			func() Task {
+				task := testTask(1, 1, day)
+				task.Status = STATUS_DEFERRED
+				return task
+			},
+			"pending", "",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			task := test.task()
+			tw := NewTwExportTask(&task)
+
+			if tw.Status != test.status || tw.Recur != test.recur {
+				t.Errorf("status %s recur %q, want %s recur %q", tw.Status, tw.Recur, test.status, test.recur)
+			}
+		})
+	}
+}
+
+func TestNewTwExportTaskAnnotations(t *testing.T) {
+	task := testTask(1, 1, time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC))
+	task.Notes = "first\n\nsecond\nthird"
+	task.DelegatedTo = "sam"
+
+	tw := NewTwExportTask(&task)
+
+	var descriptions []string
+	entries := make(map[string]bool)
+	for _, annotation := range tw.Annotations {
+		descriptions = append(descriptions, annotation.Description)
+		entries[annotation.Entry] = true
+	}
+
+	if got := strings.Join(descriptions, "|"); got != "first|second|third|Delegated to sam" {
+		t.Errorf("annotations %q", got)
+	}
+
+	// taskwarrior keys annotations by time
+	if len(entries) != len(tw.Annotations) {
+		t.Errorf("annotation times %v are not distinct", entries)
+	}
+}
+
+func TestExportToTaskwarriorRecurrence(t *testing.T) {
+	created := time.Date(2026, 3, 4, 15, 0, 0, 0, time.Local)
+
+	// a template as made by add with recur:, which has no due date, and its
+	// open instance
+	recurring := func(n int, rule string) []Task {
+		template := testTask(n, n, created)
+		template.Status = STATUS_RECURRING
+		template.Recur = rule
+
+		instance := testTask(n+1, n+1, created)
+		instance.Parent = template.UUID
+		return []Task{template, instance}
+	}
+
+	tests := []struct {
+		name  string
+		tasks []Task
+		// status, due and parent of each task exported, by task number
+		want map[int]string
+	}{
+		{
+			name:  "equivalent rule",
+			tasks: recurring(1, "weekly"),
+			want: map[int]string{
+				1: "recurring " + formatTwTime(time.Date(2026, 3, 11, 0, 0, 0, 0, time.Local)) + " ",
+				2: "pending  " + testUUID(1),
+			},
+		},
+		{
+			name:  "no equivalent rule",
+			tasks: recurring(1, "weekly:mon,thu"),
+			want: map[int]string{
+				2: "pending  ",
+			},
+		},
+		{
+			name:  "template not exported",
+			tasks: recurring(1, "daily")[1:],
+			want: map[int]string{
+				2: "pending  ",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ts, err := LoadTaskSet(NewMemoryStore(test.tasks...), ALL_STATUSES)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var buf bytes.Buffer
+			if err := ts.ExportToTaskwarrior(&buf); err != nil {
+				t.Fatal(err)
+			}
+
+			var exported []TwExportTask
+			if err := json.Unmarshal(buf.Bytes(), &exported); err != nil {
+				t.Fatal(err)
+			}
+
+			got := make(map[int]string)
+			for _, tw := range exported {
+				for n := range test.want {
+					if tw.UUID == testUUID(n) {
+						got[n] = tw.Status + " " + tw.Due + " " + tw.Parent
+					}
+				}
+			}
+
+			if len(exported) != len(test.want) || fmt.Sprint(got) != fmt.Sprint(test.want) {
+				t.Errorf("exported %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package dstask
+
+// a cache of parsed task files for the git store, so only files that have
+// changed since the last run are parsed. Entries are keyed by path relative
+// to the repository, and trusted only if the size and modification time still
+// match. The index is kept out of the repository, see INDEX_FILE.
+
+// Concurrent processes each write a complete index to a temporary file then
+// rename it into place, so the worst case is a lost update which costs a
+// re-parse next time. A missing, corrupt or foreign index is ignored.
+
+import (
+	"bytes"
+	"encoding/gob"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// files modified this recently are not cached, as a second write within the
+// filesystem timestamp granularity could leave size and mtime unchanged.
+const INDEX_RACY_WINDOW = 2 * time.Second
+
+type indexEntry struct {
+	ModTime time.Time
+	Size    int64
+	Task    Task
+}
+
+type taskIndex struct {
+	// absolute path of the repository the index belongs to
+	Repo    string
+	Entries map[string]indexEntry
+
+	changed bool
+}
+
+// load the index for the given repository. Never fails; an unusable index
+// is replaced with an empty one.
+func loadTaskIndex(indexFile, repo string) *taskIndex {
+	index := &taskIndex{
+		Repo:    repo,
+		Entries: make(map[string]indexEntry),
+	}
+
+	if indexFile == "" {
+		return index
+	}
+
+	var loaded taskIndex
+	if err := ReadGob(MustExpandHome(indexFile), &loaded); err != nil || loaded.Repo != repo || loaded.Entries == nil {
+		return index
+	}
+
+	return &loaded
+}
+
+// return the cached task for the given file if it is still valid
+func (index *taskIndex) get(relPath string, info os.FileInfo) (Task, bool) {
+	entry, ok := index.Entries[relPath]
+
+	if !ok || entry.Size != info.Size() || !entry.ModTime.Equal(info.ModTime()) {
+		return Task{}, false
+	}
+
+	return entry.Task, true
+}
+
+func (index *taskIndex) put(relPath string, info os.FileInfo, task Task, now time.Time) {
+	if now.Sub(info.ModTime()) < INDEX_RACY_WINDOW {
+		if _, ok := index.Entries[relPath]; ok {
+			delete(index.Entries, relPath)
+			index.changed = true
+		}
+		return
+	}
+
+	index.Entries[relPath] = indexEntry{
+		ModTime: info.ModTime(),
+		Size:    info.Size(),
+		Task:    task,
+	}
+	index.changed = true
+}
+
+// drop entries in the given status directories that were not seen
+func (index *taskIndex) prune(statuses []string, seen map[string]bool) {
+	for relPath := range index.Entries {
+		if seen[relPath] || !StrSliceContains(statuses, filepath.Dir(relPath)) {
+			continue
+		}
+
+		delete(index.Entries, relPath)
+		index.changed = true
+	}
+}
+
+// write the index if it has changed
+func (index *taskIndex) save(indexFile string) error {
+	if indexFile == "" || !index.changed {
+		return nil
+	}
+
+	fp := MustExpandHome(indexFile)
+	if err := os.MkdirAll(filepath.Dir(fp), 0700); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(index); err != nil {
+		return err
+	}
+
+	return WriteFileAtomic(fp, buf.Bytes(), 0600)
+}
+
+// rebuild the index from scratch, parsing every task file
+func (s *GitStore) Reindex() (int, error) {
+	if s.IndexFile == "" {
+		return 0, InvalidInput("No index file is configured")
+	}
+
+	if err := os.Remove(MustExpandHome(s.IndexFile)); err != nil && !os.IsNotExist(err) {
+		return 0, err
+	}
+
+	tasks, err := s.Load(ALL_STATUSES)
+	return len(tasks), err
+}
@@ -0,0 +1,98 @@
+package dstask
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestTaskIndex(t *testing.T) {
+	store, cleanup := newTestGitStore(t)
+	defer cleanup()
+
+	day := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	old := time.Now().Add(-time.Hour)
+
+	path := func(n int) string {
+		fp, err := store.GetRepoPath(STATUS_PENDING, testUUID(n)+".yml")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fp
+	}
+
+	// write the file as given, with the given modification time
+	write := func(n int, data string, modTime time.Time) {
+		if err := ioutil.WriteFile(path(n), []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path(n), modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	summaries := func() map[string]string {
+		tasks, err := store.Load(NON_RESOLVED_STATUSES)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		summaries := make(map[string]string)
+		for _, task := range tasks {
+			summaries[task.UUID] = task.Summary
+		}
+		return summaries
+	}
+
+	for n := 1; n <= 3; n++ {
+		if err := store.Save(testTask(n, n, day)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(1, "summary: gate\n", old)
+	write(2, "summary: post\n", old)
+	// too recent to trust
+	write(3, "summary: bank\n", time.Now())
+
+	summaries()
+
+	index := loadTaskIndex(store.IndexFile, store.Repo)
+	if len(index.Entries) != 2 {
+		t.Fatalf("index has %d entries, want 2", len(index.Entries))
+	}
+
+	// the same size and time, so the index is trusted
+	write(1, "summary: Gate\n", old)
+	write(3, "summary: Bank\n", time.Now())
+	// changed
+	write(2, "summary: posts\n", old)
+
+	got := summaries()
+	if got[testUUID(1)] != "gate" || got[testUUID(2)] != "posts" || got[testUUID(3)] != "Bank" {
+		t.Errorf("loaded %v", got)
+	}
+
+	if err := os.Remove(path(2)); err != nil {
+		t.Fatal(err)
+	}
+	summaries()
+
+	index = loadTaskIndex(store.IndexFile, store.Repo)
+	if _, ok := index.Entries["pending/"+testUUID(2)+".yml"]; ok || len(index.Entries) != 1 {
+		t.Errorf("index has %d entries after removing a file", len(index.Entries))
+	}
+
+	if n, err := store.Reindex(); err != nil || n != 2 {
+		t.Errorf("reindexed %d tasks, %v", n, err)
+	}
+
+	if got := summaries(); got[testUUID(1)] != "Gate" {
+		t.Errorf("loaded %q after reindexing", got[testUUID(1)])
+	}
+
+	// an index of another repository is not used
+	if index := loadTaskIndex(store.IndexFile, store.Repo+"-other"); len(index.Entries) != 0 {
+		t.Errorf("loaded %d entries for another repository", len(index.Entries))
+	}
+}
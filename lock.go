@@ -0,0 +1,104 @@
+package dstask
+
+// crash safe writes and locking between concurrent dstask processes
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// how long to wait for another process to release a lock
+const LOCK_TIMEOUT = 10 * time.Second
+
+// whether the file name is of a temporary file of WriteFileAtomic, left
+// behind if it was interrupted
+func isAtomicTempFile(name string) bool {
+	return strings.HasPrefix(name, ".") && strings.HasSuffix(name, ".tmp")
+}
+
+// write to a temporary file in the same directory, sync, then rename over the
+// destination. The destination is never left partially written.
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+
+	tmpfile, err := ioutil.TempFile(dir, "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	// harmless after the rename
+	defer os.Remove(tmpfile.Name())
+
+	_, err = tmpfile.Write(data)
+	if err == nil {
+		err = tmpfile.Sync()
+	}
+	if err == nil {
+		err = tmpfile.Chmod(perm)
+	}
+	if closeErr := tmpfile.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmpfile.Name(), path); err != nil {
+		return err
+	}
+
+	// make the rename itself durable
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+
+	return nil
+}
+
+// take an advisory lock on the given file, creating it if necessary. Shared
+// locks can be held by many readers at once. Returns a function to release
+// the lock.
+func LockFile(path string, exclusive bool) (func(), error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	how := unix.LOCK_SH
+	if exclusive {
+		how = unix.LOCK_EX
+	}
+
+	deadline := time.Now().Add(LOCK_TIMEOUT)
+
+	for {
+		err = unix.Flock(int(file.Fd()), how|unix.LOCK_NB)
+
+		if err == nil {
+			break
+		}
+
+		if err != unix.EWOULDBLOCK || time.Now().After(deadline) {
+			file.Close()
+
+			if err == unix.EWOULDBLOCK {
+				return nil, ErrLocked
+			}
+
+			return nil, err
+		}
+
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	return func() {
+		unix.Flock(int(file.Fd()), unix.LOCK_UN)
+		file.Close()
+	}, nil
+}
@@ -0,0 +1,102 @@
+package dstask
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dstask-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fp := filepath.Join(dir, "task.yml")
+
+	for _, data := range []string{"summary: one\n", "summary: two\n"} {
+		if err := WriteFileAtomic(fp, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		if got, err := ioutil.ReadFile(fp); err != nil || string(got) != data {
+			t.Errorf("read %q, %v, want %q", got, err, data)
+		}
+	}
+
+	if info, err := os.Stat(fp); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("written with mode %v, %v", info.Mode(), err)
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(files) != 1 {
+		t.Errorf("%d files left, want only the one written", len(files))
+	}
+
+	if err := WriteFileAtomic(filepath.Join(dir, "missing", "task.yml"), nil, 0600); err == nil {
+		t.Errorf("wrote to a missing directory")
+	}
+}
+
+func TestLockFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dstask-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fp := filepath.Join(dir, "dstask.lock")
+
+	// readers share the lock
+	unlockA, err := LockFile(fp, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unlockB, err := LockFile(fp, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a writer waits for both
+	held := 100 * time.Millisecond
+	go func() {
+		time.Sleep(held)
+		unlockA()
+		unlockB()
+	}()
+
+	start := time.Now()
+	unlock, err := LockFile(fp, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if waited := time.Since(start); waited < held {
+		t.Errorf("exclusive lock taken after %s, while shared locks were held", waited)
+	}
+
+	// and a reader for the writer
+	go func() {
+		time.Sleep(held)
+		unlock()
+	}()
+
+	start = time.Now()
+	unlock, err = LockFile(fp, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unlock()
+
+	if waited := time.Since(start); waited < held {
+		t.Errorf("shared lock taken after %s, while an exclusive lock was held", waited)
+	}
+}
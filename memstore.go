@@ -0,0 +1,47 @@
+package dstask
+
+// a store that only lives as long as the process, for tests and tools that
+// do not need persistence.
+
+type MemoryStore struct {
+	tasks map[string]Task
+	// messages passed to Commit, oldest first
+	Commits []string
+}
+
+func NewMemoryStore(tasks ...Task) *MemoryStore {
+	s := &MemoryStore{
+		tasks: make(map[string]Task),
+	}
+
+	for _, task := range tasks {
+		s.tasks[task.UUID] = task
+	}
+
+	return s
+}
+
+func (s *MemoryStore) Load(statuses []string) ([]Task, error) {
+	return tasksWithStatuses(s.tasks, statuses), nil
+}
+
+func (s *MemoryStore) Save(task Task) error {
+	task.WritePending = false
+	s.tasks[task.UUID] = task
+	return nil
+}
+
+func (s *MemoryStore) Delete(uuid string) error {
+	delete(s.tasks, uuid)
+	return nil
+}
+
+func (s *MemoryStore) Commit(msg string) error {
+	s.Commits = append(s.Commits, msg)
+	return nil
+}
+
+// a memory store is private to the process
+func (s *MemoryStore) Lock(exclusive bool) (func(), error) {
+	return func() {}, nil
+}
@@ -0,0 +1,495 @@
+package dstask
+
+// merging of task files changed on two machines. Git calls `dstask
+// merge-driver` for each task file changed on both sides of a merge made with
+// `dstask git`, as registered in .gitattributes, so it does not leave conflict
+// markers.
+
+// A task moved to another status directory on one side is a rename to git, so
+// the driver merges the contents and the move is kept. Sync does not need git
+// or the driver: it merges task by task with the same rules, see mergeTrees.
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	git "gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/yaml.v2"
+)
+
+const GITATTRIBUTES_FILE = ".gitattributes"
+
+const MERGE_DRIVER_ATTRIBUTE = "*.yml merge=dstask"
+
+// three-way merge of a task. Base is the common ancestor, or a zero Task if
+// there is none. Tags and dependencies added on either side are kept, and
+// removed if removed on either side. Diverging notes are concatenated and work
+// intervals from both sides are kept. Other fields changed on both sides take
+// the value from the side modified last. A task resolved on either side is
+// resolved.
+func MergeTasks(base, ours, theirs Task) Task {
+	merged := ours
+	newer := ours
+	if theirs.Modified.After(ours.Modified) {
+		newer = theirs
+	}
+
+	b := reflect.ValueOf(base)
+	o := reflect.ValueOf(ours)
+	t := reflect.ValueOf(theirs)
+	n := reflect.ValueOf(newer)
+	m := reflect.ValueOf(&merged).Elem()
+
+	for i := 0; i < m.NumField(); i++ {
+		switch {
+		case sameValue(o.Field(i), t.Field(i)), sameValue(t.Field(i), b.Field(i)):
+			// ours already
+		case sameValue(o.Field(i), b.Field(i)):
+			m.Field(i).Set(t.Field(i))
+		default:
+			m.Field(i).Set(n.Field(i))
+		}
+	}
+
+	merged.Tags = mergeStringSets(base.Tags, ours.Tags, theirs.Tags)
+	merged.Dependencies = mergeStringSets(base.Dependencies, ours.Dependencies, theirs.Dependencies)
+	merged.Notes = mergeNotes(base.Notes, ours.Notes, theirs.Notes)
+	merged.WorkLog = mergeWorkLogs(ours.WorkLog, theirs.WorkLog)
+
+	if ours.Status == STATUS_RESOLVED || theirs.Status == STATUS_RESOLVED {
+		merged.Status = STATUS_RESOLVED
+		merged.ID = 0
+
+		if merged.Resolved.IsZero() {
+			if ours.Resolved.After(theirs.Resolved) {
+				merged.Resolved = ours.Resolved
+			} else {
+				merged.Resolved = theirs.Resolved
+			}
+		}
+	}
+
+	if merged.Modified.Before(newer.Modified) {
+		merged.Modified = newer.Modified
+	}
+
+	merged.WritePending = false
+	return merged
+}
+
+// empty slices are equal however they were decoded, and times are compared
+// as instants
+func sameValue(a, b reflect.Value) bool {
+	if ta, ok := a.Interface().(time.Time); ok {
+		return ta.Equal(b.Interface().(time.Time))
+	}
+
+	if a.Kind() == reflect.Slice && a.Len() == 0 && b.Len() == 0 {
+		return true
+	}
+
+	return reflect.DeepEqual(a.Interface(), b.Interface())
+}
+
+func mergeStringSets(base, ours, theirs []string) []string {
+	var merged []string
+
+	for _, item := range ours {
+		if StrSliceContains(base, item) && !StrSliceContains(theirs, item) {
+			continue
+		}
+		merged = append(merged, item)
+	}
+
+	for _, item := range theirs {
+		if !StrSliceContains(base, item) && !StrSliceContains(merged, item) {
+			merged = append(merged, item)
+		}
+	}
+
+	return merged
+}
+
+func mergeNotes(base, ours, theirs string) string {
+	switch {
+	case ours == theirs, theirs == base:
+		return ours
+	case ours == base:
+		return theirs
+	// notes are usually appended to
+	case strings.HasPrefix(theirs, ours):
+		return theirs
+	case strings.HasPrefix(ours, theirs):
+		return ours
+	case base != "" && strings.HasPrefix(ours, base) && strings.HasPrefix(theirs, base):
+		return ours + theirs[len(base):]
+	case ours == "":
+		return theirs
+	case theirs == "":
+		return ours
+	default:
+		return ours + "\n" + theirs
+	}
+}
+
+func readTaskFile(fp string, task *Task) error {
+	data, err := ioutil.ReadFile(fp)
+	if err != nil {
+		return err
+	}
+
+	if err := yaml.Unmarshal(data, task); err != nil {
+		return newParseError(fp, data, err)
+	}
+
+	return nil
+}
+
+// the git merge driver: merge the task files at the given paths, writing the
+// result to ours. On error ours is left alone, for git to report a conflict.
+func MergeTaskFiles(basePath, oursPath, theirsPath string) error {
+	var base, ours, theirs Task
+
+	// the same status, as far as the driver knows
+	for fp, task := range map[string]*Task{
+		basePath:   &base,
+		oursPath:   &ours,
+		theirsPath: &theirs,
+	} {
+		if err := readTaskFile(fp, task); err != nil {
+			return err
+		}
+	}
+
+	merged := MergeTasks(base, ours, theirs)
+
+	d, err := yaml.Marshal(&merged)
+	if err != nil {
+		return fmt.Errorf("Failed to marshal task %s: %w", merged, err)
+	}
+
+	return ioutil.WriteFile(oursPath, d, 0600)
+}
+
+// register the merge driver for task files, for merges made with `dstask
+// git`. .gitattributes is committed so every clone uses the driver once it has
+// registered it; the command to run is local configuration.
+func (s *GitStore) installMergeDriver(repo *git.Repository, executable string) error {
+	fp := path.Join(MustExpandHome(s.Repo), GITATTRIBUTES_FILE)
+	data, err := ioutil.ReadFile(fp)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if !strings.Contains(string(data), MERGE_DRIVER_ATTRIBUTE) {
+		if len(data) > 0 && data[len(data)-1] != '\n' {
+			data = append(data, '\n')
+		}
+		data = append(data, MERGE_DRIVER_ATTRIBUTE+"\n"...)
+
+		if err := WriteFileAtomic(fp, data, 0644); err != nil {
+			return err
+		}
+	}
+
+	cfg, err := repo.Config()
+	if err != nil {
+		return &GitError{Args: []string{"config"}, Err: err}
+	}
+
+	quoted := "'" + strings.Replace(executable, "'", `'\''`, -1) + "'"
+	driver := cfg.Raw.Section("merge").Subsection("dstask")
+
+	if driver.Option("driver") != quoted+" merge-driver %O %A %B" {
+		driver.SetOption("name", "dstask task merge")
+		driver.SetOption("driver", quoted+" merge-driver %O %A %B")
+
+		if err := repo.Storer.SetConfig(cfg); err != nil {
+			return &GitError{Args: []string{"config", "merge.dstask.driver"}, Err: err}
+		}
+	}
+
+	// .gitattributes, if it was just created
+	return s.Commit("Merge task files with dstask")
+}
+
+// a file in a tree being merged
+type treeFile struct {
+	path string
+	hash plumbing.Hash
+	file *object.File
+}
+
+// the status and UUID of a task file path, or empty strings if it is not one
+func taskPath(relPath string) (string, string) {
+	dir, name := path.Split(relPath)
+	status := path.Clean(dir)
+
+	if !StrSliceContains(ALL_STATUSES, status) || len(name) != 40 || !strings.HasSuffix(name, ".yml") || !IsValidUUID4String(name[:36]) {
+		return "", ""
+	}
+
+	return status, name[:36]
+}
+
+// the files of a tree, keyed by UUID for tasks so a move between status
+// directories is a rename, otherwise by path. tree may be nil.
+func treeFiles(tree *object.Tree) (map[string]*treeFile, error) {
+	files := make(map[string]*treeFile)
+
+	if tree == nil {
+		return files, nil
+	}
+
+	err := tree.Files().ForEach(func(f *object.File) error {
+		key := f.Name
+		if _, uuid := taskPath(f.Name); uuid != "" {
+			key = uuid
+		}
+
+		files[key] = &treeFile{
+			path: f.Name,
+			hash: f.Hash,
+			file: f,
+		}
+		return nil
+	})
+
+	return files, err
+}
+
+func sameTreeFile(a, b *treeFile) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return a.path == b.path && a.hash == b.hash
+}
+
+func (f *treeFile) task() (Task, error) {
+	status, uuid := taskPath(f.path)
+	task := Task{
+		UUID:   uuid,
+		Status: status,
+	}
+
+	contents, err := f.file.Contents()
+	if err != nil {
+		return task, &GitError{Args: []string{"show", f.path}, Err: err}
+	}
+
+	if err := yaml.Unmarshal([]byte(contents), &task); err != nil {
+		return task, newParseError(f.path, []byte(contents), err)
+	}
+
+	return task, nil
+}
+
+// three-way merge of the trees of two commits into the worktree, which holds
+// ours. Tasks changed on both sides are merged with MergeTasks; other files
+// changed on both sides keep our version. Nothing is written unless every
+// file can be merged.
+func (s *GitStore) mergeTrees(baseTree, oursTree, theirsTree *object.Tree) error {
+	base, err := treeFiles(baseTree)
+	if err == nil {
+		var ours, theirs map[string]*treeFile
+		if ours, err = treeFiles(oursTree); err == nil {
+			if theirs, err = treeFiles(theirsTree); err == nil {
+				return s.applyMerge(base, ours, theirs)
+			}
+		}
+	}
+
+	return &GitError{Args: []string{"merge"}, Err: err}
+}
+
+func (s *GitStore) applyMerge(base, ours, theirs map[string]*treeFile) error {
+	var keys []string
+	for _, files := range []map[string]*treeFile{base, ours, theirs} {
+		for key := range files {
+			if !StrSliceContains(keys, key) {
+				keys = append(keys, key)
+			}
+		}
+	}
+	sort.Strings(keys)
+
+	// relative path to new contents, or nil to remove
+	writes := make(map[string][]byte)
+
+	for _, key := range keys {
+		b, o, t := base[key], ours[key], theirs[key]
+
+		switch {
+		case sameTreeFile(o, t), sameTreeFile(t, b):
+			// ours already
+		case sameTreeFile(o, b), o == nil:
+			// changed on their side only, or deleted on ours but changed on
+			// theirs
+			if o != nil {
+				writes[o.path] = nil
+			}
+
+			if t != nil {
+				contents, err := t.file.Contents()
+				if err != nil {
+					return &GitError{Args: []string{"show", t.path}, Err: err}
+				}
+				writes[t.path] = []byte(contents)
+			}
+		case t == nil:
+			// changed on our side, deleted on theirs
+		case key == o.path:
+			// not a task
+			fmt.Printf("Kept the local version of %s\n", key)
+		default:
+			baseTask := Task{UUID: key}
+			if b != nil {
+				var err error
+				if baseTask, err = b.task(); err != nil {
+					return err
+				}
+			}
+
+			oursTask, err := o.task()
+			if err != nil {
+				return err
+			}
+
+			theirsTask, err := t.task()
+			if err != nil {
+				return err
+			}
+
+			merged := MergeTasks(baseTask, oursTask, theirsTask)
+
+			d, err := yaml.Marshal(&merged)
+			if err != nil {
+				return fmt.Errorf("Failed to marshal task %s: %w", merged, err)
+			}
+
+			writes[o.path] = nil
+			writes[path.Join(merged.Status, merged.UUID+".yml")] = d
+		}
+	}
+
+	return s.writeFiles(writes)
+}
+
+// write files to the worktree by path relative to it, or remove them if the
+// contents are nil. Removals are first, so a task can move directory.
+func (s *GitStore) writeFiles(writes map[string][]byte) error {
+	root := MustExpandHome(s.Repo)
+
+	for relPath, contents := range writes {
+		if contents != nil {
+			continue
+		}
+
+		if err := os.Remove(path.Join(root, relPath)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	for relPath, contents := range writes {
+		if contents == nil {
+			continue
+		}
+
+		fp := path.Join(root, relPath)
+		if err := os.MkdirAll(path.Dir(fp), 0700); err != nil {
+			return err
+		}
+
+		if err := WriteFileAtomic(fp, contents, 0600); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// merge the fetched remote branch into the current one
+func (s *GitStore) merge(repo *git.Repository, target SyncTarget) error {
+	theirs, err := resolveCommit(repo, target.trackingRef())
+	if err != nil {
+		return err
+	}
+
+	ours, err := resolveCommit(repo, plumbing.HEAD)
+	if err != nil {
+		return err
+	}
+
+	args := []string{"merge", target.String()}
+
+	fastForward := ours == nil
+	if ours != nil {
+		if fastForward, err = ours.IsAncestor(theirs); err != nil {
+			return &GitError{Args: args, Err: err}
+		}
+	}
+
+	if fastForward {
+		branch, err := currentBranch(repo)
+		if err != nil {
+			return err
+		}
+
+		if err := repo.Storer.SetReference(plumbing.NewHashReference(branch, theirs.Hash)); err != nil {
+			return &GitError{Args: args, Err: err}
+		}
+
+		w, err := repo.Worktree()
+		if err == nil {
+			err = w.Reset(&git.ResetOptions{Commit: theirs.Hash, Mode: git.HardReset})
+		}
+		if err != nil {
+			return &GitError{Args: args, Err: err}
+		}
+
+		return nil
+	}
+
+	var baseTree *object.Tree
+	bases, err := ours.MergeBase(theirs)
+	if err != nil {
+		return &GitError{Args: args, Err: err}
+	}
+
+	if len(bases) > 0 {
+		if baseTree, err = bases[0].Tree(); err != nil {
+			return &GitError{Args: args, Err: err}
+		}
+	}
+
+	oursTree, err := ours.Tree()
+	if err != nil {
+		return &GitError{Args: args, Err: err}
+	}
+
+	theirsTree, err := theirs.Tree()
+	if err != nil {
+		return &GitError{Args: args, Err: err}
+	}
+
+	if err := s.mergeTrees(baseTree, oursTree, theirsTree); err != nil {
+		return err
+	}
+
+	if _, err := stageAll(repo); err != nil {
+		return err
+	}
+
+	msg := fmt.Sprintf("Merge %s", target)
+	fmt.Printf("\n%s\n", msg)
+	return s.commit(repo, msg, ours.Hash, theirs.Hash)
+}
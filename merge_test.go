@@ -0,0 +1,120 @@
+package dstask
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMergeTasks(t *testing.T) {
+	day := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	base := Task{
+		UUID:     testUUID(1),
+		ID:       1,
+		Status:   STATUS_PENDING,
+		Summary:  "Fix the gate",
+		Tags:     []string{"garden", "weekend"},
+		Priority: PRIORITY_NORMAL,
+		Notes:    "hinge is loose",
+		Created:  day,
+		Modified: day,
+	}
+
+	// base with changes made at the given time
+	change := func(modified time.Time, f func(task *Task)) Task {
+		task := base
+		task.Tags = append([]string{}, base.Tags...)
+		task.Modified = modified
+		f(&task)
+		return task
+	}
+
+	earlier := day.Add(time.Hour)
+	later := day.Add(2 * time.Hour)
+
+	tests := []struct {
+		name         string
+		ours, theirs Task
+		check        func(merged Task) bool
+		want         string
+	}{
+		{
+			name:   "changes to different fields",
+			ours:   change(earlier, func(task *Task) { task.Summary = "Fix the garden gate" }),
+			theirs: change(later, func(task *Task) { task.Priority = PRIORITY_HIGH }),
+			check: func(m Task) bool {
+				return m.Summary == "Fix the garden gate" && m.Priority == PRIORITY_HIGH
+			},
+			want: "both changes",
+		},
+		{
+			name:   "same field changed on both sides",
+			ours:   change(later, func(task *Task) { task.Summary = "ours" }),
+			theirs: change(earlier, func(task *Task) { task.Summary = "theirs" }),
+			check:  func(m Task) bool { return m.Summary == "ours" && m.Modified.Equal(later) },
+			want:   "the side modified last",
+		},
+		{
+			name:   "same field changed on both sides, theirs newer",
+			ours:   change(earlier, func(task *Task) { task.Summary = "ours" }),
+			theirs: change(later, func(task *Task) { task.Summary = "theirs" }),
+			check:  func(m Task) bool { return m.Summary == "theirs" && m.Modified.Equal(later) },
+			want:   "the side modified last",
+		},
+		{
+			name:   "tags added and removed",
+			ours:   change(earlier, func(task *Task) { task.Tags = []string{"garden", "weekend", "urgent"} }),
+			theirs: change(later, func(task *Task) { task.Tags = []string{"garden", "tools"} }),
+			check: func(m Task) bool {
+				return strings.Join(m.Tags, ",") == "garden,urgent,tools"
+			},
+			want: "garden,urgent,tools",
+		},
+		{
+			name: "resolved on one side",
+			ours: change(later, func(task *Task) { task.Summary = "Fix the garden gate" }),
+			theirs: change(earlier, func(task *Task) {
+				task.Status = STATUS_RESOLVED
+				task.Resolved = earlier
+			}),
+			check: func(m Task) bool {
+				return m.Status == STATUS_RESOLVED && m.ID == 0 && m.Resolved.Equal(earlier) && m.Summary == "Fix the garden gate"
+			},
+			want: "resolved with the other change",
+		},
+		{
+			name:   "notes appended on both sides",
+			ours:   change(earlier, func(task *Task) { task.Notes += "\nbought a hinge" }),
+			theirs: change(later, func(task *Task) { task.Notes += "\nneeds paint" }),
+			check:  func(m Task) bool { return m.Notes == "hinge is loose\nbought a hinge\nneeds paint" },
+			want:   "both additions",
+		},
+		{
+			name:   "notes replaced on both sides",
+			ours:   change(earlier, func(task *Task) { task.Notes = "ours" }),
+			theirs: change(later, func(task *Task) { task.Notes = "theirs" }),
+			check:  func(m Task) bool { return m.Notes == "ours\ntheirs" },
+			want:   "both notes",
+		},
+		{
+			name:   "unchanged on one side",
+			ours:   base,
+			theirs: change(later, func(task *Task) { task.Status = STATUS_ACTIVE }),
+			check:  func(m Task) bool { return m.Status == STATUS_ACTIVE && m.Modified.Equal(later) },
+			want:   "their change",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			merged := MergeTasks(base, test.ours, test.theirs)
+			if !test.check(merged) {
+				t.Errorf("merged %+v, want %s", merged, test.want)
+			}
+
+			if merged.WritePending {
+				t.Errorf("merged task is pending a write")
+			}
+		})
+	}
+}
@@ -0,0 +1,222 @@
+package dstask
+
+// versioning of the data format in the git store. The repository records the
+// version it was last migrated to in FORMAT_VERSION_FILE; a repository with
+// commits but without one predates versioning and is version 1.
+
+// Each format change is a registered migration that upgrades a single task
+// file, operating on the raw YAML so fields that no longer exist in Task are
+// still visible. Migrations must be idempotent: files written by a newer
+// dstask may already be in the new format, and tasks from older repositories
+// are upgraded in memory when loaded until `dstask migrate` is run.
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+const FORMAT_VERSION_FILE = ".dstask-format"
+
+type Migration struct {
+	// version after this migration
+	Version     int
+	Description string
+	// upgrade the fields of one task, returning the new fields
+	MigrateTask func(status string, fields yaml.MapSlice) yaml.MapSlice
+}
+
+// in order, numbered on from version 1, the format before versioning. Fields
+// added with omitempty need no migration, as older files simply lack them;
+// none has been needed yet.
+var MIGRATIONS []Migration
+
+// the version after the last migration
+var FORMAT_VERSION = 1 + len(MIGRATIONS)
+
+// return the migrations needed to upgrade from the given version
+func pendingMigrations(version int) []Migration {
+	var pending []Migration
+
+	for _, m := range MIGRATIONS {
+		if m.Version > version {
+			pending = append(pending, m)
+		}
+	}
+
+	return pending
+}
+
+// apply the given migrations to the raw YAML of a task
+func migrateTaskData(data []byte, status string, migrations []Migration) ([]byte, error) {
+	var fields yaml.MapSlice
+
+	if err := yaml.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+
+	for _, m := range migrations {
+		fields = m.MigrateTask(status, fields)
+	}
+
+	// restore timestamps, which would otherwise be written as quoted strings
+	for i, item := range fields {
+		key, _ := item.Key.(string)
+		value, ok := item.Value.(string)
+
+		if ok && taskTimeFields[key] {
+			if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+				fields[i].Value = t
+			}
+		}
+	}
+
+	return yaml.Marshal(fields)
+}
+
+// YAML keys of the time fields of Task
+var taskTimeFields = func() map[string]bool {
+	fields := make(map[string]bool)
+	t := reflect.TypeOf(Task{})
+
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).Type == reflect.TypeOf(time.Time{}) {
+			fields[strings.ToLower(t.Field(i).Name)] = true
+		}
+	}
+
+	return fields
+}()
+
+func (s *GitStore) FormatVersion() (int, error) {
+	fp := path.Join(MustExpandHome(s.Repo), FORMAT_VERSION_FILE)
+	data, err := ioutil.ReadFile(fp)
+
+	if os.IsNotExist(err) {
+		// new repositories are stamped on the first commit
+		if !s.hasCommits() {
+			return FORMAT_VERSION, nil
+		}
+		return 1, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	version, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, InvalidInput("Invalid format version in %s", fp)
+	}
+
+	return version, nil
+}
+
+func (s *GitStore) setFormatVersion(version int) error {
+	fp := path.Join(MustExpandHome(s.Repo), FORMAT_VERSION_FILE)
+	return WriteFileAtomic(fp, []byte(strconv.Itoa(version)+"\n"), 0600)
+}
+
+// the migrations a load must apply in memory, or an error if the repository
+// was written by a newer dstask
+func (s *GitStore) loadMigrations() ([]Migration, error) {
+	version, err := s.FormatVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	if version > FORMAT_VERSION {
+		return nil, fmt.Errorf("Repository data format is version %d but this dstask only understands up to %d, please upgrade dstask", version, FORMAT_VERSION)
+	}
+
+	return pendingMigrations(version), nil
+}
+
+// one step of an upgrade, as reported by Migrate
+type MigrationResult struct {
+	Migration
+	// task files changed, relative to the repository
+	Changed []string
+}
+
+// upgrade the repository to the current format, with a commit per migration.
+// With dryRun, only report what would change.
+func (s *GitStore) Migrate(dryRun bool) ([]MigrationResult, error) {
+	var results []MigrationResult
+
+	migrations, err := s.loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, m := range migrations {
+		result := MigrationResult{Migration: m}
+
+		for _, status := range ALL_STATUSES {
+			dir, err := s.GetRepoPath(status, "")
+			if err != nil {
+				return results, err
+			}
+
+			files, err := ioutil.ReadDir(dir)
+			if err != nil {
+				return results, fmt.Errorf("Failed to read %s: %w", dir, err)
+			}
+
+			for _, file := range files {
+				if len(file.Name()) != 40 || !IsValidUUID4String(file.Name()[:36]) {
+					continue
+				}
+
+				fp := path.Join(dir, file.Name())
+				data, err := ioutil.ReadFile(fp)
+				if err != nil {
+					return results, fmt.Errorf("Failed to read %s: %w", fp, err)
+				}
+
+				migrated, err := migrateTaskData(data, status, []Migration{m})
+				if err != nil {
+					return results, newParseError(fp, data, err)
+				}
+
+				// compare the canonical form, so reformatting alone is not a
+				// change
+				original, _ := migrateTaskData(data, status, nil)
+				if string(migrated) == string(original) {
+					continue
+				}
+
+				result.Changed = append(result.Changed, path.Join(status, file.Name()))
+
+				if !dryRun {
+					if err := WriteFileAtomic(fp, migrated, 0600); err != nil {
+						return results, fmt.Errorf("Failed to write %s: %w", fp, err)
+					}
+				}
+			}
+		}
+
+		results = append(results, result)
+
+		if dryRun {
+			continue
+		}
+
+		if err := s.setFormatVersion(m.Version); err != nil {
+			return results, err
+		}
+
+		msg := fmt.Sprintf("Migrate data format to version %d: %s", m.Version, m.Description)
+		fmt.Printf("\n%s\n", msg)
+		if err := s.Commit(msg); err != nil {
+			return results, err
+		}
+	}
+
+	return results, nil
+}
@@ -0,0 +1,165 @@
+package dstask
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// register the given migrations for the rest of the test
+func setMigrations(migrations []Migration) func() {
+	oldMigrations, oldVersion := MIGRATIONS, FORMAT_VERSION
+	MIGRATIONS = migrations
+	FORMAT_VERSION = 1 + len(migrations)
+
+	return func() {
+		MIGRATIONS, FORMAT_VERSION = oldMigrations, oldVersion
+	}
+}
+
+var lowercaseTags = Migration{
+	Version:     2,
+	Description: "Lowercase tags",
+	MigrateTask: func(status string, fields yaml.MapSlice) yaml.MapSlice {
+		for i, item := range fields {
+			tags, ok := item.Value.([]interface{})
+			if item.Key != "tags" || !ok {
+				continue
+			}
+
+			for j, tag := range tags {
+				tags[j] = strings.ToLower(fmt.Sprint(tag))
+			}
+			fields[i].Value = tags
+		}
+
+		return fields
+	},
+}
+
+func TestMigrateTaskData(t *testing.T) {
+	data := []byte("summary: Fix the gate\ntags:\n- Garden\ncreated: 2026-03-01T12:00:00Z\n")
+
+	tests := []struct {
+		name       string
+		migrations []Migration
+		want       string
+	}{
+		{"none", nil, "summary: Fix the gate\ntags:\n- Garden\ncreated: 2026-03-01T12:00:00Z\n"},
+		{"lowercase tags", []Migration{lowercaseTags}, "summary: Fix the gate\ntags:\n- garden\ncreated: 2026-03-01T12:00:00Z\n"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := migrateTaskData(data, STATUS_PENDING, test.migrations)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(got) != test.want {
+				t.Errorf("migrated to %q, want %q", got, test.want)
+			}
+		})
+	}
+
+	if _, err := migrateTaskData([]byte("summary: [unclosed"), STATUS_PENDING, nil); err == nil {
+		t.Errorf("invalid YAML migrated")
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	store, cleanup := newTestGitStore(t)
+	defer cleanup()
+
+	day := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	upper := testTask(1, 1, day)
+	upper.Tags = []string{"Garden"}
+	lower := testTask(2, 2, day)
+	lower.Tags = []string{"garden"}
+
+	for _, task := range []Task{upper, lower} {
+		if err := store.Save(task); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := store.Commit("Add tasks"); err != nil {
+		t.Fatal(err)
+	}
+
+	if version, err := store.FormatVersion(); err != nil || version != 1 {
+		t.Fatalf("new repository at version %d, %v", version, err)
+	}
+
+	defer setMigrations([]Migration{lowercaseTags})()
+
+	fp, err := store.GetRepoPath(STATUS_PENDING, upper.UUID+".yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	original, err := ioutil.ReadFile(fp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// upgraded in memory until migrated
+	tasks, err := store.Load(ALL_STATUSES)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, task := range tasks {
+		if strings.Join(task.Tags, ",") != "garden" {
+			t.Errorf("task %s loaded with tags %v", task.UUID, task.Tags)
+		}
+	}
+
+	results, err := store.Migrate(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "[pending/" + upper.UUID + ".yml]"
+	if len(results) != 1 || fmt.Sprint(results[0].Changed) != want {
+		t.Fatalf("dry run results %+v, want %s changed", results, want)
+	}
+
+	if data, _ := ioutil.ReadFile(fp); string(data) != string(original) {
+		t.Errorf("dry run changed %s", fp)
+	}
+
+	if _, err := store.Migrate(false); err != nil {
+		t.Fatal(err)
+	}
+
+	if data, _ := ioutil.ReadFile(fp); !strings.Contains(string(data), "- garden") {
+		t.Errorf("migrated file is %q", data)
+	}
+
+	if version, err := store.FormatVersion(); err != nil || version != 2 {
+		t.Errorf("migrated to version %d, %v", version, err)
+	}
+
+	if msg := lastCommitMessage(t, store); msg != "Migrate data format to version 2: Lowercase tags" {
+		t.Errorf("committed %q", msg)
+	}
+
+	results, err = store.Migrate(false)
+	if err != nil || len(results) != 0 {
+		t.Errorf("migrated again: %+v, %v", results, err)
+	}
+
+	// written by a newer dstask
+	if err := store.setFormatVersion(3); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.Load(ALL_STATUSES); err == nil || !strings.Contains(err.Error(), "please upgrade dstask") {
+		t.Errorf("loaded a newer repository, %v", err)
+	}
+}
@@ -0,0 +1,273 @@
+package dstask
+
+// machine readable output of listings, for scripts: --format json, yaml, csv,
+// tsv or markdown. The fields are documented in README.md; only add to them,
+// so scripts keep working. Without --format, listings are tables, plain text
+// if stdout is not a terminal. See Table.
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// a task as output. Times are RFC 3339, and left out if not set.
+type TaskRecord struct {
+	ID            int              `json:"id" yaml:"id"`
+	UUID          string           `json:"uuid" yaml:"uuid"`
+	Status        string           `json:"status" yaml:"status"`
+	Summary       string           `json:"summary" yaml:"summary"`
+	Notes         string           `json:"notes" yaml:"notes"`
+	Tags          []string         `json:"tags" yaml:"tags"`
+	Project       string           `json:"project" yaml:"project"`
+	Priority      string           `json:"priority" yaml:"priority"`
+	DelegatedTo   string           `json:"delegated_to" yaml:"delegated_to"`
+	Subtasks      []SubtaskRecord  `json:"subtasks" yaml:"subtasks"`
+	Dependencies  []string         `json:"dependencies" yaml:"dependencies"`
+	Recur         string           `json:"recur,omitempty" yaml:"recur,omitempty"`
+	RecurAnchor   *time.Time       `json:"recur_anchor,omitempty" yaml:"recur_anchor,omitempty"`
+	Parent        string           `json:"parent,omitempty" yaml:"parent,omitempty"`
+	DeferredUntil *time.Time       `json:"deferred_until,omitempty" yaml:"deferred_until,omitempty"`
+	Delegated     *time.Time       `json:"delegated,omitempty" yaml:"delegated,omitempty"`
+	Created       *time.Time       `json:"created,omitempty" yaml:"created,omitempty"`
+	Resolved      *time.Time       `json:"resolved,omitempty" yaml:"resolved,omitempty"`
+	Due           *time.Time       `json:"due,omitempty" yaml:"due,omitempty"`
+	Modified      *time.Time       `json:"modified,omitempty" yaml:"modified,omitempty"`
+	WorkLog       []IntervalRecord `json:"work_log" yaml:"work_log"`
+}
+
+type SubtaskRecord struct {
+	Summary  string `json:"summary" yaml:"summary"`
+	Resolved bool   `json:"resolved" yaml:"resolved"`
+}
+
+type IntervalRecord struct {
+	Start time.Time `json:"start" yaml:"start"`
+	// left out while the task is active
+	Stop *time.Time `json:"stop,omitempty" yaml:"stop,omitempty"`
+}
+
+type ProjectRecord struct {
+	Name             string     `json:"name" yaml:"name"`
+	TasksNotResolved int        `json:"tasks_not_resolved" yaml:"tasks_not_resolved"`
+	TasksResolved    int        `json:"tasks_resolved" yaml:"tasks_resolved"`
+	Active           bool       `json:"active" yaml:"active"`
+	Created          *time.Time `json:"created,omitempty" yaml:"created,omitempty"`
+	Resolved         *time.Time `json:"resolved,omitempty" yaml:"resolved,omitempty"`
+}
+
+// columns of tasks in csv, tsv and markdown, which have no room for notes
+// and lists
+var taskColumns = []string{"id", "uuid", "status", "priority", "project", "tags", "summary", "due", "created", "resolved"}
+
+var projectColumns = []string{"name", "tasks_not_resolved", "tasks_resolved", "active", "created", "resolved"}
+
+func IsValidOutputFormat(format string) bool {
+	return StrSliceContains(ALL_OUTPUT_FORMATS, format)
+}
+
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+
+	return &t
+}
+
+func formatOptionalTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+
+	return t.Format(time.RFC3339)
+}
+
+func NewTaskRecord(task *Task) TaskRecord {
+	record := TaskRecord{
+		ID:            task.ID,
+		UUID:          task.UUID,
+		Status:        task.Status,
+		Summary:       task.Summary,
+		Notes:         task.Notes,
+		Tags:          append([]string{}, task.Tags...),
+		Project:       task.Project,
+		Priority:      task.Priority,
+		DelegatedTo:   task.DelegatedTo,
+		Subtasks:      []SubtaskRecord{},
+		Dependencies:  append([]string{}, task.Dependencies...),
+		Recur:         task.Recur,
+		RecurAnchor:   optionalTime(task.RecurAnchor),
+		Parent:        task.Parent,
+		DeferredUntil: optionalTime(task.DeferredUntil),
+		Delegated:     optionalTime(task.Delegated),
+		Created:       optionalTime(task.Created),
+		Resolved:      optionalTime(task.Resolved),
+		Due:           optionalTime(task.Due),
+		Modified:      optionalTime(task.Modified),
+		WorkLog:       []IntervalRecord{},
+	}
+
+	for _, st := range task.Subtasks {
+		record.Subtasks = append(record.Subtasks, SubtaskRecord{
+			Summary:  st.Summary,
+			Resolved: st.Resolved,
+		})
+	}
+
+	for _, interval := range task.WorkLog {
+		record.WorkLog = append(record.WorkLog, IntervalRecord{
+			Start: interval.Start,
+			Stop:  optionalTime(interval.Stop),
+		})
+	}
+
+	return record
+}
+
+func (r TaskRecord) row() []string {
+	id := ""
+	if r.ID > 0 {
+		id = strconv.Itoa(r.ID)
+	}
+
+	return []string{
+		id,
+		r.UUID,
+		r.Status,
+		r.Priority,
+		r.Project,
+		strings.Join(r.Tags, " "),
+		r.Summary,
+		formatOptionalTime(r.Due),
+		formatOptionalTime(r.Created),
+		formatOptionalTime(r.Resolved),
+	}
+}
+
+// write records in the given format: value as a whole for json and yaml, or
+// as rows under a header otherwise
+func writeRecords(format string, value interface{}, header []string, rows [][]string) error {
+	switch format {
+	case OUTPUT_JSON:
+		data, err := json.MarshalIndent(value, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s\n", data)
+	case OUTPUT_YAML:
+		data, err := yaml.Marshal(value)
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(data))
+	case OUTPUT_CSV, OUTPUT_TSV:
+		w := csv.NewWriter(os.Stdout)
+		if format == OUTPUT_TSV {
+			w.Comma = '\t'
+		}
+		w.Write(header)
+		w.WriteAll(rows)
+		return w.Error()
+	case OUTPUT_MARKDOWN:
+		writeMarkdownRow(header)
+		var rule []string
+		for range header {
+			rule = append(rule, "---")
+		}
+		writeMarkdownRow(rule)
+		for _, row := range rows {
+			writeMarkdownRow(row)
+		}
+	default:
+		return InvalidInput("Invalid output format %s, expected one of %s", format, strings.Join(ALL_OUTPUT_FORMATS, ", "))
+	}
+
+	return nil
+}
+
+func writeMarkdownRow(cells []string) {
+	var escaped []string
+	for _, cell := range cells {
+		cell = strings.Replace(cell, "|", "\\|", -1)
+		cell = strings.Replace(cell, "\n", " ", -1)
+		escaped = append(escaped, cell)
+	}
+
+	fmt.Printf("| %s |\n", strings.Join(escaped, " | "))
+}
+
+// write the tasks of the set, in order. No tasks is an empty list rather
+// than an error, so scripts need not tell the two apart.
+func (ts *TaskSet) WriteTasks(format string) error {
+	records := []TaskRecord{}
+	var rows [][]string
+
+	for _, task := range ts.tasks {
+		record := NewTaskRecord(task)
+		records = append(records, record)
+		rows = append(rows, record.row())
+	}
+
+	return writeRecords(format, records, taskColumns, rows)
+}
+
+// write the projects of the set, by name
+func (ts *TaskSet) WriteProjects(format string) error {
+	projects := ts.GetProjects()
+	records := []ProjectRecord{}
+	var rows [][]string
+	var names []string
+
+	for name := range projects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		project := projects[name]
+		record := ProjectRecord{
+			Name:             project.Name,
+			TasksNotResolved: project.TasksNotResolved,
+			TasksResolved:    project.TasksResolved,
+			Active:           project.Active,
+			Created:          optionalTime(project.Created),
+			Resolved:         optionalTime(project.Resolved),
+		}
+
+		records = append(records, record)
+		rows = append(rows, []string{
+			record.Name,
+			strconv.Itoa(record.TasksNotResolved),
+			strconv.Itoa(record.TasksResolved),
+			strconv.FormatBool(record.Active),
+			formatOptionalTime(record.Created),
+			formatOptionalTime(record.Resolved),
+		})
+	}
+
+	return writeRecords(format, records, projectColumns, rows)
+}
+
+// write the tags of the set, sorted
+func (ts *TaskSet) WriteTags(format string) error {
+	tags := []string{}
+	var rows [][]string
+
+	for tag := range ts.GetTags() {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	for _, tag := range tags {
+		rows = append(rows, []string{tag})
+	}
+
+	return writeRecords(format, tags, []string{"tag"}, rows)
+}
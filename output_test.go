@@ -0,0 +1,115 @@
+package dstask
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// what f writes to stdout
+func captureStdout(t *testing.T, f func() error) string {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stdout := os.Stdout
+	os.Stdout = w
+	err = f()
+	os.Stdout = stdout
+	w.Close()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(out)
+}
+
+func TestWriteTasks(t *testing.T) {
+	created := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+
+	task := testTask(1, 1, created)
+	task.Summary = "Fix the gate | fence"
+	task.Project = "garden"
+	task.Tags = []string{"weekend", "diy"}
+	task.Subtasks = []SubTask{{Summary: "buy hinges"}}
+
+	ts, err := LoadTaskSet(NewMemoryStore(task), NON_RESOLVED_STATUSES)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uuid := testUUID(1)
+
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{OUTPUT_CSV, "id,uuid,status,priority,project,tags,summary,due,created,resolved\n" +
+			"1," + uuid + ",pending,P2,garden,diy weekend,Fix the gate | fence,,2026-03-02T09:00:00Z,\n"},
+		{OUTPUT_TSV, "id\tuuid\tstatus\tpriority\tproject\ttags\tsummary\tdue\tcreated\tresolved\n" +
+			"1\t" + uuid + "\tpending\tP2\tgarden\tdiy weekend\tFix the gate | fence\t\t2026-03-02T09:00:00Z\t\n"},
+		{OUTPUT_MARKDOWN, "| id | uuid | status | priority | project | tags | summary | due | created | resolved |\n" +
+			"| --- | --- | --- | --- | --- | --- | --- | --- | --- | --- |\n" +
+			"| 1 | " + uuid + " | pending | P2 | garden | diy weekend | Fix the gate \\| fence |  | 2026-03-02T09:00:00Z |  |\n"},
+		{OUTPUT_JSON, `[
+  {
+    "id": 1,
+    "uuid": "` + uuid + `",
+    "status": "pending",
+    "summary": "Fix the gate | fence",
+    "notes": "",
+    "tags": [
+      "diy",
+      "weekend"
+    ],
+    "project": "garden",
+    "priority": "P2",
+    "delegated_to": "",
+    "subtasks": [
+      {
+        "summary": "buy hinges",
+        "resolved": false
+      }
+    ],
+    "dependencies": [],
+    "created": "2026-03-02T09:00:00Z",
+    "work_log": []
+  }
+]
+`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.format, func(t *testing.T) {
+			got := captureStdout(t, func() error { return ts.WriteTasks(test.format) })
+
+			if got != test.want {
+				t.Errorf("wrote\n%s\nwant\n%s", got, test.want)
+			}
+		})
+	}
+
+	got := captureStdout(t, func() error { return ts.WriteTasks(OUTPUT_YAML) })
+	if !strings.HasPrefix(got, "- id: 1\n  uuid: "+uuid+"\n") || !strings.Contains(got, "  - summary: buy hinges\n") {
+		t.Errorf("wrote YAML\n%s", got)
+	}
+
+	if err := ts.WriteTasks("xml"); err == nil {
+		t.Errorf("wrote an invalid format")
+	}
+
+	// an empty list rather than nothing
+	ts.FilterByStatus(STATUS_RESOLVED)
+	if got := captureStdout(t, func() error { return ts.WriteTasks(OUTPUT_JSON) }); got != "[]\n" {
+		t.Errorf("wrote %q for no tasks", got)
+	}
+}
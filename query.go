@@ -0,0 +1,512 @@
+package dstask
+
+// boolean filter expressions. The filter words of a command line are parsed
+// into a Query, which replaces the filter fields of CmdLine for matching:
+//
+//   query = and { "or" and }
+//   and   = unary { ["and"] unary }
+//   unary = "not" unary | "(" query ")" | term
+//
+// Terms are the filter keywords (+tag, -tag, project:, -project:, P1, due:,
+// due.before:, due.after:, overdue, blocked, blocking), plus:
+//
+//   priority<P2  priority<=P1  priority>P0  priority>=P2  priority:P1
+//   created:<date>  created.before:<date>  created.after:<date>
+//   resolved:<date>  resolved.before:<date>  resolved.after:<date>
+//   status:<status>
+//
+// Consecutive other words are a single term, matched as a phrase in the
+// summary and notes. project:a also matches subprojects such as a.b, and
+// project: alone matches tasks without a project, and due:none tasks without
+// a due date.
+
+// Outside parentheses, and, or and not are only operators next to keywords
+// or parentheses, so searches written before there were expressions, such as
+// "fish and chips", keep their meaning. Inside parentheses they always are:
+// (fish or chips).
+
+// Terms of the top level "and" also set the fields of CmdLine, as before
+// there were expressions, so that a context still applies to new tasks.
+
+import (
+	"strings"
+	"time"
+)
+
+const (
+	QUERY_AND = "and"
+	QUERY_OR  = "or"
+	QUERY_NOT = "not"
+)
+
+// date fields that can be compared, by keyword
+var queryDateFields = map[string]func(task *Task) time.Time{
+	"due":      func(task *Task) time.Time { return task.Due },
+	"created":  func(task *Task) time.Time { return task.Created },
+	"resolved": func(task *Task) time.Time { return task.Resolved },
+}
+
+// longest first, so <= is not taken for <
+var priorityOperators = []string{"<=", ">=", "<", ">", ":", "="}
+
+type Query struct {
+	// QUERY_AND, QUERY_OR or QUERY_NOT applied to Args, or empty for a term
+	Op   string
+	Args []Query
+	// a filter keyword, or words to search for if Text
+	Term string
+	Text bool
+}
+
+func (q Query) String() string {
+	switch q.Op {
+	case QUERY_NOT:
+		return "not " + q.Args[0].group(QUERY_NOT)
+	case QUERY_AND, QUERY_OR:
+		var args []string
+		for _, arg := range q.Args {
+			args = append(args, arg.group(q.Op))
+		}
+		return strings.Join(args, " "+q.Op+" ")
+	}
+
+	if q.Text {
+		return "\"" + q.Term + "\""
+	}
+
+	return q.Term
+}
+
+// the query as an operand of op, in parentheses if needed
+func (q Query) group(op string) string {
+	if q.Op == QUERY_OR && op != QUERY_OR || q.Op == QUERY_AND && op == QUERY_NOT {
+		return "(" + q.String() + ")"
+	}
+
+	return q.String()
+}
+
+// whether the task matches. The task set is needed for blocked and blocking.
+func (q Query) Match(task *Task, ts *TaskSet) bool {
+	switch q.Op {
+	case QUERY_NOT:
+		return !q.Args[0].Match(task, ts)
+	case QUERY_AND:
+		for _, arg := range q.Args {
+			if !arg.Match(task, ts) {
+				return false
+			}
+		}
+		return true
+	case QUERY_OR:
+		for _, arg := range q.Args {
+			if arg.Match(task, ts) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if q.Text {
+		return strings.Contains(strings.ToLower(task.Summary+task.Notes), strings.ToLower(q.Term))
+	}
+
+	return matchTerm(q.Term, task, ts, time.Now())
+}
+
+// project or one of its subprojects, or no project if empty
+func MatchesProject(taskProject, project string) bool {
+	if project == "" {
+		return taskProject == ""
+	}
+
+	return taskProject == project || strings.HasPrefix(taskProject, project+".")
+}
+
+// split a date keyword such as created.before:eow into field, comparison
+// (":", "before" or "after") and value
+func splitDateTerm(lcTerm string) (string, string, string, bool) {
+	for field := range queryDateFields {
+		for _, cmp := range []string{":", ".before:", ".after:"} {
+			if strings.HasPrefix(lcTerm, field+cmp) {
+				return field, strings.Trim(cmp, ".:"), lcTerm[len(field+cmp):], true
+			}
+		}
+	}
+
+	return "", "", "", false
+}
+
+// split priority<=P1 and friends into operator and priority
+func splitPriorityTerm(lcTerm string) (string, string, bool) {
+	if !strings.HasPrefix(lcTerm, "priority") {
+		return "", "", false
+	}
+
+	rest := lcTerm[len("priority"):]
+	for _, op := range priorityOperators {
+		if strings.HasPrefix(rest, op) {
+			return op, strings.ToUpper(rest[len(op):]), true
+		}
+	}
+
+	return "", "", false
+}
+
+// whether a word is a filter keyword rather than text, and if so whether it
+// is valid
+func queryKeyword(term string) (bool, error) {
+	lcTerm := strings.ToLower(term)
+
+	if field, _, value, ok := splitDateTerm(lcTerm); ok {
+		switch {
+		case IsValidDueDate(value):
+			return true, nil
+		case field == "due":
+			return true, InvalidInput("Invalid due date %q", term[len(term)-len(value):])
+		default:
+			return true, InvalidInput("Invalid date in %s", term)
+		}
+	}
+
+	if strings.HasPrefix(lcTerm, "priority") {
+		if _, priority, ok := splitPriorityTerm(lcTerm); !ok || !IsValidPriority(priority) {
+			return true, InvalidInput("Invalid priority comparison %s, try priority<=P1", term)
+		}
+		return true, nil
+	}
+
+	if strings.HasPrefix(lcTerm, "status:") {
+		if !StrSliceContains(ALL_STATUSES, lcTerm[7:]) {
+			return true, InvalidInput("Invalid status %s, expected one of %s", lcTerm[7:], strings.Join(ALL_STATUSES, ", "))
+		}
+		return true, nil
+	}
+
+	isKeyword := strings.HasPrefix(lcTerm, "project:") ||
+		strings.HasPrefix(lcTerm, "-project:") ||
+		StrSliceContains(ALL_SELECTORS, lcTerm) ||
+		len(term) > 2 && (lcTerm[0] == '+' || lcTerm[0] == '-') ||
+		IsValidPriority(term)
+
+	return isKeyword, nil
+}
+
+func matchTerm(term string, task *Task, ts *TaskSet, now time.Time) bool {
+	lcTerm := strings.ToLower(term)
+
+	if field, cmp, value, ok := splitDateTerm(lcTerm); ok {
+		t := queryDateFields[field](task)
+		// relative dates are resolved now rather than when parsed, so they
+		// stay correct in a saved context
+		date, _ := ParseDueDate(value, now)
+
+		switch {
+		case date.IsZero():
+			// none
+			return cmp == "" && t.IsZero()
+		case t.IsZero():
+			return false
+		case cmp == "before":
+			return t.Before(date)
+		case cmp == "after":
+			return t.After(date)
+		default:
+			return startOfDay(t.Local()).Equal(startOfDay(date.Local()))
+		}
+	}
+
+	if op, priority, ok := splitPriorityTerm(lcTerm); ok {
+		// lower is more urgent, and the priorities sort as strings
+		switch op {
+		case "<":
+			return task.Priority < priority
+		case "<=":
+			return task.Priority <= priority
+		case ">":
+			return task.Priority > priority
+		case ">=":
+			return task.Priority >= priority
+		default:
+			return task.Priority == priority
+		}
+	}
+
+	switch {
+	case strings.HasPrefix(lcTerm, "status:"):
+		return task.Status == lcTerm[7:]
+	case strings.HasPrefix(lcTerm, "project:"):
+		return MatchesProject(task.Project, lcTerm[8:])
+	case strings.HasPrefix(lcTerm, "-project:"):
+		return !MatchesProject(task.Project, lcTerm[9:])
+	case lcTerm == SELECTOR_OVERDUE:
+		return task.IsOverdue(now)
+	case lcTerm == SELECTOR_BLOCKED:
+		return ts != nil && ts.IsBlocked(task)
+	case lcTerm == SELECTOR_BLOCKING:
+		return ts != nil && ts.IsBlocking(task)
+	case IsValidPriority(term):
+		return task.Priority == term
+	case lcTerm[0] == '+':
+		return StrSliceContains(task.Tags, lcTerm[1:])
+	case lcTerm[0] == '-':
+		return !StrSliceContains(task.Tags, lcTerm[1:])
+	}
+
+	return false
+}
+
+// separate parentheses from the words they are attached to, and words given
+// as one argument, as in dstask next "(+bug or +urgent)"
+func splitQueryTokens(args []string) []string {
+	var tokens []string
+
+	for _, arg := range args {
+		for _, word := range strings.Fields(arg) {
+			for strings.HasPrefix(word, "(") {
+				tokens = append(tokens, "(")
+				word = word[1:]
+			}
+
+			var closing int
+			for strings.HasSuffix(word, ")") {
+				closing++
+				word = word[:len(word)-1]
+			}
+
+			if word != "" {
+				tokens = append(tokens, word)
+			}
+
+			for ; closing > 0; closing-- {
+				tokens = append(tokens, ")")
+			}
+		}
+	}
+
+	return tokens
+}
+
+type queryParser struct {
+	tokens []string
+	pos    int
+	// positions of and, or and not that are words rather than operators
+	words map[int]bool
+}
+
+func (p *queryParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return strings.ToLower(p.tokens[p.pos])
+	}
+
+	return ""
+}
+
+// whether the next token is the given operator
+func (p *queryParser) isOp(op string) bool {
+	return p.peek() == op && !p.words[p.pos]
+}
+
+// find the and, or and not outside parentheses that are words, as they are
+// not next to a keyword or parenthesis. not is an operator before one, or
+// before another not that is; and and or between them.
+func queryWords(tokens []string) map[int]bool {
+	words := make(map[int]bool)
+	// whether each token is a keyword, parenthesis or operator not
+	operand := make([]bool, len(tokens))
+	depths := make([]int, len(tokens))
+	var depth int
+
+	for i, token := range tokens {
+		if token == ")" {
+			depth--
+		}
+		depths[i] = depth
+		if token == "(" {
+			depth++
+		}
+
+		isKeyword, _ := queryKeyword(token)
+		operand[i] = isKeyword || token == "(" || token == ")"
+	}
+
+	// right to left, so not before not is known
+	for i := len(tokens) - 1; i >= 0; i-- {
+		if depths[i] > 0 || strings.ToLower(tokens[i]) != QUERY_NOT {
+			continue
+		}
+
+		if i+1 < len(tokens) && operand[i+1] && tokens[i+1] != ")" {
+			operand[i] = true
+		} else {
+			words[i] = true
+		}
+	}
+
+	for i, token := range tokens {
+		lcToken := strings.ToLower(token)
+		if depths[i] > 0 || lcToken != QUERY_AND && lcToken != QUERY_OR {
+			continue
+		}
+
+		before := i > 0 && operand[i-1] && tokens[i-1] != "(" && !isQueryNot(tokens[i-1])
+		after := i+1 < len(tokens) && operand[i+1] && tokens[i+1] != ")"
+		if !before || !after {
+			words[i] = true
+		}
+	}
+
+	return words
+}
+
+func isQueryNot(token string) bool {
+	return strings.ToLower(token) == QUERY_NOT
+}
+
+// the query of the given words, nil if there are none, and the terms of its
+// top level "and"
+func ParseQuery(args []string) (*Query, []Query, error) {
+	tokens := splitQueryTokens(args)
+	p := &queryParser{tokens: tokens, words: queryWords(tokens)}
+
+	if len(p.tokens) == 0 {
+		return nil, nil, nil
+	}
+
+	q, err := p.parseOr()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if p.pos < len(p.tokens) {
+		return nil, nil, InvalidInput("Unexpected %s in filter", p.tokens[p.pos])
+	}
+
+	var conjuncts []Query
+	switch q.Op {
+	case "":
+		conjuncts = []Query{q}
+	case QUERY_AND:
+		for _, arg := range q.Args {
+			if arg.Op == "" {
+				conjuncts = append(conjuncts, arg)
+			}
+		}
+	}
+
+	return &q, conjuncts, nil
+}
+
+func (p *queryParser) parseOr() (Query, error) {
+	q, err := p.parseAnd()
+	if err != nil {
+		return q, err
+	}
+
+	args := []Query{q}
+	for p.isOp(QUERY_OR) {
+		p.pos++
+
+		q, err := p.parseAnd()
+		if err != nil {
+			return q, err
+		}
+		args = append(args, q)
+	}
+
+	if len(args) == 1 {
+		return args[0], nil
+	}
+
+	return Query{Op: QUERY_OR, Args: args}, nil
+}
+
+func (p *queryParser) parseAnd() (Query, error) {
+	var args []Query
+	// whether the last operand was a bare word, which the next one may
+	// continue as a phrase
+	var word bool
+
+	for {
+		switch {
+		case p.peek() == "", p.peek() == ")", p.isOp(QUERY_OR):
+			if len(args) == 0 {
+				return Query{}, p.expected()
+			}
+
+			if len(args) == 1 {
+				return args[0], nil
+			}
+
+			return Query{Op: QUERY_AND, Args: args}, nil
+		case p.isOp(QUERY_AND):
+			if len(args) == 0 {
+				return Query{}, p.expected()
+			}
+			p.pos++
+			word = false
+		}
+
+		next := p.peek()
+		q, err := p.parseUnary()
+		if err != nil {
+			return q, err
+		}
+
+		if n := len(args); word && q.Text && next != "(" {
+			args[n-1].Term += " " + q.Term
+			continue
+		}
+
+		args = append(args, q)
+		word = q.Text && next != "("
+	}
+}
+
+func (p *queryParser) parseUnary() (Query, error) {
+	switch {
+	case p.peek() == "", p.peek() == ")", p.isOp(QUERY_AND), p.isOp(QUERY_OR):
+		return Query{}, p.expected()
+	case p.isOp(QUERY_NOT):
+		p.pos++
+
+		q, err := p.parseUnary()
+		if err != nil {
+			return q, err
+		}
+
+		return Query{Op: QUERY_NOT, Args: []Query{q}}, nil
+	case p.peek() == "(":
+		p.pos++
+
+		q, err := p.parseOr()
+		if err != nil {
+			return q, err
+		}
+
+		if p.peek() != ")" {
+			return q, InvalidInput("Missing ) in filter")
+		}
+		p.pos++
+
+		return q, nil
+	}
+
+	term := p.tokens[p.pos]
+	p.pos++
+
+	isKeyword, err := queryKeyword(term)
+	if err != nil {
+		return Query{}, err
+	}
+
+	return Query{Term: term, Text: !isKeyword}, nil
+}
+
+func (p *queryParser) expected() error {
+	if p.pos < len(p.tokens) {
+		return InvalidInput("Expected a filter term before %s", p.tokens[p.pos])
+	}
+
+	return InvalidInput("Expected a filter term after %s", p.tokens[p.pos-1])
+}
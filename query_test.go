@@ -0,0 +1,135 @@
+package dstask
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		args string
+		// the query, or the start of the error
+		want string
+		err  string
+	}{
+		{args: "", want: "<nil>"},
+		{args: "+bug", want: "+bug"},
+		{args: "+bug project:dstask", want: "+bug and project:dstask"},
+		{args: "+bug or +feature project:dstask", want: "+bug or +feature and project:dstask"},
+		{args: "(+bug or +feature) project:dstask", want: "(+bug or +feature) and project:dstask"},
+		{args: "(+bug or +feature)", want: "+bug or +feature"},
+		{args: "not +bug", want: "not +bug"},
+		{args: "not (+bug and P1)", want: "not (+bug and P1)"},
+		{args: "+bug and not project:dstask", want: "+bug and not project:dstask"},
+		{args: "priority<P2 status:active", want: "priority<P2 and status:active"},
+		// words between keywords are a phrase
+		{args: "+bug fix the gate P1", want: `+bug and "fix the gate" and P1`},
+		// and, or and not are words next to other words
+		{args: "fish and chips", want: `"fish and chips"`},
+		{args: "do not disturb", want: `"do not disturb"`},
+		{args: "+bug and", want: `+bug and "and"`},
+		{args: "panic not", want: `"panic not"`},
+		{args: "(fish or chips)", want: `"fish" or "chips"`},
+		{args: "fish not +bug", want: `"fish" and not +bug`},
+		{args: "(+a", err: "Missing ) in filter"},
+		{args: "+a )", err: "Unexpected ) in filter"},
+		{args: "(not)", err: "Expected a filter term before )"},
+		{args: "()", err: "Expected a filter term before )"},
+		{args: "priority<P9", err: "Invalid priority"},
+		{args: "status:foo", err: "Invalid status"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.args, func(t *testing.T) {
+			q, _, err := ParseQuery(strings.Fields(test.args))
+
+			if test.err != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), test.err) {
+					t.Fatalf("error %v, want %s", err, test.err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := "<nil>"
+			if q != nil {
+				got = q.String()
+			}
+
+			if got != test.want {
+				t.Errorf("query %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestQueryMatch(t *testing.T) {
+	now := time.Now()
+	bug := Task{
+		UUID:     testUUID(1),
+		Status:   STATUS_PENDING,
+		Summary:  "Fix the gate",
+		Tags:     []string{"bug"},
+		Project:  "garden.fence",
+		Priority: PRIORITY_HIGH,
+		Created:  now,
+	}
+	chore := Task{
+		UUID:     testUUID(2),
+		Status:   STATUS_ACTIVE,
+		Summary:  "Mow the lawn",
+		Notes:    "fish and chips after",
+		Project:  "garden",
+		Priority: PRIORITY_LOW,
+		Created:  now,
+	}
+
+	ts, err := LoadTaskSet(NewMemoryStore(bug, chore), ALL_STATUSES)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		args string
+		// summaries of the tasks matched
+		want string
+	}{
+		{"+bug", "Fix the gate"},
+		{"-bug", "Mow the lawn"},
+		{"project:garden", "Fix the gate, Mow the lawn"},
+		{"project:garden.fence", "Fix the gate"},
+		{"+bug or status:active", "Fix the gate, Mow the lawn"},
+		{"not +bug", "Mow the lawn"},
+		{"priority<P2", "Fix the gate"},
+		{"priority>=P2", "Mow the lawn"},
+		{"the", "Fix the gate, Mow the lawn"},
+		{"GATE", "Fix the gate"},
+		{"fish and chips", "Mow the lawn"},
+		{"(gate or lawn) P3", "Mow the lawn"},
+		{"not (gate or lawn)", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.args, func(t *testing.T) {
+			q, _, err := ParseQuery(strings.Fields(test.args))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var matched []string
+			for _, task := range ts.Tasks() {
+				if q.Match(task, ts) {
+					matched = append(matched, task.Summary)
+				}
+			}
+
+			if got := strings.Join(matched, ", "); got != test.want {
+				t.Errorf("matched %q, want %q", got, test.want)
+			}
+		})
+	}
+}
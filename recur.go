@@ -0,0 +1,228 @@
+package dstask
+
+// recurring tasks. A template task lives in STATUS_RECURRING and holds a
+// recurrence rule. When the rule falls due, a pending instance is created with
+// a link back to the template via Task.Parent.
+
+// rule syntax, as given to recur:
+//   daily
+//   weekly            -- same weekday as the template was created
+//   weekly:mon,thu
+//   monthly           -- same day of month as the template was created
+//   monthly:15
+//   every:3           -- 3 days after the previous instance was resolved
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Recurrence struct {
+	// see const.go for RECUR_ strings
+	Period string
+	// weekly only. Empty means the weekday the template was created.
+	Weekdays []time.Weekday
+	// monthly only. Zero means the day the template was created.
+	DayOfMonth int
+	// every only
+	Days int
+}
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+func ParseRecurrence(rule string) (Recurrence, error) {
+	parts := strings.SplitN(strings.ToLower(rule), ":", 2)
+	r := Recurrence{Period: parts[0]}
+
+	var arg string
+	if len(parts) == 2 {
+		arg = parts[1]
+	}
+
+	switch r.Period {
+	case RECUR_DAILY:
+		if arg != "" {
+			return r, InvalidInput("Daily recurrence takes no arguments")
+		}
+	case RECUR_WEEKLY:
+		for _, name := range strings.FieldsFunc(arg, func(c rune) bool { return c == ',' }) {
+			if len(name) < 3 {
+				return r, InvalidInput("Invalid weekday in recurrence: %s", name)
+			}
+
+			day, ok := weekdayNames[name[:3]]
+			if !ok {
+				return r, InvalidInput("Invalid weekday in recurrence: %s", name)
+			}
+
+			r.Weekdays = append(r.Weekdays, day)
+		}
+	case RECUR_MONTHLY:
+		if arg != "" {
+			day, err := strconv.Atoi(arg)
+			if err != nil || day < 1 || day > 31 {
+				return r, InvalidInput("Invalid day of month in recurrence: %s", arg)
+			}
+			r.DayOfMonth = day
+		}
+	case RECUR_EVERY:
+		days, err := strconv.Atoi(strings.TrimSuffix(arg, "d"))
+		if err != nil || days < 1 {
+			return r, InvalidInput("Invalid number of days in recurrence: %s", arg)
+		}
+		r.Days = days
+	default:
+		return r, InvalidInput("Invalid recurrence period: %s", r.Period)
+	}
+
+	return r, nil
+}
+
+// after completion of the previous instance, as opposed to calendar based
+func (r Recurrence) AfterCompletion() bool {
+	return r.Period == RECUR_EVERY
+}
+
+// return the start of the first day after anchor on which the rule falls.
+// created is used to fill in an unspecified weekday or day of month.
+func (r Recurrence) Next(anchor, created time.Time) time.Time {
+	day := startOfDay(anchor)
+
+	switch r.Period {
+	case RECUR_WEEKLY:
+		weekdays := r.Weekdays
+		if len(weekdays) == 0 {
+			weekdays = []time.Weekday{created.Weekday()}
+		}
+
+		for i := 1; i <= 7; i++ {
+			next := day.AddDate(0, 0, i)
+			for _, wd := range weekdays {
+				if next.Weekday() == wd {
+					return next
+				}
+			}
+		}
+	case RECUR_MONTHLY:
+		dom := r.DayOfMonth
+		if dom == 0 {
+			dom = created.Day()
+		}
+
+		// this month, or the next if already passed. Short months are clamped
+		// to their last day.
+		for i := 0; i <= 1; i++ {
+			month := time.Date(day.Year(), day.Month()+time.Month(i), 1, 0, 0, 0, 0, day.Location())
+			lastDay := month.AddDate(0, 1, -1).Day()
+			next := month.AddDate(0, 0, minInt(dom, lastDay)-1)
+
+			if next.After(day) {
+				return next
+			}
+		}
+	case RECUR_EVERY:
+		return day.AddDate(0, 0, r.Days)
+	}
+
+	// daily
+	return day.AddDate(0, 0, 1)
+}
+
+// create a pending instance of the given template
+func (ts *TaskSet) spawnInstance(template *Task, now time.Time) (Task, error) {
+	instance, err := ts.AddTask(Task{
+		WritePending: true,
+		Status:       STATUS_PENDING,
+		Summary:      template.Summary,
+		Notes:        template.Notes,
+		Tags:         append([]string{}, template.Tags...),
+		Project:      template.Project,
+		Priority:     template.Priority,
+		Parent:       template.UUID,
+		Created:      now,
+	})
+
+	if err != nil {
+		return Task{}, err
+	}
+
+	if !template.RecurrenceRule().AfterCompletion() {
+		template.RecurAnchor = now
+		template.WritePending = true
+	}
+
+	return instance, nil
+}
+
+// add a recurring template along with the first instance, which is created
+// immediately. Returns the template and instance.
+func (ts *TaskSet) AddRecurringTask(task Task) (Task, Task, error) {
+	task.Status = STATUS_RECURRING
+	task, err := ts.AddTask(task)
+	if err != nil {
+		return Task{}, Task{}, err
+	}
+
+	instance, err := ts.spawnInstance(ts.tasksByUUID[task.UUID], time.Now())
+	return *ts.tasksByUUID[task.UUID], instance, err
+}
+
+// create a pending instance of every template that has fallen due, returning
+// the created instances. Only one open instance per template exists at a time,
+// so missed occurrences do not pile up.
+func (ts *TaskSet) SpawnDueInstances(now time.Time) ([]Task, error) {
+	var spawned []Task
+	open := make(map[string]bool)
+
+	for _, task := range ts.tasks {
+		if task.Parent != "" && task.Status != STATUS_RESOLVED {
+			open[task.Parent] = true
+		}
+	}
+
+	// copy as spawning appends to ts.tasks
+	for _, template := range append([]*Task{}, ts.tasks...) {
+		if template.Status != STATUS_RECURRING || open[template.UUID] {
+			continue
+		}
+
+		if template.NextRecurrence().After(now) {
+			continue
+		}
+
+		instance, err := ts.spawnInstance(template, now)
+		if err != nil {
+			return spawned, err
+		}
+
+		spawned = append(spawned, instance)
+	}
+
+	return spawned, nil
+}
+
+// rules are validated on load, so this will not fail for a template in a
+// task set.
+func (task *Task) RecurrenceRule() Recurrence {
+	r, _ := ParseRecurrence(task.Recur)
+	return r
+}
+
+// when the next instance of a template falls due
+func (task *Task) NextRecurrence() time.Time {
+	anchor := task.RecurAnchor
+	if anchor.IsZero() {
+		anchor = task.Created
+	}
+
+	return task.RecurrenceRule().Next(anchor, task.Created)
+}
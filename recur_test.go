@@ -0,0 +1,174 @@
+package dstask
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecurrenceNext(t *testing.T) {
+	// a Wednesday
+	created := time.Date(2026, 3, 4, 15, 0, 0, 0, time.Local)
+
+	tests := []struct {
+		rule   string
+		anchor time.Time
+		want   time.Time
+	}{
+		{"daily", created, time.Date(2026, 3, 5, 0, 0, 0, 0, time.Local)},
+		{"weekly", created, time.Date(2026, 3, 11, 0, 0, 0, 0, time.Local)},
+		{"weekly:mon,fri", created, time.Date(2026, 3, 6, 0, 0, 0, 0, time.Local)},
+		{"monthly", created, time.Date(2026, 4, 4, 0, 0, 0, 0, time.Local)},
+		{"monthly:15", created, time.Date(2026, 3, 15, 0, 0, 0, 0, time.Local)},
+		// clamped to the end of a short month
+		{"monthly:31", time.Date(2026, 4, 10, 9, 0, 0, 0, time.Local), time.Date(2026, 4, 30, 0, 0, 0, 0, time.Local)},
+		{"every:3", created, time.Date(2026, 3, 7, 0, 0, 0, 0, time.Local)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.rule, func(t *testing.T) {
+			r, err := ParseRecurrence(test.rule)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := r.Next(test.anchor, created); !got.Equal(test.want) {
+				t.Errorf("next %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseRecurrenceInvalid(t *testing.T) {
+	for _, rule := range []string{"", "hourly", "daily:2", "weekly:xyz", "monthly:32", "every:0"} {
+		if _, err := ParseRecurrence(rule); err == nil {
+			t.Errorf("rule %q parsed, want an error", rule)
+		}
+	}
+}
+
+func TestSpawnDueInstances(t *testing.T) {
+	now := time.Date(2026, 3, 10, 9, 0, 0, 0, time.Local)
+
+	template := func(rule string, created time.Time) Task {
+		task := testTask(1, 1, created)
+		task.Status = STATUS_RECURRING
+		task.Summary = "Water the plants"
+		task.Tags = []string{"home"}
+		task.Recur = rule
+		return task
+	}
+
+	instance := testTask(2, 2, now.AddDate(0, 0, -1))
+	instance.Parent = testUUID(1)
+
+	resolvedInstance := instance
+	resolvedInstance.ID = 0
+	resolvedInstance.Status = STATUS_RESOLVED
+	resolvedInstance.Resolved = now.AddDate(0, 0, -1)
+
+	tests := []struct {
+		name  string
+		tasks []Task
+		want  int
+	}{
+		{"due", []Task{template("daily", now.AddDate(0, 0, -3))}, 1},
+		{"not yet due", []Task{template("weekly", now.AddDate(0, 0, -3))}, 0},
+		{"open instance", []Task{template("daily", now.AddDate(0, 0, -3)), instance}, 0},
+		{"resolved instance", []Task{template("daily", now.AddDate(0, 0, -3)), resolvedInstance}, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ts, err := LoadTaskSet(NewMemoryStore(test.tasks...), ALL_STATUSES)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			spawned, err := ts.SpawnDueInstances(now)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(spawned) != test.want {
+				t.Fatalf("spawned %d, want %d", len(spawned), test.want)
+			}
+
+			for _, task := range spawned {
+				if task.Parent != testUUID(1) || task.Status != STATUS_PENDING || task.Summary != "Water the plants" || !StrSliceContains(task.Tags, "home") {
+					t.Errorf("instance %+v is not of the template", task)
+				}
+			}
+
+			if test.want == 0 {
+				return
+			}
+
+			// missed occurrences do not pile up
+			spawned, err = ts.SpawnDueInstances(now.AddDate(0, 0, 7))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(spawned) != 0 {
+				t.Errorf("spawned %d more with an instance open", len(spawned))
+			}
+		})
+	}
+}
+
+func TestHousekeepCommitsWithChange(t *testing.T) {
+	now := time.Now()
+
+	template := testTask(1, 1, now.AddDate(0, 0, -3))
+	template.Status = STATUS_RECURRING
+	template.Recur = "daily"
+
+	deferred := testTask(2, 2, now.AddDate(0, 0, -3))
+	deferred.Status = STATUS_DEFERRED
+	deferred.DeferredUntil = now.AddDate(0, 0, -1)
+
+	store := NewMemoryStore(template, deferred)
+	ts, err := LoadTaskSet(store, NON_RESOLVED_STATUSES)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ts.Housekeep(now); err != nil {
+		t.Fatal(err)
+	}
+
+	// nothing is saved by housekeeping alone
+	if len(store.Commits) != 0 {
+		t.Fatalf("commits %q before saving", store.Commits)
+	}
+
+	if err := ts.SaveToDisk("Added %s", "something"); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(store.Commits) != 1 {
+		t.Fatalf("commits %q, want one", store.Commits)
+	}
+
+	msg := store.Commits[0]
+	for _, want := range []string{"Added something\n\n", "Recurred ", "Woke "} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("commit message %q does not contain %q", msg, want)
+		}
+	}
+
+	// saved, so loading again has nothing to do
+	ts, err = LoadTaskSet(store, NON_RESOLVED_STATUSES)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ts.Housekeep(now); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ts.housekeeping) != 0 {
+		t.Errorf("housekeeping %q after saving", ts.housekeeping)
+	}
+}
@@ -0,0 +1,142 @@
+package dstask
+
+// reports over the recorded history of tasks. The time report is a timesheet
+// of the work intervals recorded by start and stop, see timetrack.go.
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// time worked on a task on one day
+type TimeEntry struct {
+	// the start of the day, in local time
+	Day      time.Time
+	Task     Task
+	Duration time.Duration
+}
+
+type TimeReport struct {
+	// either may be zero, for no limit
+	Since time.Time
+	Until time.Time
+	// by day, then task as first worked on
+	Entries   []TimeEntry
+	ByProject map[string]time.Duration
+	ByTag     map[string]time.Duration
+	ByDay     map[string]time.Duration
+	Total     time.Duration
+}
+
+// the time worked on the tasks of the set between since and until. Intervals
+// are split at midnight. now is the end of any interval still running.
+func (ts *TaskSet) TimeReport(since, until, now time.Time) TimeReport {
+	report := TimeReport{
+		Since:     since,
+		Until:     until,
+		ByProject: make(map[string]time.Duration),
+		ByTag:     make(map[string]time.Duration),
+		ByDay:     make(map[string]time.Duration),
+	}
+
+	entries := make(map[string]*TimeEntry)
+	var keys []string
+
+	for _, task := range ts.tasks {
+		for _, interval := range task.WorkLog {
+			start, stop, ok := interval.Clip(since, until, now)
+			if !ok {
+				continue
+			}
+
+			start, stop = start.Local(), stop.Local()
+
+			for day := startOfDay(start); day.Before(stop); day = day.AddDate(0, 0, 1) {
+				from, to := start, day.AddDate(0, 0, 1)
+				if from.Before(day) {
+					from = day
+				}
+				if to.After(stop) {
+					to = stop
+				}
+
+				key := day.Format("2006-01-02") + " " + task.UUID
+				if entries[key] == nil {
+					entries[key] = &TimeEntry{Day: day, Task: *task}
+					keys = append(keys, key)
+				}
+				entries[key].Duration += to.Sub(from)
+			}
+		}
+	}
+
+	sort.SliceStable(keys, func(i, j int) bool { return keys[i][:10] < keys[j][:10] })
+
+	for _, key := range keys {
+		entry := *entries[key]
+		report.Entries = append(report.Entries, entry)
+		report.Total += entry.Duration
+		report.ByDay[entry.Day.Format("2006-01-02")] += entry.Duration
+		report.ByProject[entry.Task.Project] += entry.Duration
+
+		for _, tag := range entry.Task.Tags {
+			report.ByTag[tag] += entry.Duration
+		}
+	}
+
+	return report
+}
+
+func printDurations(w *tabwriter.Writer, title string, durations map[string]time.Duration) {
+	var keys []string
+	for key := range durations {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	fmt.Fprintf(w, "\n%s\n", title)
+	for _, key := range keys {
+		name := key
+		if name == "" {
+			name = "(none)"
+		}
+		fmt.Fprintf(w, "%s\t%s\n", name, FormatDuration(durations[key]))
+	}
+}
+
+// print a timesheet: the time per task per day, then totals by day, project
+// and tag. Plain text, to paste elsewhere.
+func (ts *TaskSet) DisplayTimeReport(since, until time.Time) error {
+	report := ts.TimeReport(since, until, time.Now())
+
+	if len(report.Entries) == 0 {
+		return fmt.Errorf("%w: no time recorded", ErrNoMatchingTasks)
+	}
+
+	header := []string{"Time worked"}
+	if !since.IsZero() {
+		header = append(header, "from", since.Local().Format("2006-01-02 15:04"))
+	}
+	if !until.IsZero() {
+		header = append(header, "until", until.Local().Format("2006-01-02 15:04"))
+	}
+
+	fmt.Printf("%s\n\n", strings.Join(header, " "))
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, TABLE_COL_GAP, ' ', 0)
+	fmt.Fprintf(w, "Date\tProject\tTask\tHours\n")
+	for _, entry := range report.Entries {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", entry.Day.Format("2006-01-02"), entry.Task.Project, entry.Task.Summary, FormatDuration(entry.Duration))
+	}
+
+	printDurations(w, "Day", report.ByDay)
+	printDurations(w, "Project", report.ByProject)
+	printDurations(w, "Tag", report.ByTag)
+
+	fmt.Fprintf(w, "\nTotal\t%s\n", FormatDuration(report.Total))
+	return w.Flush()
+}
@@ -0,0 +1,113 @@
+package dstask
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestWorkIntervalClip(t *testing.T) {
+	at := func(hour int) time.Time {
+		return time.Date(2026, 3, 2, hour, 0, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name         string
+		interval     WorkInterval
+		since, until time.Time
+		want         string
+	}{
+		{"no limits", WorkInterval{at(9), at(11)}, time.Time{}, time.Time{}, "9-11"},
+		{"running", WorkInterval{at(9), time.Time{}}, time.Time{}, time.Time{}, "9-12"},
+		{"clipped", WorkInterval{at(9), at(11)}, at(10), at(10).Add(30 * time.Minute), "10-10"},
+		{"before since", WorkInterval{at(7), at(8)}, at(9), time.Time{}, "none"},
+		{"after until", WorkInterval{at(9), at(11)}, time.Time{}, at(9), "none"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			start, stop, ok := test.interval.Clip(test.since, test.until, at(12))
+
+			got := "none"
+			if ok {
+				got = fmt.Sprintf("%d-%d", start.Hour(), stop.Hour())
+			}
+
+			if got != test.want {
+				t.Errorf("clipped to %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestTimeReport(t *testing.T) {
+	at := func(day, hour, min int) time.Time {
+		return time.Date(2026, 3, day, hour, min, 0, 0, time.Local)
+	}
+
+	gate := testTask(1, 1, at(1, 8, 0))
+	gate.Project = "house"
+	gate.Tags = []string{"admin"}
+	gate.WorkLog = []WorkInterval{
+		{Start: at(1, 9, 0), Stop: at(1, 10, 30)},
+		// split at midnight
+		{Start: at(1, 23, 0), Stop: at(2, 1, 0)},
+	}
+
+	// still active
+	post := testTask(2, 2, at(1, 8, 0))
+	post.Status = STATUS_ACTIVE
+	post.WorkLog = []WorkInterval{{Start: at(2, 10, 0)}}
+
+	// before the report
+	old := testTask(3, 3, at(1, 8, 0))
+	old.WorkLog = []WorkInterval{{Start: at(1, 8, 0), Stop: at(1, 9, 0)}}
+
+	ts, err := LoadTaskSet(NewMemoryStore(gate, post, old), ALL_STATUSES)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report := ts.TimeReport(at(1, 9, 30), time.Time{}, at(2, 11, 0))
+
+	var entries []string
+	for _, entry := range report.Entries {
+		entries = append(entries, fmt.Sprintf("%s %d %s", entry.Day.Format("02"), entry.Task.ID, FormatDuration(entry.Duration)))
+	}
+
+	if got, want := fmt.Sprint(entries), "[01 1 2:00 02 1 1:00 02 2 1:00]"; got != want {
+		t.Errorf("entries %s, want %s", got, want)
+	}
+
+	if report.Total != 4*time.Hour {
+		t.Errorf("total %s", report.Total)
+	}
+
+	if got := fmt.Sprint(report.ByProject); got != "map[:1h0m0s house:3h0m0s]" {
+		t.Errorf("by project %s", got)
+	}
+
+	if got := fmt.Sprint(report.ByTag); got != "map[admin:3h0m0s]" {
+		t.Errorf("by tag %s", got)
+	}
+
+	if got := fmt.Sprint(report.ByDay); got != "map[2026-03-01:2h0m0s 2026-03-02:2h0m0s]" {
+		t.Errorf("by day %s", got)
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	tests := map[time.Duration]string{
+		0:                               "0:00",
+		29 * time.Second:                "0:00",
+		90 * time.Minute:                "1:30",
+		25*time.Hour + 5*time.Minute:    "25:05",
+		59*time.Minute + 31*time.Second: "1:00",
+	}
+
+	for d, want := range tests {
+		if got := FormatDuration(d); got != want {
+			t.Errorf("%s formatted as %s, want %s", d, got, want)
+		}
+	}
+}
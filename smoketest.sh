@@ -11,6 +11,7 @@ set -e
 # isolated db locations (repo2 is used for a sync target)
 export DSTASK_GIT_REPO=$(mktemp -d)
 export DSTASK_CONTEXT_FILE=$(mktemp -u)
+export DSTASK_INDEX_FILE=$(mktemp -u)
 export DSTASK_FAKE_PTY=1
 
 UPSTREAM_BARE_REPO=$(mktemp -d)
@@ -21,6 +22,7 @@ cleanup() {
     rm -rf $DSTASK_GIT_REPO
     rm -rf $UPSTREAM_BARE_REPO
     rm $DSTASK_CONTEXT_FILE
+    rm -f $DSTASK_INDEX_FILE
 }
 
 trap cleanup EXIT
@@ -0,0 +1,153 @@
+package dstask
+
+// storage backends. A TaskSet is loaded from and saved to a Store, so the
+// git+YAML layout is one option amongst others.
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+type Store interface {
+	// return all tasks with any of the given statuses
+	Load(statuses []string) ([]Task, error)
+	// write a task, replacing any previous version regardless of status
+	Save(task Task) error
+	// remove a task entirely
+	Delete(uuid string) error
+	// record saved changes. Should do nothing if nothing has changed.
+	Commit(msg string) error
+	// wait for exclusive access, or shared access for readers, returning a
+	// function that releases it. Hold it across load, save and commit.
+	Lock(exclusive bool) (func(), error)
+}
+
+// the store selected by configuration, see LoadConfigFromEnv
+func DefaultStore() Store {
+	if DB_FILE != "" {
+		return NewDBStore(DB_FILE)
+	}
+
+	return NewGitStore(GIT_REPO, INDEX_FILE)
+}
+
+func LoadTaskSet(store Store, statuses []string) (*TaskSet, error) {
+	ts := &TaskSet{
+		store:       store,
+		statuses:    statuses,
+		tasksByID:   make(map[int]*Task),
+		tasksByUUID: make(map[string]*Task),
+	}
+
+	tasks, err := store.Load(statuses)
+	if err != nil {
+		return nil, err
+	}
+
+	// oldest first, so the older of two tasks with the same ID keeps it
+	sort.SliceStable(tasks, func(i, j int) bool { return tasks[i].Created.Before(tasks[j].Created) })
+
+	// tasks that need an ID are added after those that keep theirs, so a new
+	// ID cannot be one stored by a task not yet added. See ids.go
+	owners := make(map[int]string)
+	var renumber []Task
+
+	for _, t := range tasks {
+		if t.Status != STATUS_RESOLVED {
+			if owner, taken := owners[t.ID]; t.ID > 0 && taken && owner != t.UUID {
+				ts.idConflicts = append(ts.idConflicts, IDConflict{OldID: t.ID, UUID: t.UUID})
+				t.ID = 0
+			}
+
+			if t.ID == 0 {
+				renumber = append(renumber, t)
+				continue
+			}
+
+			owners[t.ID] = t.UUID
+		}
+
+		if _, err := ts.AddTask(t); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, t := range renumber {
+		if _, err := ts.AddTask(t); err != nil {
+			return nil, err
+		}
+	}
+
+	// back to the order they were loaded in
+	sort.SliceStable(ts.tasks, func(i, j int) bool { return ts.tasks[i].Created.Before(ts.tasks[j].Created) })
+
+	return ts, nil
+}
+
+func LoadTaskSetFromDisk(statuses []string) (*TaskSet, error) {
+	return LoadTaskSet(DefaultStore(), statuses)
+}
+
+// save changed tasks, including any filtered out, then commit with the given
+// message and a line for each change made by Housekeep
+func (ts *TaskSet) SaveToDisk(format string, a ...interface{}) error {
+	for _, task := range ts.tasksByUUID {
+		if !task.WritePending {
+			continue
+		}
+
+		task.Modified = time.Now()
+		if err := ts.store.Save(*task); err != nil {
+			return err
+		}
+
+		// save should be idempotent
+		task.WritePending = false
+	}
+
+	commitMsg := fmt.Sprintf(format, a...)
+	fmt.Printf("\n%s\n", commitMsg)
+
+	if len(ts.housekeeping) > 0 {
+		fmt.Println(strings.Join(ts.housekeeping, "\n"))
+		commitMsg += "\n\n" + strings.Join(ts.housekeeping, "\n")
+		ts.housekeeping = nil
+	}
+
+	if err := ts.store.Commit(commitMsg); err != nil {
+		return err
+	}
+
+	// without loading again if every open task is here
+	for _, status := range NON_RESOLVED_STATUSES {
+		if !StrSliceContains(ts.statuses, status) {
+			return WriteICalFeed(ts.store)
+		}
+	}
+
+	return ts.writeICalFeed()
+}
+
+func (ts *TaskSet) Store() Store {
+	return ts.store
+}
+
+// stores without an inherent order sort by UUID, as the git store does
+func sortTasksByUUID(tasks []Task) {
+	sort.SliceStable(tasks, func(i, j int) bool { return tasks[i].UUID < tasks[j].UUID })
+}
+
+func tasksWithStatuses(tasks map[string]Task, statuses []string) []Task {
+	var matched []Task
+
+	for _, task := range tasks {
+		if StrSliceContains(statuses, task.Status) {
+			matched = append(matched, task)
+		}
+	}
+
+	sortTasksByUUID(matched)
+	return matched
+}
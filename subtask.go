@@ -0,0 +1,186 @@
+package dstask
+
+// subtasks are a checklist on a task. They come from Task.Subtasks, and also
+// from markdown checkbox lines in the notes:
+//   - [ ] not done
+//   - [x] done
+// Numbering is 1-based, Task.Subtasks first then the notes in order.
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	SUBTASK_ADD    = "add"
+	SUBTASK_DONE   = "done"
+	SUBTASK_UNDONE = "undone"
+	SUBTASK_RM     = "rm"
+)
+
+var noteCheckboxRegex = regexp.MustCompile(`^\s*[-*] \[([ xX])\] (.*)$`)
+
+func (st SubTask) String() string {
+	if st.Resolved {
+		return "[x] " + st.Summary
+	} else {
+		return "[ ] " + st.Summary
+	}
+}
+
+// parse the arguments to the subtask command, eg "5 subtask add buy milk",
+// "5 subtask 2 done" or "5 subtask rm 2". Note the subtask number may have
+// been parsed as a second ID.
+func ParseSubtaskCmd(cmdLine CmdLine) (action string, number int, summary string, err error) {
+	words := strings.Fields(cmdLine.Text)
+
+	if len(cmdLine.IDs) > 2 {
+		return "", 0, "", InvalidInput("Specify a single task")
+	}
+
+	if len(words) == 0 {
+		return "", 0, "", nil
+	}
+
+	action = strings.ToLower(words[0])
+	words = words[1:]
+
+	if action == SUBTASK_ADD {
+		summary = strings.Join(words, " ")
+		if summary == "" {
+			return "", 0, "", InvalidInput("Specify a subtask summary")
+		}
+		return action, 0, summary, nil
+	}
+
+	if action != SUBTASK_DONE && action != SUBTASK_UNDONE && action != SUBTASK_RM {
+		return "", 0, "", InvalidInput("Invalid subtask action: %s", action)
+	}
+
+	if len(cmdLine.IDs) == 2 {
+		number = cmdLine.IDs[1]
+	} else if len(words) > 0 {
+		number, err = strconv.Atoi(words[0])
+		if err != nil {
+			return "", 0, "", InvalidInput("Invalid subtask number: %s", words[0])
+		}
+	} else {
+		return "", 0, "", InvalidInput("Specify a subtask number")
+	}
+
+	return action, number, "", nil
+}
+
+// subtasks parsed from markdown checkboxes in the notes
+func (task *Task) NoteSubtasks() []SubTask {
+	var subtasks []SubTask
+
+	for _, line := range strings.Split(task.Notes, "\n") {
+		match := noteCheckboxRegex.FindStringSubmatch(line)
+		if match != nil {
+			subtasks = append(subtasks, SubTask{
+				Summary:  match[2],
+				Resolved: match[1] != " ",
+			})
+		}
+	}
+
+	return subtasks
+}
+
+func (task *Task) AllSubtasks() []SubTask {
+	return append(append([]SubTask{}, task.Subtasks...), task.NoteSubtasks()...)
+}
+
+// count of resolved and total subtasks
+func (task *Task) SubtaskProgress() (int, int) {
+	var resolved int
+	subtasks := task.AllSubtasks()
+
+	for _, st := range subtasks {
+		if st.Resolved {
+			resolved++
+		}
+	}
+
+	return resolved, len(subtasks)
+}
+
+func (task *Task) OpenSubtasks() int {
+	resolved, total := task.SubtaskProgress()
+	return total - resolved
+}
+
+func (task *Task) AddSubtask(summary string) {
+	task.Subtasks = append(task.Subtasks, SubTask{Summary: summary})
+}
+
+// set the resolved state of the given (1-based) subtask
+func (task *Task) SetSubtaskResolved(number int, resolved bool) (SubTask, error) {
+	if number >= 1 && number <= len(task.Subtasks) {
+		task.Subtasks[number-1].Resolved = resolved
+		return task.Subtasks[number-1], nil
+	}
+
+	mark := " "
+	if resolved {
+		mark = "x"
+	}
+
+	return task.editNoteSubtask(number-len(task.Subtasks), func(line string, match []string) string {
+		i := strings.Index(line, "["+match[1]+"]")
+		return line[:i+1] + mark + line[i+2:]
+	})
+}
+
+// remove the given (1-based) subtask
+func (task *Task) RemoveSubtask(number int) (SubTask, error) {
+	if number >= 1 && number <= len(task.Subtasks) {
+		st := task.Subtasks[number-1]
+		task.Subtasks = append(task.Subtasks[:number-1], task.Subtasks[number:]...)
+		return st, nil
+	}
+
+	return task.editNoteSubtask(number-len(task.Subtasks), func(line string, match []string) string {
+		return ""
+	})
+}
+
+// rewrite the nth (1-based) checkbox line in the notes. An empty replacement
+// removes the line.
+func (task *Task) editNoteSubtask(n int, edit func(line string, match []string) string) (SubTask, error) {
+	var out []string
+	var st SubTask
+	var count int
+
+	for _, line := range strings.Split(task.Notes, "\n") {
+		match := noteCheckboxRegex.FindStringSubmatch(line)
+
+		if match != nil {
+			count++
+
+			if count == n {
+				line = edit(line, match)
+				st = SubTask{Summary: match[2]}
+
+				if updated := noteCheckboxRegex.FindStringSubmatch(line); updated != nil {
+					st.Resolved = updated[1] != " "
+				}
+
+				if line == "" {
+					continue
+				}
+			}
+		}
+
+		out = append(out, line)
+	}
+
+	if n < 1 || count < n {
+		return SubTask{}, InvalidInput("No subtask %d on task %v", n+len(task.Subtasks), task.ID)
+	}
+
+	task.Notes = strings.Join(out, "\n")
+	return st, nil
+}
@@ -0,0 +1,102 @@
+package dstask
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSubtaskCmd(t *testing.T) {
+	tests := []struct {
+		args []string
+		// action, number and summary, or the error
+		want string
+	}{
+		{[]string{"5", "subtask"}, " 0 "},
+		{[]string{"5", "subtask", "add", "buy", "milk"}, "add 0 buy milk"},
+		{[]string{"5", "subtask", "2", "done"}, "done 2 "},
+		{[]string{"5", "subtask", "undone", "3"}, "undone 3 "},
+		{[]string{"5", "subtask", "rm", "1"}, "rm 1 "},
+		{[]string{"5", "subtask", "add"}, "Specify a subtask summary"},
+		{[]string{"5", "subtask", "done"}, "Specify a subtask number"},
+		{[]string{"5", "subtask", "done", "two"}, "Invalid subtask number: two"},
+		{[]string{"5", "subtask", "tick", "1"}, "Invalid subtask action: tick"},
+		{[]string{"5", "6", "7", "subtask", "done"}, "Specify a single task"},
+	}
+
+	for _, test := range tests {
+		t.Run(strings.Join(test.args, " "), func(t *testing.T) {
+			action, number, summary, err := ParseSubtaskCmd(ParseCmdLine(test.args...))
+
+			got := fmt.Sprintf("%s %d %s", action, number, summary)
+			if err != nil {
+				got = err.Error()
+			}
+
+			if got != test.want {
+				t.Errorf("parsed %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSubtasks(t *testing.T) {
+	task := testTask(1, 1, time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC))
+	task.Subtasks = []SubTask{{Summary: "buy paint"}}
+	task.Notes = "for the shed\n- [ ] sand the door\n  * [X] find a brush\nnot - [ ] a checkbox"
+
+	progress := func() string {
+		resolved, total := task.SubtaskProgress()
+		return fmt.Sprintf("%d/%d", resolved, total)
+	}
+
+	if got := fmt.Sprint(task.AllSubtasks()); got != "[[ ] buy paint [ ] sand the door [x] find a brush]" {
+		t.Errorf("subtasks %s", got)
+	}
+
+	if progress() != "1/3" || task.OpenSubtasks() != 2 {
+		t.Errorf("progress %s with %d open", progress(), task.OpenSubtasks())
+	}
+
+	task.AddSubtask("paint it")
+
+	// numbered from Task.Subtasks first, then the notes
+	if st, err := task.SetSubtaskResolved(3, true); err != nil || st.Summary != "sand the door" || !st.Resolved {
+		t.Errorf("resolved %v, %v", st, err)
+	}
+
+	if st, err := task.SetSubtaskResolved(4, false); err != nil || st.Summary != "find a brush" || st.Resolved {
+		t.Errorf("reopened %v, %v", st, err)
+	}
+
+	if st, err := task.SetSubtaskResolved(1, true); err != nil || st.Summary != "buy paint" {
+		t.Errorf("resolved %v, %v", st, err)
+	}
+
+	if want := "for the shed\n- [x] sand the door\n  * [ ] find a brush\nnot - [ ] a checkbox"; task.Notes != want {
+		t.Errorf("notes %q, want %q", task.Notes, want)
+	}
+
+	if st, err := task.RemoveSubtask(4); err != nil || st.Summary != "find a brush" {
+		t.Errorf("removed %v, %v", st, err)
+	}
+
+	if st, err := task.RemoveSubtask(2); err != nil || st.Summary != "paint it" {
+		t.Errorf("removed %v, %v", st, err)
+	}
+
+	if got := fmt.Sprint(task.AllSubtasks()); got != "[[x] buy paint [x] sand the door]" {
+		t.Errorf("subtasks %s after removing", got)
+	}
+
+	if want := "for the shed\n- [x] sand the door\nnot - [ ] a checkbox"; task.Notes != want {
+		t.Errorf("notes %q, want %q", task.Notes, want)
+	}
+
+	for _, number := range []int{0, 3} {
+		if _, err := task.SetSubtaskResolved(number, true); err == nil {
+			t.Errorf("resolved subtask %d of 2", number)
+		}
+	}
+}
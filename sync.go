@@ -0,0 +1,383 @@
+package dstask
+
+// where and how far to sync the git store. The remote and branch come from
+// SYNC_REMOTE and SYNC_BRANCH if set, otherwise the upstream of the current
+// branch, otherwise the only remote and the current branch.
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	git "gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+)
+
+type SyncTarget struct {
+	Remote string
+	Branch string
+}
+
+func (t SyncTarget) String() string {
+	return t.Remote + "/" + t.Branch
+}
+
+// the remote tracking ref, as of the last fetch
+func (t SyncTarget) trackingRef() plumbing.ReferenceName {
+	return plumbing.NewRemoteReferenceName(t.Remote, t.Branch)
+}
+
+// the branch HEAD points to, even if it has no commits yet
+func currentBranch(repo *git.Repository) (plumbing.ReferenceName, error) {
+	head, err := repo.Storer.Reference(plumbing.HEAD)
+	if err != nil {
+		return "", &GitError{Args: []string{"symbolic-ref", "HEAD"}, Err: err}
+	}
+
+	if head.Type() != plumbing.SymbolicReference || !head.Target().IsBranch() {
+		return "", InvalidInput("Cannot sync from a detached HEAD")
+	}
+
+	return head.Target(), nil
+}
+
+func (s *GitStore) SyncTarget() (SyncTarget, error) {
+	target := SyncTarget{
+		Remote: SYNC_REMOTE,
+		Branch: SYNC_BRANCH,
+	}
+
+	repo, err := s.openRepo()
+	if err != nil {
+		return target, err
+	}
+
+	cfg, err := repo.Config()
+	if err != nil {
+		return target, &GitError{Args: []string{"config"}, Err: err}
+	}
+
+	branch, err := currentBranch(repo)
+	if err != nil {
+		return target, err
+	}
+	current := branch.Short()
+
+	if upstream := cfg.Branches[current]; upstream != nil {
+		if target.Remote == "" {
+			target.Remote = upstream.Remote
+		}
+
+		if target.Branch == "" {
+			target.Branch = upstream.Merge.Short()
+		}
+	}
+
+	if target.Branch == "" {
+		target.Branch = current
+	}
+
+	var remotes []string
+	for name := range cfg.Remotes {
+		remotes = append(remotes, name)
+	}
+	sort.Strings(remotes)
+
+	if target.Remote == "" {
+		switch len(remotes) {
+		case 0:
+			return target, InvalidInput("No git remote configured. Add one with `dstask git remote add origin <url>`")
+		case 1:
+			target.Remote = remotes[0]
+		default:
+			return target, InvalidInput("Branch %s has no upstream and there are several remotes (%s). Set one with `dstask git branch -u <remote>/<branch>` or DSTASK_SYNC_REMOTE", current, strings.Join(remotes, ", "))
+		}
+	}
+
+	if cfg.Remotes[target.Remote] == nil {
+		return target, InvalidInput("Git remote %s does not exist", target.Remote)
+	}
+
+	return target, nil
+}
+
+// commits on HEAD not on the remote branch, and the reverse, as of the last
+// fetch. A remote branch that does not exist yet has nothing to pull.
+func (s *GitStore) AheadBehind(target SyncTarget) (int, int, error) {
+	repo, err := s.openRepo()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	local, err := resolveCommit(repo, plumbing.HEAD)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	remote, err := resolveCommit(repo, target.trackingRef())
+	if err != nil {
+		return 0, 0, err
+	}
+
+	ahead, err := commitsNotIn(local, remote)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	behind, err := commitsNotIn(remote, local)
+	return len(ahead), len(behind), err
+}
+
+// one line per local commit not on the remote branch, as of the last fetch
+func (s *GitStore) UnpushedCommits(target SyncTarget) ([]string, error) {
+	repo, err := s.openRepo()
+	if err != nil {
+		return nil, err
+	}
+
+	local, err := resolveCommit(repo, plumbing.HEAD)
+	if err != nil {
+		return nil, err
+	}
+
+	remote, err := resolveCommit(repo, target.trackingRef())
+	if err != nil {
+		return nil, err
+	}
+
+	commits, err := commitsNotIn(local, remote)
+	if err != nil {
+		return nil, err
+	}
+
+	var lines []string
+	for _, c := range commits {
+		lines = append(lines, commitSummary(c))
+	}
+
+	return lines, nil
+}
+
+// the path of a remote that is a local repository, which is synced in
+// process. Otherwise empty, and the git binary is used.
+func (s *GitStore) localRemotePath(repo *git.Repository, name string) (string, error) {
+	remote, err := repo.Remote(name)
+	if err != nil {
+		return "", &GitError{Args: []string{"remote", name}, Err: err}
+	}
+
+	urls := remote.Config().URLs
+	if len(urls) == 0 {
+		return "", InvalidInput("Git remote %s has no URL", name)
+	}
+
+	ep, err := transport.NewEndpoint(urls[0])
+	if err != nil || ep.Protocol != "file" {
+		return "", nil
+	}
+
+	if !filepath.IsAbs(ep.Path) {
+		return filepath.Join(MustExpandHome(s.Repo), ep.Path), nil
+	}
+
+	return ep.Path, nil
+}
+
+// copy a commit and everything it references that is missing from dst.
+// History dst already has is not walked. An object is only written after
+// the objects it references, so dst is never left with a partial history.
+func copyObjects(src, dst storer.EncodedObjectStorer, hash plumbing.Hash) error {
+	if dst.HasEncodedObject(hash) == nil {
+		return nil
+	}
+
+	obj, err := src.EncodedObject(plumbing.AnyObject, hash)
+	if err != nil {
+		return err
+	}
+
+	var refs []plumbing.Hash
+
+	switch obj.Type() {
+	case plumbing.CommitObject:
+		c, err := object.DecodeCommit(src, obj)
+		if err != nil {
+			return err
+		}
+		refs = append([]plumbing.Hash{c.TreeHash}, c.ParentHashes...)
+	case plumbing.TreeObject:
+		t, err := object.DecodeTree(src, obj)
+		if err != nil {
+			return err
+		}
+		for _, entry := range t.Entries {
+			if entry.Mode != filemode.Submodule {
+				refs = append(refs, entry.Hash)
+			}
+		}
+	}
+
+	for _, ref := range refs {
+		if err := copyObjects(src, dst, ref); err != nil {
+			return err
+		}
+	}
+
+	_, err = dst.SetEncodedObject(obj)
+	return err
+}
+
+func (s *GitStore) fetch(repo *git.Repository, target SyncTarget) error {
+	remotePath, err := s.localRemotePath(repo, target.Remote)
+	if err != nil {
+		return err
+	} else if remotePath == "" {
+		return runGitCmdIn(s.Repo, "fetch", target.Remote)
+	}
+
+	args := []string{"fetch", target.Remote}
+
+	remoteRepo, err := git.PlainOpen(remotePath)
+	if err != nil {
+		return &GitError{Args: args, Err: err}
+	}
+
+	// an empty remote is pushed to, and has nothing to fetch
+	ref, err := remoteRepo.Reference(plumbing.NewBranchReferenceName(target.Branch), true)
+	if err == plumbing.ErrReferenceNotFound {
+		return nil
+	} else if err != nil {
+		return &GitError{Args: args, Err: err}
+	}
+
+	if err := copyObjects(remoteRepo.Storer, repo.Storer, ref.Hash()); err != nil {
+		return &GitError{Args: args, Err: err}
+	}
+
+	if err := repo.Storer.SetReference(plumbing.NewHashReference(target.trackingRef(), ref.Hash())); err != nil {
+		return &GitError{Args: args, Err: err}
+	}
+
+	return nil
+}
+
+func (s *GitStore) push(repo *git.Repository, target SyncTarget) error {
+	remotePath, err := s.localRemotePath(repo, target.Remote)
+	if err != nil {
+		return err
+	} else if remotePath == "" {
+		return runGitCmdIn(s.Repo, "push", target.Remote, "HEAD:refs/heads/"+target.Branch)
+	}
+
+	args := []string{"push", target.Remote, "HEAD:refs/heads/" + target.Branch}
+
+	remoteRepo, err := git.PlainOpen(remotePath)
+	if err != nil {
+		return &GitError{Args: args, Err: err}
+	}
+
+	head, err := resolveCommit(repo, plumbing.HEAD)
+	if err != nil {
+		return err
+	}
+
+	branch := plumbing.NewBranchReferenceName(target.Branch)
+	remoteHead, err := resolveCommit(remoteRepo, branch)
+	if err != nil {
+		return err
+	}
+
+	if remoteHead != nil && remoteHead.Hash == head.Hash {
+		return nil
+	}
+
+	// as git does by default
+	if _, err := remoteRepo.Worktree(); err != git.ErrIsBareRepository {
+		if remoteHEAD, err := remoteRepo.Storer.Reference(plumbing.HEAD); err == nil && remoteHEAD.Target() == branch {
+			return InvalidInput("Cannot push to %s, it is the checked out branch of a repository with a worktree", target)
+		}
+	}
+
+	if remoteHead != nil {
+		if ok, err := remoteHead.IsAncestor(head); err != nil {
+			return &GitError{Args: args, Err: err}
+		} else if !ok {
+			return &GitError{Args: args, Err: errors.New("remote has changed since the fetch, sync again")}
+		}
+	}
+
+	if err := copyObjects(repo.Storer, remoteRepo.Storer, head.Hash); err != nil {
+		return &GitError{Args: args, Err: err}
+	}
+
+	if err := remoteRepo.Storer.SetReference(plumbing.NewHashReference(branch, head.Hash)); err != nil {
+		return &GitError{Args: args, Err: err}
+	}
+
+	// as git does, so the tracking ref reflects the push
+	if err := repo.Storer.SetReference(plumbing.NewHashReference(target.trackingRef(), head.Hash)); err != nil {
+		return &GitError{Args: args, Err: err}
+	}
+
+	fmt.Printf("Pushed to %s\n", target)
+	return nil
+}
+
+// fetch, merge and push, registering the merge driver at executable for
+// task files. Progress is printed.
+func (s *GitStore) Sync(target SyncTarget, executable string) error {
+	repo, err := s.openRepo()
+	if err != nil {
+		return err
+	}
+
+	// a repository without commits takes the remote history first, as there
+	// is nothing to merge with
+	installed := false
+	if s.hasCommits() {
+		if err := s.installMergeDriver(repo, executable); err != nil {
+			return err
+		}
+		installed = true
+	}
+
+	if err := s.fetch(repo, target); err != nil {
+		return err
+	}
+
+	ahead, behind, err := s.AheadBehind(target)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%d local commits to push, %d remote commits to pull from %s\n", ahead, behind, target)
+
+	if behind > 0 {
+		if err := s.merge(repo, target); err != nil {
+			return err
+		}
+
+		// tasks added on both sides may share an ID
+		if err := resolveIDConflicts(s); err != nil {
+			return err
+		}
+	}
+
+	if !installed {
+		if err := s.installMergeDriver(repo, executable); err != nil {
+			return err
+		}
+	}
+
+	if !s.hasCommits() {
+		return nil
+	}
+
+	return s.push(repo, target)
+}
@@ -0,0 +1,128 @@
+package dstask
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+func TestSyncTarget(t *testing.T) {
+	tests := []struct {
+		name    string
+		remotes []string
+		// remote/branch of the upstream of master, if any
+		upstream string
+		remote   string
+		branch   string
+		want     string
+		wantErr  string
+	}{
+		{name: "no remote", wantErr: "No git remote configured"},
+		{name: "one remote", remotes: []string{"origin"}, want: "origin/master"},
+		{name: "several remotes", remotes: []string{"origin", "backup"}, wantErr: "several remotes (backup, origin)"},
+		{name: "upstream", remotes: []string{"origin", "backup"}, upstream: "backup/main", want: "backup/main"},
+		{name: "configured", remotes: []string{"origin", "backup"}, upstream: "backup/main", remote: "origin", branch: "tasks", want: "origin/tasks"},
+		{name: "configured branch", remotes: []string{"origin"}, branch: "tasks", want: "origin/tasks"},
+		{name: "missing remote", remotes: []string{"origin"}, remote: "backup", wantErr: "Git remote backup does not exist"},
+	}
+
+	defer func(remote, branch string) {
+		SYNC_REMOTE, SYNC_BRANCH = remote, branch
+	}(SYNC_REMOTE, SYNC_BRANCH)
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store, cleanup := newTestGitStore(t)
+			defer cleanup()
+
+			repo, err := store.openRepo()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, name := range test.remotes {
+				if _, err := repo.CreateRemote(&config.RemoteConfig{Name: name, URLs: []string{"/tmp/" + name}}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if test.upstream != "" {
+				cfg, err := repo.Config()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				parts := strings.SplitN(test.upstream, "/", 2)
+				cfg.Branches["master"] = &config.Branch{Name: "master", Remote: parts[0], Merge: plumbing.NewBranchReferenceName(parts[1])}
+				if err := repo.Storer.SetConfig(cfg); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			SYNC_REMOTE, SYNC_BRANCH = test.remote, test.branch
+
+			target, err := store.SyncTarget()
+
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Errorf("got %s, %v, want error %q", target, err, test.wantErr)
+				}
+				return
+			}
+
+			if err != nil || target.String() != test.want {
+				t.Errorf("got %s, %v, want %s", target, err, test.want)
+			}
+		})
+	}
+}
+
+func TestUnpushedCommits(t *testing.T) {
+	store, cleanup := newTestGitStore(t)
+	defer cleanup()
+
+	repo, err := store.openRepo()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target := SyncTarget{Remote: "origin", Branch: "master"}
+	day := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+
+	// a remote branch not fetched yet has everything to push
+	commitTask(t, store, testTask(1, 1, day), "Added 1: task 1")
+
+	if ahead, behind, err := store.AheadBehind(target); err != nil || ahead != 1 || behind != 0 {
+		t.Errorf("%d ahead and %d behind, %v", ahead, behind, err)
+	}
+
+	ref := plumbing.NewHashReference(target.trackingRef(), headHash(t, store))
+	if err := repo.Storer.SetReference(ref); err != nil {
+		t.Fatal(err)
+	}
+
+	commitTask(t, store, testTask(2, 2, day), "Added 2: task 2")
+	commitTask(t, store, testTask(3, 3, day), "Added 3: task 3")
+
+	if ahead, behind, err := store.AheadBehind(target); err != nil || ahead != 2 || behind != 0 {
+		t.Errorf("%d ahead and %d behind, %v", ahead, behind, err)
+	}
+
+	lines, err := store.UnpushedCommits(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var subjects []string
+	for _, line := range lines {
+		subjects = append(subjects, line[8:])
+	}
+
+	if got := fmt.Sprint(subjects); got != "[Added 3: task 3 Added 2: task 2]" {
+		t.Errorf("unpushed %s", got)
+	}
+}
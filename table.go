@@ -20,7 +20,8 @@ type RowStyle struct {
 	Bg int
 }
 
-// header may  havetruncated words
+// header may  havetruncated words. A width of zero is plain text, without
+// colours or truncation, for output that is not to a terminal.
 func NewTable(w int, header ...string) *Table {
 	if w > TABLE_MAX_WIDTH {
 		w = TABLE_MAX_WIDTH
@@ -53,7 +54,13 @@ func (t *Table) AddRow(row []string, style RowStyle) {
 func (t *Table) Render() {
 	originalWidths := make([]int, len(t.Header))
 
-	for _, row := range t.Rows {
+	// headers are only truncated to fit a terminal
+	rows := t.Rows
+	if t.Width == 0 {
+		rows = append([][]string{t.Header}, rows...)
+	}
+
+	for _, row := range rows {
 		for j, cell := range row {
 			if originalWidths[j] < len(cell) {
 				originalWidths[j] = len(cell)
@@ -67,7 +74,7 @@ func (t *Table) Render() {
 	// account for gaps of 2 chrs
 	widthBudget := t.Width - TABLE_COL_GAP*(len(t.Header)-1)
 
-	for SumInts(widths...) > widthBudget {
+	for t.Width > 0 && SumInts(widths...) > widthBudget {
 		// find max col width index
 		var max, maxi int
 
@@ -85,7 +92,7 @@ func (t *Table) Render() {
 		widths[maxi] = widths[maxi] - 1
 	}
 
-	rows := append([][]string{t.Header}, t.Rows...)
+	rows = append([][]string{t.Header}, t.Rows...)
 
 	for i, row := range rows {
 		cells := row[:]
@@ -95,6 +102,11 @@ func (t *Table) Render() {
 
 		line := strings.Join(cells, strings.Repeat(" ", TABLE_COL_GAP))
 
+		if t.Width == 0 {
+			fmt.Println(strings.TrimRight(line, " "))
+			continue
+		}
+
 		mode := t.RowStyles[i].Mode
 		fg := t.RowStyles[i].Fg
 		bg := t.RowStyles[i].Bg
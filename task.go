@@ -36,13 +36,30 @@ type Task struct {
 	DelegatedTo string
 	Subtasks    []SubTask
 	// uuids of tasks that this task depends on
-	// blocked status can be derived.
-	// TODO possible filter: :blocked. Also, :overdue
+	// blocked status can be derived, see depend.go
 	Dependencies []string
 
+	// recurrence rule, templates only. See recur.go
+	Recur string `yaml:",omitempty"`
+	// templates only. Time of the last instance for calendar rules, or
+	// resolution of the last instance for rules based on completion.
+	RecurAnchor time.Time `yaml:",omitempty"`
+	// uuid of the recurring template that created this task
+	Parent string `yaml:",omitempty"`
+
+	// wake-up time of a deferred task, when it returns to pending
+	DeferredUntil time.Time `yaml:",omitempty"`
+	// when the task was handed over to DelegatedTo
+	Delegated time.Time `yaml:",omitempty"`
+
 	Created  time.Time
 	Resolved time.Time
 	Due      time.Time
+	// last saved, to settle conflicting changes when merging. See merge.go
+	Modified time.Time `yaml:",omitempty"`
+
+	// when the task was active, see timetrack.go
+	WorkLog []WorkInterval `yaml:",omitempty"`
 }
 
 func (task Task) String() string {
@@ -54,7 +71,7 @@ func (task Task) String() string {
 }
 
 // used for applying a context to a new task
-func (cmdLine *CmdLine) MergeContext(_tl CmdLine) {
+func (cmdLine *CmdLine) MergeContext(_tl CmdLine) error {
 	for _, tag := range _tl.Tags {
 		if !StrSliceContains(cmdLine.Tags, tag) {
 			cmdLine.Tags = append(cmdLine.Tags, tag)
@@ -70,7 +87,7 @@ func (cmdLine *CmdLine) MergeContext(_tl CmdLine) {
 	// TODO same for antitags
 	if _tl.Project != "" {
 		if cmdLine.Project != "" {
-			ExitFail("Could not apply context, project conflict")
+			return InvalidInput("Could not apply context, project conflict")
 		} else {
 			cmdLine.Project = _tl.Project
 		}
@@ -78,11 +95,25 @@ func (cmdLine *CmdLine) MergeContext(_tl CmdLine) {
 
 	if _tl.Priority != "" {
 		if cmdLine.Priority != "" {
-			ExitFail("Could not apply context, priority conflict")
+			return InvalidInput("Could not apply context, priority conflict")
 		} else {
 			cmdLine.Priority = _tl.Priority
 		}
 	}
+
+	if _tl.Due != "" {
+		if cmdLine.Due != "" {
+			return InvalidInput("Could not apply context, due date conflict")
+		} else {
+			cmdLine.Due = _tl.Due
+		}
+	}
+
+	return nil
+}
+
+func (task *Task) IsOverdue(now time.Time) bool {
+	return !task.Due.IsZero() && task.Due.Before(now) && task.Status != STATUS_RESOLVED
 }
 
 func (task *Task) MatchesFilter(cmdLine CmdLine) bool {
@@ -109,11 +140,13 @@ func (task *Task) MatchesFilter(cmdLine CmdLine) bool {
 		}
 	}
 
-	if StrSliceContains(cmdLine.AntiProjects, task.Project) {
-		return false
+	for _, project := range cmdLine.AntiProjects {
+		if MatchesProject(task.Project, project) {
+			return false
+		}
 	}
 
-	if cmdLine.Project != "" && task.Project != cmdLine.Project {
+	if cmdLine.Project != "" && !MatchesProject(task.Project, cmdLine.Project) {
 		return false
 	}
 
@@ -121,6 +154,42 @@ func (task *Task) MatchesFilter(cmdLine CmdLine) bool {
 		return false
 	}
 
+	now := time.Now()
+
+	// relative dates are resolved now rather than when parsed, so they stay
+	// correct in a saved context
+	if cmdLine.Due != "" {
+		due, _ := ParseDueDate(cmdLine.Due, now)
+		if task.Due.IsZero() || !startOfDay(task.Due.Local()).Equal(startOfDay(due.Local())) {
+			return false
+		}
+	}
+
+	if cmdLine.DueBefore != "" {
+		before, _ := ParseDueDate(cmdLine.DueBefore, now)
+		if task.Due.IsZero() || !task.Due.Before(before) {
+			return false
+		}
+	}
+
+	if cmdLine.DueAfter != "" {
+		after, _ := ParseDueDate(cmdLine.DueAfter, now)
+		if task.Due.IsZero() || !task.Due.After(after) {
+			return false
+		}
+	}
+
+	// selectors that need the rest of the task set are handled by
+	// TaskSet.Filter
+	for _, selector := range cmdLine.Selectors {
+		switch selector {
+		case SELECTOR_OVERDUE:
+			if !task.IsOverdue(now) {
+				return false
+			}
+		}
+	}
+
 	if cmdLine.Text != "" && !strings.Contains(strings.ToLower(task.Summary+task.Notes), strings.ToLower(cmdLine.Text)) {
 		return false
 	}
@@ -170,6 +239,24 @@ func (task *Task) Validate() error {
 		if !IsValidUUID4String(uuid) {
 			return errors.New("Invalid dependency UUID4")
 		}
+
+		if uuid == task.UUID {
+			return errors.New("Task depends on itself")
+		}
+	}
+
+	if task.Recur != "" {
+		if _, err := ParseRecurrence(task.Recur); err != nil {
+			return err
+		}
+	}
+
+	if task.Status == STATUS_RECURRING && task.Recur == "" {
+		return errors.New("Recurring task has no recurrence rule")
+	}
+
+	if task.Parent != "" && !IsValidUUID4String(task.Parent) {
+		return errors.New("Invalid parent UUID4")
 	}
 
 	return nil
@@ -0,0 +1,303 @@
+package dstask
+
+// the history of a single task, from the commits that changed its file. The
+// file moves between status directories but keeps its UUID name, so it is
+// followed by UUID rather than path.
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	git "gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+)
+
+type TaskVersion struct {
+	Hash string
+	Time time.Time
+	// subject of the commit that made this version
+	Summary string
+	Task    Task
+	// the task file was deleted, for instance by undoing its creation
+	Removed bool
+	// from the version before this commit. Empty for the first version.
+	Changes []FieldChange
+}
+
+// a field that changed between two versions of a task, formatted for display
+type FieldChange struct {
+	Field string
+	Old   string
+	New   string
+}
+
+func (c FieldChange) String() string {
+	switch {
+	case c.Field == "notes" && strings.HasPrefix(c.New, c.Old):
+		return fmt.Sprintf("notes: + %s", strings.TrimPrefix(c.New[len(c.Old):], "\n"))
+	case c.Field == "tags":
+		return fmt.Sprintf("tags: %s", c.New)
+	case c.Old == "":
+		return fmt.Sprintf("%s: %s", c.Field, c.New)
+	case c.New == "":
+		return fmt.Sprintf("%s: %s -> none", c.Field, c.Old)
+	default:
+		return fmt.Sprintf("%s: %s -> %s", c.Field, c.Old, c.New)
+	}
+}
+
+// the file of a task in a tree, whatever its status, or nil
+func findTaskFile(tree *object.Tree, uuid string) *treeFile {
+	for _, status := range ALL_STATUSES {
+		fp := status + "/" + uuid + ".yml"
+
+		if f, err := tree.File(fp); err == nil {
+			return &treeFile{
+				path: fp,
+				hash: f.Hash,
+				file: f,
+			}
+		}
+	}
+
+	return nil
+}
+
+func commitTaskFile(c *object.Commit, uuid string) (*treeFile, error) {
+	tree, err := c.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	return findTaskFile(tree, uuid), nil
+}
+
+func formatFieldValue(v reflect.Value) string {
+	switch value := v.Interface().(type) {
+	case time.Time:
+		if value.IsZero() {
+			return ""
+		}
+		return value.Local().Format("2006-01-02 15:04")
+	case []string:
+		return strings.Join(value, ", ")
+	case []WorkInterval:
+		var total time.Duration
+		for _, interval := range value {
+			if !interval.Stop.IsZero() {
+				total += interval.Stop.Sub(interval.Start)
+			}
+		}
+		return fmt.Sprintf("%d intervals, %s", len(value), FormatDuration(total))
+	case []SubTask:
+		var resolved int
+		for _, st := range value {
+			if st.Resolved {
+				resolved++
+			}
+		}
+		return fmt.Sprintf("%d subtasks, %d resolved", len(value), resolved)
+	case int:
+		if value == 0 {
+			return ""
+		}
+	}
+
+	return fmt.Sprint(v.Interface())
+}
+
+// the fields that differ between two versions of a task, with status and ID.
+// Modified changes on every save so is left out.
+func taskChanges(old, new Task) []FieldChange {
+	var changes []FieldChange
+
+	o := reflect.ValueOf(old)
+	n := reflect.ValueOf(new)
+	t := o.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.ToLower(field.Name)
+
+		if (field.Tag.Get("yaml") == "-" && field.Name != "Status") || field.Name == "Modified" || field.Name == "UUID" {
+			continue
+		}
+
+		if sameValue(o.Field(i), n.Field(i)) {
+			continue
+		}
+
+		change := FieldChange{
+			Field: name,
+			Old:   formatFieldValue(o.Field(i)),
+			New:   formatFieldValue(n.Field(i)),
+		}
+
+		// the same to display, such as a work interval shorter than a
+		// minute
+		if change.Old == change.New {
+			continue
+		}
+
+		if field.Name == "Tags" {
+			var diff []string
+			for _, tag := range new.Tags {
+				if !StrSliceContains(old.Tags, tag) {
+					diff = append(diff, "+"+tag)
+				}
+			}
+			for _, tag := range old.Tags {
+				if !StrSliceContains(new.Tags, tag) {
+					diff = append(diff, "-"+tag)
+				}
+			}
+			change.New = strings.Join(diff, " ")
+		}
+
+		changes = append(changes, change)
+	}
+
+	return changes
+}
+
+// the versions of a task, oldest first. Commits on other branches that were
+// merged are included; a merge is only a version if it changed the task
+// differently from all its parents. History is read newest first by commit
+// time, and no further than the task was created, with a day to spare for
+// clocks that disagree.
+func (s *GitStore) TaskHistory(uuid string) ([]TaskVersion, error) {
+	var versions []TaskVersion
+	var since time.Time
+
+	repo, err := s.openRepo()
+	if err != nil {
+		return nil, err
+	}
+
+	head, err := resolveCommit(repo, plumbing.HEAD)
+	if err != nil || head == nil {
+		return nil, err
+	}
+
+	commits, err := repo.Log(&git.LogOptions{
+		From:  head.Hash,
+		Order: git.LogOrderCommitterTime,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read the history of task %s: %w", uuid, err)
+	}
+
+	err = commits.ForEach(func(c *object.Commit) error {
+		if !since.IsZero() && c.Committer.When.Before(since) {
+			return storer.ErrStop
+		}
+
+		current, err := commitTaskFile(c, uuid)
+		if err != nil {
+			return fmt.Errorf("Failed to read commit %s: %w", c.Hash.String()[:7], err)
+		}
+
+		var previous *treeFile
+		changed := true
+
+		for i := 0; i < c.NumParents(); i++ {
+			parent, err := c.Parent(i)
+			if err != nil {
+				return fmt.Errorf("Failed to read the parents of commit %s: %w", c.Hash.String()[:7], err)
+			}
+
+			f, err := commitTaskFile(parent, uuid)
+			if err != nil {
+				return fmt.Errorf("Failed to read commit %s: %w", parent.Hash.String()[:7], err)
+			}
+
+			if i == 0 {
+				previous = f
+			}
+
+			if sameTreeFile(current, f) {
+				changed = false
+			}
+		}
+
+		if !changed || (current == nil && previous == nil) {
+			return nil
+		}
+
+		version := TaskVersion{
+			Hash:    c.Hash.String(),
+			Time:    c.Author.When,
+			Summary: commitSubject(c),
+			Removed: current == nil,
+		}
+
+		if current != nil {
+			if version.Task, err = current.task(); err != nil {
+				return err
+			}
+		}
+
+		if previous != nil {
+			old, err := previous.task()
+			if err != nil {
+				return err
+			}
+
+			if current == nil {
+				version.Task = old
+			} else {
+				version.Changes = taskChanges(old, version.Task)
+			}
+		}
+
+		if since.IsZero() && !version.Task.Created.IsZero() {
+			since = version.Task.Created.Add(-24 * time.Hour)
+		}
+
+		versions = append(versions, version)
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	// oldest first
+	for i, j := 0, len(versions)-1; i < j; i, j = i+1, j-1 {
+		versions[i], versions[j] = versions[j], versions[i]
+	}
+
+	return versions, nil
+}
+
+// the version of a task made by the commit with the given hash prefix
+func (s *GitStore) TaskVersion(uuid, hashPrefix string) (Task, error) {
+	versions, err := s.TaskHistory(uuid)
+	if err != nil {
+		return Task{}, err
+	}
+
+	var matches []TaskVersion
+	for _, version := range versions {
+		if strings.HasPrefix(version.Hash, strings.ToLower(hashPrefix)) {
+			matches = append(matches, version)
+		}
+	}
+
+	switch {
+	case len(hashPrefix) < MIN_UUID_PREFIX_LEN:
+		return Task{}, InvalidInput("Specify at least %d characters of the commit", MIN_UUID_PREFIX_LEN)
+	case len(matches) == 0:
+		return Task{}, InvalidInput("No version of the task was made by commit %s, see `dstask <id> history`", hashPrefix)
+	case len(matches) > 1:
+		return Task{}, InvalidInput("Commit %s is ambiguous", hashPrefix)
+	case matches[0].Removed:
+		return Task{}, InvalidInput("The task was removed by commit %s", hashPrefix)
+	}
+
+	return matches[0].Task, nil
+}
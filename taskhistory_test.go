@@ -0,0 +1,109 @@
+package dstask
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTaskHistory(t *testing.T) {
+	store, cleanup := newTestGitStore(t)
+	defer cleanup()
+
+	day := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	task := testTask(1, 1, day)
+	other := testTask(2, 2, day)
+
+	commitTask(t, store, task, "Added 1: task 1")
+	commitTask(t, store, other, "Added 2: task 2")
+
+	task.Summary = "Fix the gate"
+	task.Tags = []string{"garden"}
+	commitTask(t, store, task, "Modified 1: Fix the gate")
+
+	if err := store.Delete(task.UUID); err != nil {
+		t.Fatal(err)
+	}
+	task.Status = STATUS_ACTIVE
+	commitTask(t, store, task, "Started 1: Fix the gate")
+
+	versions, err := store.TaskHistory(task.UUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, version := range versions {
+		var changes []string
+		for _, change := range version.Changes {
+			changes = append(changes, change.String())
+		}
+		got = append(got, fmt.Sprintf("%s [%s]", version.Summary, strings.Join(changes, "; ")))
+	}
+
+	want := []string{
+		"Added 1: task 1 []",
+		"Modified 1: Fix the gate [summary: task 1 -> Fix the gate; tags: +garden]",
+		"Started 1: Fix the gate [status: pending -> active]",
+	}
+
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("versions\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	restored, err := store.TaskVersion(task.UUID, versions[0].Hash[:7])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if restored.Summary != "task 1" {
+		t.Errorf("version %s is %q", versions[0].Hash[:7], restored.Summary)
+	}
+}
+
+// history from before the task was created is not read
+func TestTaskHistoryStopsAtCreation(t *testing.T) {
+	store, cleanup := newTestGitStore(t)
+	defer cleanup()
+
+	now := time.Now()
+	commitTask(t, store, testTask(1, 1, now), "Added 1: task 1")
+	oldest := headHash(t, store)
+	commitTask(t, store, testTask(2, 2, now), "Added 2: task 2")
+
+	// created well after the commits before it
+	task := testTask(3, 3, now.Add(48*time.Hour))
+	commitTask(t, store, task, "Added 3: task 3")
+
+	repo, err := store.openRepo()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := repo.CommitObject(oldest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// unreadable if it was reached
+	tree := c.TreeHash.String()
+	if err := os.Remove(filepath.Join(store.Repo, ".git", "objects", tree[:2], tree[2:])); err != nil {
+		t.Fatal(err)
+	}
+
+	versions, err := store.TaskHistory(task.UUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(versions) != 1 || versions[0].Summary != "Added 3: task 3" {
+		t.Errorf("versions %+v", versions)
+	}
+
+	if _, err := store.TaskHistory(testUUID(1)); err == nil || !strings.Contains(err.Error(), "Failed to read commit") {
+		t.Errorf("read the history of task 1 without its first commit, %v", err)
+	}
+}
@@ -3,19 +3,32 @@ package dstask
 // main task data structures
 
 import (
+	"fmt"
 	"sort"
+	"strings"
 	"time"
 )
 
 type TaskSet struct {
 	tasks []*Task
 
+	// where the tasks were loaded from, and are saved to
+	store Store
+	// the statuses loaded
+	statuses []string
+
 	// indices
 	tasksByID   map[int]*Task
 	tasksByUUID map[string]*Task
 
 	// task count before filters
 	numTasksLoaded int
+
+	// see ids.go
+	idConflicts []IDConflict
+
+	// changes made by Housekeep, for the next commit
+	housekeeping []string
 }
 
 type Project struct {
@@ -30,9 +43,20 @@ type Project struct {
 	Resolved time.Time
 }
 
+// sort by priority, then due date (soonest first, tasks without a due date
+// last), then creation date. Blocked tasks go to the bottom.
 func (ts *TaskSet) SortByPriority() {
 	sort.SliceStable(ts.tasks, func(i, j int) bool { return ts.tasks[i].Created.Before(ts.tasks[j].Created) })
+	sort.SliceStable(ts.tasks, func(i, j int) bool {
+		a, b := ts.tasks[i].Due, ts.tasks[j].Due
+		return !a.IsZero() && (b.IsZero() || a.Before(b))
+	})
 	sort.SliceStable(ts.tasks, func(i, j int) bool { return ts.tasks[i].Priority < ts.tasks[j].Priority })
+	sort.SliceStable(ts.tasks, func(i, j int) bool { return !ts.IsBlocked(ts.tasks[i]) && ts.IsBlocked(ts.tasks[j]) })
+}
+
+func (ts *TaskSet) SortByDeferredUntil() {
+	sort.SliceStable(ts.tasks, func(i, j int) bool { return ts.tasks[i].DeferredUntil.Before(ts.tasks[j].DeferredUntil) })
 }
 
 func (ts *TaskSet) SortByResolved() {
@@ -40,7 +64,7 @@ func (ts *TaskSet) SortByResolved() {
 }
 
 // add a task, but only if it has a new uuid or no uuid. Return annotated task.
-func (ts *TaskSet) AddTask(task Task) Task {
+func (ts *TaskSet) AddTask(task Task) (Task, error) {
 	task.Normalise()
 
 	if task.UUID == "" {
@@ -48,12 +72,12 @@ func (ts *TaskSet) AddTask(task Task) Task {
 	}
 
 	if err := task.Validate(); err != nil {
-		ExitFail("%s, task %s", err, task.UUID)
+		return Task{}, InvalidInput("%s, task %s", err, task.UUID)
 	}
 
 	if ts.tasksByUUID[task.UUID] != nil {
 		// load tasks, do not overwrite
-		return Task{}
+		return Task{}, nil
 	}
 
 	// check ID is unique if there is one
@@ -63,49 +87,105 @@ func (ts *TaskSet) AddTask(task Task) Task {
 
 	// pick one if task isn't resolved and ID isn't there
 	if task.ID == 0 && task.Status != STATUS_RESOLVED {
-		for id := 1; id <= MAX_TASKS_OPEN; id++ {
-			if ts.tasksByID[id] == nil {
-				task.ID = id
-				task.WritePending = true
-				break
-			}
+		if id := ts.freeID(); id > 0 {
+			task.ID = id
+			task.WritePending = true
 		}
 	}
 
 	if task.Created.IsZero() {
 		task.Created = time.Now()
 		task.WritePending = true
+
+		if task.Status == STATUS_ACTIVE {
+			task.startClock(task.Created)
+		}
 	}
 
 	ts.tasks = append(ts.tasks, &task)
 	ts.tasksByUUID[task.UUID] = &task
 	ts.tasksByID[task.ID] = &task
 	ts.numTasksLoaded += 1
-	return task
+	return task, nil
+}
+
+// bring the tasks up to date: create instances of recurring tasks that have
+// fallen due, wake deferred tasks, and keep the renumbering of tasks whose ID
+// was taken. Nothing is saved, so commands that only read make no commit; the
+// next SaveToDisk writes and describes the changes with its own.
+func (ts *TaskSet) Housekeep(now time.Time) error {
+	spawned, err := ts.SpawnDueInstances(now)
+	if err != nil {
+		return err
+	}
+
+	woken, err := ts.WakeDeferredTasks(now)
+	if err != nil {
+		return err
+	}
+
+	if len(spawned) > 0 {
+		ts.housekeeping = append(ts.housekeeping, "Recurred "+joinTasks(spawned))
+	}
+
+	if len(woken) > 0 {
+		ts.housekeeping = append(ts.housekeeping, "Woke "+joinTasks(woken))
+	}
+
+	for _, conflict := range ts.idConflicts {
+		ts.housekeeping = append(ts.housekeeping, conflict.describe(ts))
+	}
+
+	return nil
+}
+
+// the changes made by Housekeep, not yet saved
+func (ts *TaskSet) Housekeeping() []string {
+	return ts.housekeeping
+}
+
+func joinTasks(tasks []Task) string {
+	var names []string
+	for _, task := range tasks {
+		names = append(names, task.String())
+	}
+
+	return strings.Join(names, ", ")
+}
+
+// the lowest ID not in use, or 0 if there is none
+func (ts *TaskSet) freeID() int {
+	for id := 1; id <= MAX_TASKS_OPEN; id++ {
+		if ts.tasksByID[id] == nil {
+			return id
+		}
+	}
+
+	return 0
 }
 
 // TODO maybe this is the place to check for invalid state transitions instead
 // of the main switch statement. Though, a future 3rdparty sync system could
 // need this to work regardless.
-func (ts *TaskSet) MustUpdateTask(task Task) {
+func (ts *TaskSet) UpdateTask(task Task) error {
 	task.Normalise()
 
 	if err := task.Validate(); err != nil {
-		ExitFail("%s, task %s", err, task.UUID)
+		return InvalidInput("%s, task %s", err, task.UUID)
 	}
 
 	if ts.tasksByUUID[task.UUID] == nil {
-		ExitFail("Could not find given task to update by UUID")
+		return fmt.Errorf("%w: could not find given task to update by UUID", ErrTaskNotFound)
 	}
 
 	if !IsValidPriority(task.Priority) {
-		ExitFail("Invalid priority specified")
+		return InvalidInput("Invalid priority specified")
 	}
 
 	old := ts.tasksByUUID[task.UUID]
 
 	if old.Status != task.Status && !IsValidStateTransition(old.Status, task.Status) {
-		ExitFail("Invalid state transition: %s -> %s", old.Status, task.Status)
+		return fmt.Errorf("%w: %s -> %s", ErrInvalidTransition, old.Status, task.Status)
 	}
 
 	if task.Status == STATUS_RESOLVED {
@@ -116,16 +196,38 @@ func (ts *TaskSet) MustUpdateTask(task Task) {
 		task.Resolved = time.Now()
 	}
 
+	if old.Status == STATUS_DEFERRED && task.Status != STATUS_DEFERRED {
+		task.DeferredUntil = time.Time{}
+	}
+
+	if old.Status != STATUS_ACTIVE && task.Status == STATUS_ACTIVE {
+		task.startClock(time.Now())
+	} else if old.Status == STATUS_ACTIVE && task.Status != STATUS_ACTIVE {
+		task.stopClock(time.Now())
+	}
+
+	// rules based on completion recur relative to when the last instance
+	// was resolved
+	if old.Status != STATUS_RESOLVED && task.Status == STATUS_RESOLVED && task.Parent != "" {
+		template := ts.tasksByUUID[task.Parent]
+
+		if template != nil && template.RecurrenceRule().AfterCompletion() {
+			template.RecurAnchor = task.Resolved
+			template.WritePending = true
+		}
+	}
+
 	task.WritePending = true
 	// existing pointer must point to address of new task copied
 	*ts.tasksByUUID[task.UUID] = task
+	return nil
 }
 
 func (ts *TaskSet) Filter(cmdLine CmdLine) {
 	var tasks []*Task
 
 	for _, task := range ts.tasks {
-		if task.MatchesFilter(cmdLine) {
+		if ts.matches(task, cmdLine) {
 			tasks = append(tasks, task)
 		}
 	}
@@ -133,6 +235,39 @@ func (ts *TaskSet) Filter(cmdLine CmdLine) {
 	ts.tasks = tasks
 }
 
+// IDs take precedence over the filter, which is the query if there is one.
+// Contexts saved before queries only have the fields.
+func (ts *TaskSet) matches(task *Task, cmdLine CmdLine) bool {
+	if cmdLine.Query != nil && len(cmdLine.IDs) == 0 {
+		return cmdLine.Query.Match(task, ts)
+	}
+
+	return task.MatchesFilter(cmdLine) && ts.matchesSelectors(task, cmdLine)
+}
+
+// selectors that depend on other tasks
+func (ts *TaskSet) matchesSelectors(task *Task, cmdLine CmdLine) bool {
+	// IDs take precedence, as with MatchesFilter
+	if len(cmdLine.IDs) > 0 {
+		return true
+	}
+
+	for _, selector := range cmdLine.Selectors {
+		switch selector {
+		case SELECTOR_BLOCKED:
+			if !ts.IsBlocked(task) {
+				return false
+			}
+		case SELECTOR_BLOCKING:
+			if !ts.IsBlocking(task) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
 func (ts *TaskSet) FilterByStatus(status string) {
 	var tasks []*Task
 
@@ -145,12 +280,32 @@ func (ts *TaskSet) FilterByStatus(status string) {
 	ts.tasks = tasks
 }
 
-func (ts *TaskSet) MustGetByID(id int) Task {
+func (ts *TaskSet) FilterOutStatus(status string) {
+	var tasks []*Task
+
+	for _, task := range ts.tasks {
+		if task.Status != status {
+			tasks = append(tasks, task)
+		}
+	}
+
+	ts.tasks = tasks
+}
+
+func (ts *TaskSet) GetByID(id int) (Task, error) {
 	if ts.tasksByID[id] == nil {
-		ExitFail("No open task with ID %v exists.", id)
+		return Task{}, fmt.Errorf("%w: no open task with ID %v exists", ErrTaskNotFound, id)
+	}
+
+	return *ts.tasksByID[id], nil
+}
+
+func (ts *TaskSet) GetByUUID(uuid string) (Task, error) {
+	if ts.tasksByUUID[uuid] == nil {
+		return Task{}, fmt.Errorf("%w: no task with UUID %s exists", ErrTaskNotFound, uuid)
 	}
 
-	return *ts.tasksByID[id]
+	return *ts.tasksByUUID[uuid], nil
 }
 
 // TODO should probably return copies.
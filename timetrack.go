@@ -0,0 +1,119 @@
+package dstask
+
+// time tracking. Each time a task enters STATUS_ACTIVE a work interval is
+// opened, and it is closed when the task leaves it, so start and stop are a
+// clock. With SINGLE_ACTIVE, starting a task pauses any other active task.
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+type WorkInterval struct {
+	Start time.Time
+	// zero while the task is active
+	Stop time.Time `yaml:",omitempty"`
+}
+
+// the part of the interval between since and until, either of which may be
+// zero. An open interval runs until now.
+func (i WorkInterval) Clip(since, until, now time.Time) (time.Time, time.Time, bool) {
+	start, stop := i.Start, i.Stop
+	if stop.IsZero() {
+		stop = now
+	}
+
+	if !since.IsZero() && start.Before(since) {
+		start = since
+	}
+
+	if !until.IsZero() && stop.After(until) {
+		stop = until
+	}
+
+	return start, stop, stop.After(start)
+}
+
+func (task *Task) clockRunning() bool {
+	return len(task.WorkLog) > 0 && task.WorkLog[len(task.WorkLog)-1].Stop.IsZero()
+}
+
+func (task *Task) startClock(now time.Time) {
+	if !task.clockRunning() {
+		task.WorkLog = append(task.WorkLog, WorkInterval{Start: now})
+	}
+}
+
+func (task *Task) stopClock(now time.Time) {
+	if task.clockRunning() {
+		task.WorkLog[len(task.WorkLog)-1].Stop = now
+	}
+}
+
+// total time worked on the task, including the current interval
+func (task *Task) TimeWorked(now time.Time) time.Duration {
+	var total time.Duration
+
+	for _, interval := range task.WorkLog {
+		if start, stop, ok := interval.Clip(time.Time{}, time.Time{}, now); ok {
+			total += stop.Sub(start)
+		}
+	}
+
+	return total
+}
+
+// hours and minutes, as on a timesheet
+func FormatDuration(d time.Duration) string {
+	minutes := int(d.Round(time.Minute) / time.Minute)
+	return fmt.Sprintf("%d:%02d", minutes/60, minutes%60)
+}
+
+// pause the active tasks other than the given one, returning them. For
+// SINGLE_ACTIVE, before starting a task.
+func (ts *TaskSet) PauseOtherActive(uuid string) ([]Task, error) {
+	var paused []Task
+
+	for _, task := range ts.tasks {
+		if task.Status != STATUS_ACTIVE || task.UUID == uuid {
+			continue
+		}
+
+		other := *task
+		other.Status = STATUS_PAUSED
+		if err := ts.UpdateTask(other); err != nil {
+			return paused, err
+		}
+
+		paused = append(paused, other)
+	}
+
+	return paused, nil
+}
+
+// intervals recorded on either side, as two machines may have worked on the
+// task. An interval stopped on one side is stopped.
+func mergeWorkLogs(ours, theirs []WorkInterval) []WorkInterval {
+	var merged []WorkInterval
+
+	for _, interval := range append(append([]WorkInterval{}, ours...), theirs...) {
+		found := false
+
+		for i := range merged {
+			if merged[i].Start.Equal(interval.Start) {
+				found = true
+				if merged[i].Stop.IsZero() {
+					merged[i].Stop = interval.Stop
+				}
+			}
+		}
+
+		if !found {
+			merged = append(merged, interval)
+		}
+	}
+
+	sort.SliceStable(merged, func(i, j int) bool { return merged[i].Start.Before(merged[j].Start) })
+	return merged
+}
@@ -0,0 +1,337 @@
+package dstask
+
+// import and export of todo.txt files, see
+// https://github.com/todotxt/todo.txt
+//
+//   x 2026-03-02 2026-03-01 Call the bank +house @phone due:2026-03-04
+//   (B) 2026-03-01 Fix the gate +garden @weekend
+//
+// Priorities (A) to (D) are P0 to P3, +project the project, @context a tag, x
+// and its date a resolved task, and due: the due date. The first +project is
+// the project; any others are kept as tags. P2, the default, is exported
+// without a priority.
+//
+// Export adds uuid:<uuid> so a file can be imported again without duplicating
+// tasks. Lines without one match an existing task with the same summary and
+// project, so importing a file twice does not either. Fields a line does not
+// have, such as a priority on a completed task, are left as they are.
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const TODOTXT_DATE = "2006-01-02"
+
+var todotxtPriorityRegex = regexp.MustCompile(`^\(([A-Z])\)$`)
+
+var todotxtPriorityMap = map[string]string{
+	"A": PRIORITY_CRITICAL,
+	"B": PRIORITY_HIGH,
+	"C": PRIORITY_NORMAL,
+	"D": PRIORITY_LOW,
+}
+
+// the reverse of todotxtPriorityMap, less the default priority
+var todotxtPriorities = map[string]string{
+	PRIORITY_CRITICAL: "A",
+	PRIORITY_HIGH:     "B",
+	PRIORITY_LOW:      "D",
+}
+
+// a parsed line. Zero values are fields the line does not have.
+type TodoTxtLine struct {
+	Done     bool
+	Priority string
+	// dates, in local time
+	Completed time.Time
+	Created   time.Time
+	Due       time.Time
+	Summary   string
+	Projects  []string
+	Contexts  []string
+	UUID      string
+}
+
+func parseTodoTxtDate(word string) (time.Time, bool) {
+	t, err := time.ParseInLocation(TODOTXT_DATE, word, time.Local)
+	return t, err == nil
+}
+
+// the priority of a todo.txt letter. Letters after D are low.
+func todoTxtPriority(letter string) string {
+	if priority, ok := todotxtPriorityMap[letter]; ok {
+		return priority
+	}
+
+	return PRIORITY_LOW
+}
+
+func ParseTodoTxtLine(line string) (TodoTxtLine, error) {
+	var parsed TodoTxtLine
+	var words []string
+
+	fields := strings.Fields(line)
+
+	if len(fields) > 0 && fields[0] == "x" {
+		parsed.Done = true
+		fields = fields[1:]
+
+		if len(fields) > 0 {
+			if t, ok := parseTodoTxtDate(fields[0]); ok {
+				parsed.Completed = t
+				fields = fields[1:]
+			}
+		}
+	}
+
+	if len(fields) > 0 {
+		if m := todotxtPriorityRegex.FindStringSubmatch(fields[0]); m != nil {
+			parsed.Priority = todoTxtPriority(m[1])
+			fields = fields[1:]
+		}
+	}
+
+	if len(fields) > 0 {
+		if t, ok := parseTodoTxtDate(fields[0]); ok {
+			parsed.Created = t
+			fields = fields[1:]
+		}
+	}
+
+	for _, word := range fields {
+		lcWord := strings.ToLower(word)
+
+		switch {
+		case len(word) > 1 && word[0] == '+':
+			parsed.Projects = append(parsed.Projects, lcWord[1:])
+		case len(word) > 1 && word[0] == '@':
+			parsed.Contexts = append(parsed.Contexts, lcWord[1:])
+		case strings.HasPrefix(lcWord, "due:"):
+			due, err := ParseDueDate(word[4:], time.Now())
+			if err != nil {
+				return parsed, InvalidInput("Invalid due date in %s", word)
+			}
+			parsed.Due = due
+		case strings.HasPrefix(lcWord, "pri:") && len(word) == 5:
+			parsed.Priority = todoTxtPriority(strings.ToUpper(word[4:]))
+		case strings.HasPrefix(lcWord, "uuid:") && IsValidUUID4String(word[5:]):
+			parsed.UUID = lcWord[5:]
+		default:
+			words = append(words, word)
+		}
+	}
+
+	parsed.Summary = strings.Join(words, " ")
+	return parsed, nil
+}
+
+// the task of a new line
+func (l TodoTxtLine) Task() Task {
+	task := Task{
+		UUID:     l.UUID,
+		Status:   STATUS_PENDING,
+		Summary:  l.Summary,
+		Priority: l.Priority,
+		Created:  l.Created,
+		Due:      l.Due,
+		Tags:     l.Contexts,
+	}
+
+	if len(l.Projects) > 0 {
+		task.Project = l.Projects[0]
+		task.Tags = append(task.Tags, l.Projects[1:]...)
+	}
+
+	if l.Done {
+		task.Status = STATUS_RESOLVED
+		task.Resolved = l.Completed
+		if task.Resolved.IsZero() {
+			task.Resolved = time.Now()
+		}
+	}
+
+	return task
+}
+
+func sameDay(a, b time.Time) bool {
+	return startOfDay(a.Local()).Equal(startOfDay(b.Local()))
+}
+
+// apply the fields of a line to an existing task. Dates only change if the
+// day does, as todo.txt has no times.
+func (l TodoTxtLine) update(task Task) Task {
+	task.Summary = l.Summary
+
+	if l.Priority != "" {
+		task.Priority = l.Priority
+	}
+
+	if len(l.Projects) > 0 || len(l.Contexts) > 0 {
+		update := l.Task()
+		task.Project = update.Project
+		task.Tags = update.Tags
+	}
+
+	if !l.Created.IsZero() && !sameDay(l.Created, task.Created) {
+		task.Created = l.Created
+	}
+
+	if !l.Due.IsZero() && (task.Due.IsZero() || !sameDay(l.Due, task.Due)) {
+		task.Due = l.Due
+	}
+
+	switch {
+	case l.Done && task.Status != STATUS_RESOLVED:
+		task.Status = STATUS_RESOLVED
+		task.Resolved = l.Completed
+		if task.Resolved.IsZero() {
+			task.Resolved = time.Now()
+		}
+	case l.Done && !l.Completed.IsZero() && !sameDay(l.Completed, task.Resolved):
+		task.Resolved = l.Completed
+	case !l.Done && task.Status == STATUS_RESOLVED:
+		// reopened
+		task.Status = STATUS_PENDING
+		task.Resolved = time.Time{}
+	}
+
+	return task
+}
+
+// the task a line refers to: by UUID, or else one with the same summary and
+// project not already matched by another line. Open tasks are preferred,
+// then the last resolved, so an old instance of a chore is not reopened.
+// Recurring templates are never matched, as lines are instances.
+func (ts *TaskSet) findTodoTxtTask(l TodoTxtLine, matched map[string]bool) *Task {
+	if l.UUID != "" {
+		return ts.tasksByUUID[l.UUID]
+	}
+
+	project := l.Task().Project
+	var found *Task
+
+	for _, task := range ts.tasks {
+		if matched[task.UUID] || task.Status == STATUS_RECURRING || task.Summary != l.Summary || task.Project != project {
+			continue
+		}
+
+		if task.Status != STATUS_RESOLVED {
+			return task
+		}
+
+		if found == nil || task.Resolved.After(found.Resolved) {
+			found = task
+		}
+	}
+
+	return found
+}
+
+// import a todo.txt file, merging with existing tasks
+func (ts *TaskSet) ImportTodoTxt(r io.Reader) (ImportCounts, error) {
+	var counts ImportCounts
+	matched := make(map[string]bool)
+
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		l, err := ParseTodoTxtLine(scanner.Text())
+		if err != nil {
+			return counts, fmt.Errorf("%w, line %d", err, n)
+		}
+
+		if l.Summary == "" {
+			continue
+		}
+
+		existing := ts.findTodoTxtTask(l, matched)
+
+		if existing == nil {
+			task := l.Task()
+			task.WritePending = true
+
+			task, err = ts.AddTask(task)
+			if err != nil {
+				return counts, err
+			}
+
+			matched[task.UUID] = true
+			counts.Added++
+			continue
+		}
+
+		matched[existing.UUID] = true
+		task := l.update(*existing)
+		task.Normalise()
+
+		if sameTaskContent(existing, &task) {
+			counts.Unchanged++
+			continue
+		}
+
+		if err := ts.replaceTask(task); err != nil {
+			return counts, err
+		}
+
+		counts.Updated++
+	}
+
+	if err := scanner.Err(); err != nil {
+		return counts, err
+	}
+
+	return counts, nil
+}
+
+// the todo.txt line of a task
+func (task *Task) TodoTxt() string {
+	var words []string
+
+	if task.Status == STATUS_RESOLVED {
+		words = append(words, "x", task.Resolved.Local().Format(TODOTXT_DATE))
+	} else if letter, ok := todotxtPriorities[task.Priority]; ok {
+		words = append(words, "("+letter+")")
+	}
+
+	if !task.Created.IsZero() {
+		words = append(words, task.Created.Local().Format(TODOTXT_DATE))
+	}
+
+	words = append(words, task.Summary)
+
+	if task.Project != "" {
+		words = append(words, "+"+task.Project)
+	}
+
+	for _, tag := range task.Tags {
+		words = append(words, "@"+tag)
+	}
+
+	if !task.Due.IsZero() {
+		words = append(words, "due:"+task.Due.Local().Format(TODOTXT_DATE))
+	}
+
+	// completed tasks have no priority by convention
+	if letter, ok := todotxtPriorities[task.Priority]; ok && task.Status == STATUS_RESOLVED {
+		words = append(words, "pri:"+letter)
+	}
+
+	words = append(words, "uuid:"+task.UUID)
+
+	return strings.Join(words, " ")
+}
+
+// write the tasks of the set as a todo.txt file
+func (ts *TaskSet) ExportTodoTxt(w io.Writer) error {
+	for _, task := range ts.tasks {
+		if _, err := fmt.Fprintln(w, task.TodoTxt()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,211 @@
+package dstask
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTodoTxtLine(t *testing.T) {
+	date := func(day int) time.Time {
+		return time.Date(2026, 3, day, 0, 0, 0, 0, time.Local)
+	}
+
+	tests := []struct {
+		line string
+		want TodoTxtLine
+	}{
+		{
+			line: "Call the bank",
+			want: TodoTxtLine{Summary: "Call the bank"},
+		},
+		{
+			line: "(B) 2026-03-01 Fix the gate +garden @weekend",
+			want: TodoTxtLine{Priority: PRIORITY_HIGH, Created: date(1), Summary: "Fix the gate", Projects: []string{"garden"}, Contexts: []string{"weekend"}},
+		},
+		{
+			line: "x 2026-03-02 2026-03-01 Call the bank +House +money @phone pri:A",
+			want: TodoTxtLine{Done: true, Completed: date(2), Created: date(1), Priority: PRIORITY_CRITICAL, Summary: "Call the bank", Projects: []string{"house", "money"}, Contexts: []string{"phone"}},
+		},
+		{
+			line: "(Z) Sort the post uuid:" + testUUID(1),
+			want: TodoTxtLine{Priority: PRIORITY_LOW, Summary: "Sort the post", UUID: testUUID(1)},
+		},
+		{
+			// not a valid UUID, so part of the summary
+			line: "Read uuid:1234",
+			want: TodoTxtLine{Summary: "Read uuid:1234"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.line, func(t *testing.T) {
+			got, err := ParseTodoTxtLine(test.line)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if fmt.Sprintf("%+v", got) != fmt.Sprintf("%+v", test.want) {
+				t.Errorf("parsed %+v, want %+v", got, test.want)
+			}
+		})
+	}
+
+	if _, err := ParseTodoTxtLine("Call the bank due:soon"); err == nil {
+		t.Errorf("invalid due date parsed")
+	}
+}
+
+func todoTxtTasks() []Task {
+	day := time.Date(2026, 3, 1, 12, 0, 0, 0, time.Local)
+
+	pending := testTask(1, 1, day)
+	pending.Summary = "Fix the gate"
+	pending.Project = "garden"
+	pending.Tags = []string{"weekend"}
+	pending.Priority = PRIORITY_HIGH
+	pending.Due = endOfDay(day.AddDate(0, 0, 3))
+
+	resolved := testTask(2, 0, day)
+	resolved.Summary = "Call the bank"
+	resolved.Priority = PRIORITY_CRITICAL
+	resolved.Status = STATUS_RESOLVED
+	resolved.Resolved = day.AddDate(0, 0, 1)
+
+	// the default priority, exported without one
+	normal := testTask(3, 2, day)
+	normal.Summary = "Sort the post"
+
+	resolvedNormal := testTask(4, 0, day)
+	resolvedNormal.Summary = "Pay the gas bill"
+	resolvedNormal.Status = STATUS_RESOLVED
+	resolvedNormal.Resolved = day.AddDate(0, 0, 1)
+
+	return []Task{pending, resolved, normal, resolvedNormal}
+}
+
+func TestTodoTxtRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		// tasks already in the set imported into
+		existing []Task
+		want     ImportCounts
+	}{
+		{"into the same tasks", todoTxtTasks(), ImportCounts{Unchanged: 4}},
+		{"into no tasks", nil, ImportCounts{Added: 4}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			exported, err := LoadTaskSet(NewMemoryStore(todoTxtTasks()...), ALL_STATUSES)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var buf bytes.Buffer
+			if err := exported.ExportTodoTxt(&buf); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+				if strings.Contains(line, "post") || strings.Contains(line, "gas") {
+					if strings.Contains(line, "(C)") || strings.Contains(line, "pri:") {
+						t.Errorf("exported the default priority in %q", line)
+					}
+				}
+			}
+
+			ts, err := LoadTaskSet(NewMemoryStore(test.existing...), ALL_STATUSES)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			counts, err := ts.ImportTodoTxt(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if counts != test.want {
+				t.Errorf("counts %+v, want %+v", counts, test.want)
+			}
+
+			for _, want := range exported.Tasks() {
+				got := ts.tasksByUUID[want.UUID]
+				if got == nil {
+					t.Errorf("task %s not imported", want.UUID)
+					continue
+				}
+
+				if got.TodoTxt() != want.TodoTxt() || got.Priority != want.Priority {
+					t.Errorf("imported %q %s, want %q %s", got.TodoTxt(), got.Priority, want.TodoTxt(), want.Priority)
+				}
+			}
+		})
+	}
+}
+
+func TestImportTodoTxtMatching(t *testing.T) {
+	day := time.Date(2026, 3, 1, 12, 0, 0, 0, time.Local)
+
+	chore := func(n int, status string, resolved time.Time) Task {
+		task := testTask(n, 0, day)
+		task.Summary = "Water the plants"
+		task.Status = status
+		task.Resolved = resolved
+		return task
+	}
+
+	template := chore(1, STATUS_RECURRING, time.Time{})
+	template.Recur = "daily"
+	older := chore(2, STATUS_RESOLVED, day.AddDate(0, 0, 1))
+	newer := chore(3, STATUS_RESOLVED, day.AddDate(0, 0, 2))
+	open := chore(4, STATUS_PENDING, time.Time{})
+
+	tests := []struct {
+		name  string
+		tasks []Task
+		line  string
+		// task number updated, or 0 if a task is added
+		want int
+	}{
+		{"open before resolved", []Task{template, older, open, newer}, "(A) Water the plants", 4},
+		{"latest resolved", []Task{template, newer, older}, "(A) Water the plants", 3},
+		{"never a template", []Task{template}, "(A) Water the plants", 0},
+		{"by UUID", []Task{older, open}, "(A) Water the plants uuid:" + testUUID(2), 2},
+		{"different project", []Task{open}, "(A) Water the plants +garden", 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ts, err := LoadTaskSet(NewMemoryStore(test.tasks...), ALL_STATUSES)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			counts, err := ts.ImportTodoTxt(strings.NewReader(test.line))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if test.want == 0 {
+				if counts.Added != 1 {
+					t.Errorf("counts %+v, want a task added", counts)
+				}
+				return
+			}
+
+			if counts.Updated != 1 {
+				t.Fatalf("counts %+v, want a task updated", counts)
+			}
+
+			for _, task := range ts.Tasks() {
+				updated := task.Priority == PRIORITY_CRITICAL
+				if updated != (task.UUID == testUUID(test.want)) {
+					t.Errorf("task %s has priority %s", task.UUID, task.Priority)
+				}
+			}
+		})
+	}
+}
@@ -1,7 +1,9 @@
 package dstask
 
 import (
+	"bufio"
 	"encoding/gob"
+	"errors"
 	"fmt"
 	"github.com/gofrs/uuid"
 	"golang.org/x/sys/unix"
@@ -15,9 +17,18 @@ import (
 	"strings"
 )
 
-func ExitFail(format string, a ...interface{}) {
-	fmt.Fprintf(os.Stderr, "\033[31m"+format+"\033[0m\n", a...)
-	os.Exit(1)
+// ask the user a yes/no question, returning ErrAborted unless the answer is
+// yes
+func Confirm(format string, a ...interface{}) error {
+	reader := bufio.NewReader(os.Stdin)
+	fmt.Fprintf(os.Stderr, format+" [y/n] ", a...)
+	input, _ := reader.ReadString('\n')
+
+	if strings.ToLower(strings.TrimSpace(input)) != "y" {
+		return ErrAborted
+	}
+
+	return nil
 }
 
 func MustExpandHome(filepath string) string {
@@ -70,6 +81,14 @@ func SumInts(vals ...int) int {
 	return total
 }
 
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
+
 func FixStr(text string, width int) string {
 	// remove after newline
 	text = strings.Split(text, "\n")[0]
@@ -80,21 +99,30 @@ func FixStr(text string, width int) string {
 	}
 }
 
-func MustRunCmd(name string, args ...string) {
+func RunCmd(name string, args ...string) error {
 	cmd := exec.Command(name, args...)
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
-	cmd.Run()
+	return cmd.Run()
 }
 
-func MustRunGitCmd(args ...string) {
-	root := MustExpandHome(GIT_REPO)
-	args = append([]string{"-C", root}, args...)
-	MustRunCmd("git", args...)
+func RunGitCmd(args ...string) error {
+	return runGitCmdIn(GIT_REPO, args...)
 }
 
-func MustEditBytes(data []byte, ext string) []byte {
+func runGitCmdIn(repo string, args ...string) error {
+	root := MustExpandHome(repo)
+	err := RunCmd("git", append([]string{"-C", root}, args...)...)
+
+	if err != nil {
+		return &GitError{Args: args, Err: err}
+	}
+
+	return nil
+}
+
+func EditBytes(data []byte, ext string) ([]byte, error) {
 	editor := os.Getenv("EDITOR")
 
 	if editor == "" {
@@ -103,7 +131,7 @@ func MustEditBytes(data []byte, ext string) []byte {
 
 	tmpfile, err := ioutil.TempFile("", "dstask.*."+ext)
 	if err != nil {
-		ExitFail("Could not create temporary file to edit")
+		return nil, fmt.Errorf("Could not create temporary file to edit: %w", err)
 	}
 	defer os.Remove(tmpfile.Name())
 
@@ -111,17 +139,20 @@ func MustEditBytes(data []byte, ext string) []byte {
 	tmpfile.Close()
 
 	if err != nil {
-		ExitFail("Could not write to temporary file to edit")
+		return nil, fmt.Errorf("Could not write to temporary file to edit: %w", err)
+	}
+
+	if err := RunCmd(editor, tmpfile.Name()); err != nil {
+		return nil, fmt.Errorf("Editor %s failed: %w", editor, err)
 	}
 
-	MustRunCmd(editor, tmpfile.Name())
 	data, err = ioutil.ReadFile(tmpfile.Name())
 
 	if err != nil {
-		ExitFail("Could not read back temporary edited file")
+		return nil, fmt.Errorf("Could not read back temporary edited file: %w", err)
 	}
 
-	return data
+	return data, nil
 }
 
 func StrSliceContains(haystack []string, needle string) bool {
@@ -134,32 +165,32 @@ func StrSliceContains(haystack []string, needle string) bool {
 	return false
 }
 
-func MustWriteGob(filePath string, object interface{}) {
+func WriteGob(filePath string, object interface{}) error {
 	file, err := os.Create(filePath)
-	defer file.Close()
-
 	if err != nil {
-		ExitFail("Failed to open %s for writing: ", filePath)
+		return fmt.Errorf("Failed to open %s for writing: %w", filePath, err)
 	}
+	defer file.Close()
 
 	encoder := gob.NewEncoder(file)
-	encoder.Encode(object)
+	return encoder.Encode(object)
 }
 
-func MustReadGob(filePath string, object interface{}) {
+func ReadGob(filePath string, object interface{}) error {
 	file, err := os.Open(filePath)
-	defer file.Close()
-
 	if err != nil {
-		ExitFail("Failed to open %s for reading: ", filePath)
+		return fmt.Errorf("Failed to open %s for reading: %w", filePath, err)
 	}
+	defer file.Close()
 
 	decoder := gob.NewDecoder(file)
 	err = decoder.Decode(object)
 
 	if err != nil {
-		ExitFail("Failed to parse gob: %s", filePath)
+		return fmt.Errorf("Failed to parse gob %s: %w", filePath, err)
 	}
+
+	return nil
 }
 
 func IsValidStateTransition(from string, to string) bool {
@@ -172,7 +203,7 @@ func IsValidStateTransition(from string, to string) bool {
 	return false
 }
 
-func MustOpenBrowser(url string) {
+func OpenBrowser(url string) error {
 	var err error
 
 	switch runtime.GOOS {
@@ -183,12 +214,14 @@ func MustOpenBrowser(url string) {
 	case "darwin":
 		err = exec.Command("open", url).Start()
 	default:
-		ExitFail("unsupported platform")
+		return errors.New("Unsupported platform")
 	}
 
 	if err != nil {
-		ExitFail("Failed to open browser")
+		return fmt.Errorf("Failed to open browser: %w", err)
 	}
+
+	return nil
 }
 
 func DeduplicateStrings(s []string) []string {
@@ -205,17 +238,28 @@ func DeduplicateStrings(s []string) []string {
 	return s[:j]
 }
 
-func MustGetTermSize() (int, int) {
+func GetTermSize() (int, int, error) {
 	if FAKE_PTY {
-		return 80, 24
+		return 80, 24, nil
 	}
 
 	ws, err := unix.IoctlGetWinsize(int(os.Stdout.Fd()), unix.TIOCGWINSZ)
 	if err != nil {
-		ExitFail("Not a TTY")
+		return 0, 0, errors.New("Not a TTY")
+	}
+
+	return int(ws.Col), int(ws.Row), nil
+}
+
+// the size of the terminal, or zero if stdout is not one, for plain output.
+// See Table.
+func TermSize() (int, int) {
+	w, h, err := GetTermSize()
+	if err != nil {
+		return 0, 0
 	}
 
-	return int(ws.Col), int(ws.Row)
+	return w, h
 }
 
 func IsTTY() bool {